@@ -0,0 +1,446 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+)
+
+// Cached scrape results are served by the API if they're younger than this
+// duration.
+const apiCacheMaxAge = 5 * time.Minute
+
+// Number of scrape errors to remember.
+const scrapeErrorHistory = 10
+
+var errAPINotFound = errors.New("not found")
+
+type scrapeError struct {
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+}
+
+// scrapeCache holds the results of the most recent scrape.
+type scrapeCache struct {
+	mu      sync.Mutex
+	time    time.Time
+	nav     *luxwsclient.NavRoot
+	content *luxwsclient.ContentRoot
+	errors  []scrapeError
+
+	// Outcomes of the most recent collection. They're retained if content
+	// is retrieved without collecting metrics.
+	outcomes *luxwscollect.Outcomes
+
+	// Pages other than the information page keyed by their path (see
+	// pageKey).
+	pages map[string]cachedPage
+}
+
+type cachedPage struct {
+	time    time.Time
+	content *luxwsclient.ContentRoot
+}
+
+func (sc *scrapeCache) store(now time.Time, nav *luxwsclient.NavRoot, content *luxwsclient.ContentRoot, outcomes *luxwscollect.Outcomes) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if now.Before(sc.time) {
+		// A more recent scrape finished first
+		return
+	}
+
+	sc.time = now
+	sc.nav = nav
+	sc.content = content
+
+	if outcomes != nil {
+		sc.outcomes = outcomes
+	}
+}
+
+// storePage stores a page other than the information page.
+func (sc *scrapeCache) storePage(now time.Time, key string, content *luxwsclient.ContentRoot) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if now.Before(sc.pages[key].time) {
+		return
+	}
+
+	if sc.pages == nil {
+		sc.pages = map[string]cachedPage{}
+	}
+
+	sc.pages[key] = cachedPage{time: now, content: content}
+}
+
+// getPage returns a cached page if it's not older than maxAge.
+func (sc *scrapeCache) getPage(now time.Time, maxAge time.Duration, key string) (time.Time, *luxwsclient.ContentRoot, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	p, ok := sc.pages[key]
+	if !ok || now.Sub(p.time) > maxAge {
+		return time.Time{}, nil, false
+	}
+
+	return p.time, p.content, true
+}
+
+// lastOutcomes returns the outcomes of the most recent collection or nil.
+func (sc *scrapeCache) lastOutcomes() *luxwscollect.Outcomes {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	return sc.outcomes
+}
+
+func (sc *scrapeCache) storeError(now time.Time, err error) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	sc.errors = append(sc.errors, scrapeError{Time: now, Message: err.Error()})
+
+	if len(sc.errors) > scrapeErrorHistory {
+		sc.errors = append([]scrapeError(nil), sc.errors[len(sc.errors)-scrapeErrorHistory:]...)
+	}
+}
+
+// get returns the cached data if it's not older than maxAge.
+func (sc *scrapeCache) get(now time.Time, maxAge time.Duration) (time.Time, *luxwsclient.NavRoot, *luxwsclient.ContentRoot, bool) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	if sc.nav == nil || now.Sub(sc.time) > maxAge {
+		return time.Time{}, nil, nil, false
+	}
+
+	return sc.time, sc.nav, sc.content, true
+}
+
+// last returns the time and content of the most recent successful scrape
+// regardless of its age.
+func (sc *scrapeCache) last() (time.Time, *luxwsclient.ContentRoot) {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	return sc.time, sc.content
+}
+
+// recentErrors returns the most recent scrape errors, newest first.
+func (sc *scrapeCache) recentErrors() []scrapeError {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	result := make([]scrapeError, 0, len(sc.errors))
+
+	for i := len(sc.errors) - 1; i >= 0; i-- {
+		result = append(result, sc.errors[i])
+	}
+
+	return result
+}
+
+// apiNavItem is the JSON representation of luxwsclient.NavItem.
+type apiNavItem struct {
+	ID    string       `json:"id"`
+	Name  string       `json:"name"`
+	Items []apiNavItem `json:"items,omitempty"`
+}
+
+func newAPINavItems(items []luxwsclient.NavItem) []apiNavItem {
+	var result []apiNavItem
+
+	for _, item := range items {
+		result = append(result, apiNavItem{
+			ID:    item.ID,
+			Name:  item.Name,
+			Items: newAPINavItems(item.Items),
+		})
+	}
+
+	return result
+}
+
+// apiContentItem is the JSON representation of luxwsclient.ContentItem with
+// the parsed value and the metrics derived from it.
+type apiContentItem struct {
+	ID      string           `json:"id"`
+	Name    string           `json:"name"`
+	Value   *string          `json:"value,omitempty"`
+	Parsed  *float64         `json:"parsed,omitempty"`
+	Unit    string           `json:"unit,omitempty"`
+	Metrics []string         `json:"metrics,omitempty"`
+	Items   []apiContentItem `json:"items,omitempty"`
+}
+
+// newAPIContentItems converts content items. The metrics of items are taken
+// from the outcomes of the most recent collection. Outcomes are looked up
+// via names (see outcomeNames) or the name of the group containing the
+// items.
+func (c *collector) newAPIContentItems(names outcomeNames, groupName string, items luxwsclient.ContentItems) []apiContentItem {
+	outcomes := c.cache.lastOutcomes()
+
+	var convert func(groupName string, items luxwsclient.ContentItems) []apiContentItem
+
+	convert = func(groupName string, items luxwsclient.ContentItems) []apiContentItem {
+		var result []apiContentItem
+
+		for _, item := range items {
+			ai := apiContentItem{
+				ID:    item.ID,
+				Name:  item.Name,
+				Value: item.Value,
+				Items: convert(item.Name, item.Items),
+			}
+
+			if item.Value != nil {
+				if outcome, ok := names.lookup(outcomes, groupName, item); ok {
+					ai.Metrics = outcome.Metrics
+				}
+
+				if value, unit, err := c.parseValue(*item.Value); err == nil {
+					ai.Parsed = &value
+					ai.Unit = unit
+				}
+			}
+
+			result = append(result, ai)
+		}
+
+		return result
+	}
+
+	return convert(groupName, items)
+}
+
+type apiContent struct {
+	Time   time.Time        `json:"time"`
+	Cached bool             `json:"cached"`
+	Items  []apiContentItem `json:"items"`
+}
+
+// dial connects to the controller. Additional client options can be given.
+func (c *collector) dial(ctx context.Context, opts ...luxwsclient.Option) (*luxwsclient.Client, error) {
+	return luxwsclient.Dial(ctx, c.address, append(c.clientOpts[:len(c.clientOpts):len(c.clientOpts)], opts...)...)
+}
+
+// login connects to the controller and returns the navigation structure.
+func (c *collector) login(ctx context.Context) (*luxwsclient.Client, *luxwsclient.NavRoot, error) {
+	cl, err := c.dial(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nav, err := cl.Login(ctx, c.password.get())
+	if err != nil {
+		cl.Close()
+		return nil, nil, err
+	}
+
+	return cl, nav, nil
+}
+
+// fetchContent returns the content of the page identified by a path of names.
+// The navigation path can be followed by names of content groups. Pages are
+// served from the cache if available.
+func (c *collector) fetchContent(ctx context.Context, path []string) (*apiContent, error) {
+	if ts, nav, content, ok := c.cache.get(c.now(), apiCacheMaxAge); ok {
+		// Pages below the information page are groups in its content
+		for idx, name := range path {
+			if name != c.terms.NavInformation {
+				continue
+			}
+
+			if item, rest := nav.FindPath(path[:idx+1]); item != nil && len(rest) == 0 {
+				items, groupName, ok := content.Items.FindPath(path[idx+1:])
+				if !ok {
+					return nil, errAPINotFound
+				}
+
+				return &apiContent{Time: ts, Cached: true, Items: c.newAPIContentItems(c.outcomeNames(content), groupName, items)}, nil
+			}
+		}
+	}
+
+	// The longest cached prefix is the page
+	for idx := len(path); idx > 0; idx-- {
+		if ts, content, ok := c.cache.getPage(c.now(), apiCacheMaxAge, pageKey(path[:idx])); ok {
+			items, groupName, ok := content.Items.FindPath(path[idx:])
+			if !ok {
+				return nil, errAPINotFound
+			}
+
+			return &apiContent{Time: ts, Cached: true, Items: c.newAPIContentItems(nil, groupName, items)}, nil
+		}
+	}
+
+	if err := c.sem.Acquire(ctx, 1); err != nil {
+		return nil, err
+	}
+
+	defer c.sem.Release(1)
+
+	cl, nav, err := c.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cl.Close()
+
+	item, rest := nav.FindPath(path)
+	if item == nil {
+		return nil, errAPINotFound
+	}
+
+	content, err := cl.Get(ctx, item.ID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching ID %q failed: %w", item.ID, err)
+	}
+
+	items, groupName, ok := content.Items.FindPath(rest)
+	if !ok {
+		return nil, errAPINotFound
+	}
+
+	var names outcomeNames
+
+	if pagePath := path[:len(path)-len(rest)]; c.isInformationPage(pagePath) {
+		names = c.outcomeNames(content)
+	} else {
+		c.cache.storePage(c.now(), pageKey(pagePath), content)
+	}
+
+	return &apiContent{Time: c.now(), Items: c.newAPIContentItems(names, groupName, items)}, nil
+}
+
+// snapshot returns the navigation and information page, either from the
+// cache or by scraping the controller.
+func (c *collector) snapshot(ctx context.Context) (time.Time, *luxwsclient.NavRoot, *luxwsclient.ContentRoot, bool, error) {
+	if ts, nav, content, ok := c.cache.get(c.now(), apiCacheMaxAge); ok {
+		return ts, nav, content, true, nil
+	}
+
+	if err := c.sem.Acquire(ctx, 1); err != nil {
+		return time.Time{}, nil, nil, false, err
+	}
+
+	defer c.sem.Release(1)
+
+	nav, content, err := c.fetchInformation(ctx, nil, nil, nil)
+	if err != nil {
+		return time.Time{}, nil, nil, false, err
+	}
+
+	return c.now(), nav, content, false, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(value)
+}
+
+func writeAPIError(w http.ResponseWriter, err error) {
+	status := http.StatusBadGateway
+
+	switch {
+	case errors.Is(err, errAPINotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, errControlInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, errControlUnauthorized):
+		status = http.StatusUnauthorized
+	case errors.Is(err, errControlNotAllowed):
+		status = http.StatusForbidden
+	}
+
+	writeJSON(w, status, struct {
+		Error string `json:"error"`
+	}{err.Error()})
+}
+
+// apiContext limits the duration of controller requests made by API handlers.
+func (c *collector) apiContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if c.timeout > 0 {
+		return context.WithTimeout(r.Context(), c.timeout)
+	}
+
+	return context.WithCancel(r.Context())
+}
+
+// registerAPI adds the JSON API handlers to a mux.
+func (c *collector) registerAPI(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/navigation", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := c.apiContext(r)
+		defer cancel()
+
+		ts, nav, _, cached, err := c.snapshot(ctx)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			Time   time.Time    `json:"time"`
+			Cached bool         `json:"cached"`
+			ID     string       `json:"id"`
+			Items  []apiNavItem `json:"items"`
+		}{ts, cached, nav.ID, newAPINavItems(nav.Items)})
+	})
+
+	mux.HandleFunc("GET /api/v1/content/{path...}", func(w http.ResponseWriter, r *http.Request) {
+		var path []string
+
+		for _, name := range strings.Split(r.PathValue("path"), "/") {
+			if name != "" {
+				path = append(path, name)
+			}
+		}
+
+		ctx, cancel := c.apiContext(r)
+		defer cancel()
+
+		content, err := c.fetchContent(ctx, path)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, content)
+	})
+
+	mux.HandleFunc("GET /api/v1/snapshot", func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := c.apiContext(r)
+		defer cancel()
+
+		ts, nav, content, cached, err := c.snapshot(ctx)
+		if err != nil {
+			writeAPIError(w, err)
+			return
+		}
+
+		writeJSON(w, http.StatusOK, struct {
+			Time       time.Time        `json:"time"`
+			Cached     bool             `json:"cached"`
+			Navigation []apiNavItem     `json:"navigation"`
+			Content    []apiContentItem `json:"content"`
+			Errors     []scrapeError    `json:"errors"`
+		}{ts, cached, newAPINavItems(nav.Items), c.newAPIContentItems(c.outcomeNames(content), "", content.Items), c.cache.recentErrors()})
+	})
+
+	mux.HandleFunc("GET /api/events", c.handleEvents)
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+)
+
+func TestAPI(t *testing.T) {
+	unavailable := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(unavailable.Close)
+
+	c := newCollector(collectorOpts{
+		terms:   luxwslang.English,
+		loc:     time.UTC,
+		timeout: time.Minute,
+	})
+
+	if serverURL, err := url.Parse(unavailable.URL); err != nil {
+		t.Fatal(err)
+	} else {
+		c.address = serverURL.Host
+	}
+
+	now := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	outcomes := luxwscollect.NewOutcomes()
+	outcomes.Metric("temperatures", "flow", "luxws_temperature")
+	outcomes.ParseError("temperatures", "mode", errors.New("not numeric"))
+
+	c.cache.store(now.Add(-time.Minute), &luxwsclient.NavRoot{
+		ID: "0x1",
+		Items: []luxwsclient.NavItem{
+			{ID: "0x2", Name: "information", Items: []luxwsclient.NavItem{
+				{ID: "0x3", Name: "temperatures"},
+			}},
+			{ID: "0x4", Name: "settings"},
+		},
+	}, &luxwsclient.ContentRoot{
+		Items: luxwsclient.ContentItems{
+			{
+				ID:   "0x10",
+				Name: "temperatures",
+				Items: luxwsclient.ContentItems{
+					{ID: "0x11", Name: "flow", Value: luxwsclient.String("30.2°C")},
+					{ID: "0x12", Name: "mode", Value: luxwsclient.String("heating")},
+				},
+			},
+		},
+	}, outcomes)
+	c.cache.storeError(now.Add(-2*time.Minute), errors.New("timeout"))
+
+	mux := http.NewServeMux()
+	c.registerAPI(mux)
+
+	for _, tc := range []struct {
+		path       string
+		wantStatus int
+		want       string
+	}{
+		{
+			path:       "/api/v1/navigation",
+			wantStatus: http.StatusOK,
+			want: `{
+  "time": "2024-09-01T11:59:00Z",
+  "cached": true,
+  "id": "0x1",
+  "items": [
+    {
+      "id": "0x2",
+      "name": "information",
+      "items": [
+        {
+          "id": "0x3",
+          "name": "temperatures"
+        }
+      ]
+    },
+    {
+      "id": "0x4",
+      "name": "settings"
+    }
+  ]
+}
+`,
+		},
+		{
+			path:       "/api/v1/content/information/temperatures",
+			wantStatus: http.StatusOK,
+			want: `{
+  "time": "2024-09-01T11:59:00Z",
+  "cached": true,
+  "items": [
+    {
+      "id": "0x11",
+      "name": "flow",
+      "value": "30.2°C",
+      "parsed": 30.2,
+      "unit": "degC",
+      "metrics": [
+        "luxws_temperature"
+      ]
+    },
+    {
+      "id": "0x12",
+      "name": "mode",
+      "value": "heating"
+    }
+  ]
+}
+`,
+		},
+		{
+			path:       "/api/v1/content/information/missing",
+			wantStatus: http.StatusNotFound,
+		},
+		{
+			// Not cached
+			path:       "/api/v1/content/settings",
+			wantStatus: http.StatusBadGateway,
+		},
+	} {
+		t.Run(tc.path, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tc.path, nil))
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Status %d, want %d", rec.Code, tc.wantStatus)
+			}
+
+			if tc.want != "" {
+				if diff := cmp.Diff(tc.want, rec.Body.String()); diff != "" {
+					t.Errorf("Body diff (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/snapshot", nil))
+
+	var snapshot struct {
+		Cached  bool          `json:"cached"`
+		Content []any         `json:"content"`
+		Errors  []scrapeError `json:"errors"`
+	}
+
+	if err := json.NewDecoder(rec.Body).Decode(&snapshot); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]scrapeError{{Time: now.Add(-2 * time.Minute), Message: "timeout"}}, snapshot.Errors); diff != "" {
+		t.Errorf("Snapshot errors diff (-want +got):\n%s", diff)
+	}
+
+	if !snapshot.Cached || len(snapshot.Content) != 1 {
+		t.Errorf("Snapshot not served from cache: %+v", snapshot)
+	}
+}
+
+func TestAPIPageCache(t *testing.T) {
+	address, _ := newFakeSettingsController(t)
+
+	c := newCollector(collectorOpts{
+		address: address,
+		terms:   luxwslang.German,
+		loc:     time.UTC,
+		timeout: time.Minute,
+	})
+
+	now := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	mux := http.NewServeMux()
+	c.registerAPI(mux)
+
+	get := func(path string) (int, apiContent) {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		var content apiContent
+
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &content); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		return rec.Code, content
+	}
+
+	if status, content := get("/api/v1/content/Einstellungen/Warmwasser"); status != http.StatusOK || content.Cached {
+		t.Fatalf("Status %d, cached %t, want %d, not cached", status, content.Cached, http.StatusOK)
+	}
+
+	// Further requests don't connect to the controller
+	c.address = "127.0.0.1:1"
+	now = now.Add(time.Minute)
+
+	status, content := get("/api/v1/content/Einstellungen/Warmwasser/Temperaturen")
+	if status != http.StatusOK || !content.Cached || !content.Time.Equal(now.Add(-time.Minute)) {
+		t.Errorf("Status %d, cached %t, time %v, want cached result", status, content.Cached, content.Time)
+	}
+
+	if len(content.Items) != 2 || content.Items[0].Name != "Warmwasser-Soll" {
+		t.Errorf("Unexpected items: %+v", content.Items)
+	}
+
+	if status, _ := get("/api/v1/content/Einstellungen/Warmwasser/Missing"); status != http.StatusNotFound {
+		t.Errorf("Status %d for missing group, want %d", status, http.StatusNotFound)
+	}
+
+	// Expired
+	now = now.Add(apiCacheMaxAge)
+
+	if status, _ := get("/api/v1/content/Einstellungen/Warmwasser"); status != http.StatusBadGateway {
+		t.Errorf("Status %d after expiry, want %d", status, http.StatusBadGateway)
+	}
+}
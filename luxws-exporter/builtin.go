@@ -0,0 +1,203 @@
+package main
+
+import (
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// builtinModule is a collector module built into the exporter. All built-in
+// modules collect from the information page.
+type builtinModule struct {
+	c    *collector
+	name string
+	help string
+
+	// Failures of required collectors fail the whole scrape. Required
+	// collectors can't be disabled.
+	required bool
+
+	descs func(*collector) []*prometheus.Desc
+	fn    func(*collector, *luxwscollect.Env, chan<- prometheus.Metric, *luxwsclient.ContentRoot) error
+}
+
+var _ luxwscollect.Module = (*builtinModule)(nil)
+
+func (m *builtinModule) Name() string {
+	return m.name
+}
+
+func (m *builtinModule) Pages(terms *luxwslang.Terminology) [][]string {
+	return [][]string{{terms.NavInformation}}
+}
+
+func (m *builtinModule) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range m.descs(m.c) {
+		ch <- desc
+	}
+}
+
+func (m *builtinModule) Collect(env *luxwscollect.Env, ch chan<- prometheus.Metric, pages []*luxwsclient.ContentRoot) error {
+	return m.fn(m.c, env, ch, pages[0])
+}
+
+// moduleRequired reports whether a module is a required built-in collector.
+func moduleRequired(m luxwscollect.Module) bool {
+	b, ok := m.(*builtinModule)
+
+	return ok && b.required
+}
+
+// builtinModules lists the built-in collectors in the order in which they're
+// run. Later collectors may depend on quirks detected by earlier ones.
+var builtinModules = []builtinModule{
+	{
+		name:     "info",
+		help:     "Controller information and system status",
+		required: true,
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.infoDesc, c.opModeDesc, c.opModeIDDesc, c.ssPowerConsumptionDesc, c.ssHeatingCapacityDesc, c.defrostDesc}
+		},
+		fn: (*collector).collectInfo,
+	},
+	{
+		name: "temperatures",
+		help: "Temperatures",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.temperatureDesc}
+		},
+		fn: (*collector).collectTemperatures,
+	},
+	{
+		name: "operating_duration",
+		help: "Operating hours",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.operatingDurationDesc}
+		},
+		fn: (*collector).collectOperatingDuration,
+	},
+	{
+		name: "elapsed_time",
+		help: "Elapsed times",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.elapsedDurationDesc}
+		},
+		fn: (*collector).collectElapsedTime,
+	},
+	{
+		name: "inputs",
+		help: "Inputs",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.inputDesc}
+		},
+		fn: (*collector).collectInputs,
+	},
+	{
+		name: "outputs",
+		help: "Outputs",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.outputDesc}
+		},
+		fn: (*collector).collectOutputs,
+	},
+	{
+		name: "supplied_heat",
+		help: "Supplied heat from heat quantity or energy monitor",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.suppliedHeatDesc, c.suppliedHeatCntrDesc}
+		},
+		fn: (*collector).collectSuppliedHeat,
+	},
+	{
+		name: "energy_input",
+		help: "Energy input from energy monitor",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.energyInputDesc}
+		},
+		fn: (*collector).collectEnergyInput,
+	},
+	{
+		name: "latest_error",
+		help: "Latest entry of error memory",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.latestErrorDesc}
+		},
+		fn: (*collector).collectLatestError,
+	},
+	{
+		name: "latest_switchoff",
+		help: "Latest switch-off",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.switchOffDesc}
+		},
+		fn: (*collector).collectLatestSwitchOff,
+	},
+	{
+		name: "impulses",
+		help: "Impulses from operating hours",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.impulsesDesc}
+		},
+		fn: (*collector).collectImpulses,
+	},
+	{
+		name: "cop",
+		help: "Coefficient of performance",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.copInstantaneousDesc, c.copCumulativeDesc, c.copSeasonalDesc}
+		},
+		fn: (*collector).collectCOP,
+	},
+	{
+		name: "estimated_heat",
+		help: "Estimated heat output",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.estimatedHeatPowerDesc, c.estimatedHeatDesc}
+		},
+		fn: (*collector).collectEstimatedHeat,
+	},
+	{
+		name: "compressor",
+		help: "Compressor cycles",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.compressorRunDesc, c.compressorPauseDesc, c.compressorStartsPerHourDesc, c.compressorShortCyclingDesc, c.compressorMissedStartsDesc}
+		},
+		fn: (*collector).collectCompressor,
+	},
+	{
+		name: "defrost",
+		help: "Defrost events",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.defrostEventsDesc, c.defrostDurationDesc, c.defrostIntervalDesc, c.defrostOutdoorTemperatureDesc}
+		},
+		fn: (*collector).collectDefrost,
+	},
+	{
+		name: "journal",
+		help: "Error and switch-off journal",
+		descs: func(c *collector) []*prometheus.Desc {
+			return []*prometheus.Desc{c.journalEventsDesc}
+		},
+		fn: (*collector).collectJournal,
+	},
+	{
+		name: "opmode_change",
+		help: "Notifications about operation mode changes",
+		descs: func(*collector) []*prometheus.Desc {
+			return nil
+		},
+		fn: (*collector).collectOpModeChange,
+	},
+}
+
+// findBuiltinModule returns the built-in collector with the given name or nil.
+func findBuiltinModule(name string) *builtinModule {
+	for idx := range builtinModules {
+		if builtinModules[idx].name == name {
+			return &builtinModules[idx]
+		}
+	}
+
+	return nil
+}
@@ -11,50 +11,91 @@ import (
 	"time"
 
 	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
 	"github.com/hansmi/wp2reg-luxws/luxwslang"
 	"github.com/hashicorp/go-cleanhttp"
 	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 	"golang.org/x/sync/semaphore"
 )
 
-type contentCollectFunc func(chan<- prometheus.Metric, *luxwsclient.ContentRoot, *quirks) error
+type contentCollectFunc func(*luxwscollect.Env, chan<- prometheus.Metric, *luxwsclient.ContentRoot) error
 
 type collector struct {
-	log                        *zap.Logger
-	httpDo                     func(req *http.Request) (*http.Response, error)
-	sem                        *semaphore.Weighted
-	timeout                    time.Duration
-	address                    string
-	password                   string
-	clientOpts                 []luxwsclient.Option
-	httpAddress                string
-	loc                        *time.Location
-	terms                      *luxwslang.Terminology
-	upDesc                     *prometheus.Desc
-	infoDesc                   *prometheus.Desc
-	temperatureDesc            *prometheus.Desc
-	operatingDurationDesc      *prometheus.Desc
-	elapsedDurationDesc        *prometheus.Desc
-	inputDesc                  *prometheus.Desc
-	outputDesc                 *prometheus.Desc
-	opModeDesc                 *prometheus.Desc
-	opModeIDDesc               *prometheus.Desc
-	ssPowerConsumptionDesc     *prometheus.Desc // under System Status=ss
-	ssHeatingCapacityDesc      *prometheus.Desc // under System Status=ss
-	suppliedHeatDesc           *prometheus.Desc // total values as Gauge because values will go down during defrost
-	suppliedHeatCntrDesc       *prometheus.Desc // total values as Counter without lower values than previous val.
-	energyInputDesc            *prometheus.Desc // total values / counter
-	latestErrorDesc            *prometheus.Desc
-	switchOffDesc              *prometheus.Desc
-	nodeTimeDesc               *prometheus.Desc
-	impulsesDesc               *prometheus.Desc
-	defrostDesc                *prometheus.Desc
-	nonDecreasingCounterValues map[string]float64 // just in case
+	log                           *zap.Logger
+	httpDo                        func(req *http.Request) (*http.Response, error)
+	sem                           *semaphore.Weighted
+	timeout                       time.Duration
+	address                       string
+	password                      *passwordSource
+	clientOpts                    []luxwsclient.Option
+	httpAddress                   string
+	loc                           *time.Location
+	terms                         *luxwslang.Terminology
+	upDesc                        *prometheus.Desc
+	infoDesc                      *prometheus.Desc
+	temperatureDesc               *prometheus.Desc
+	operatingDurationDesc         *prometheus.Desc
+	elapsedDurationDesc           *prometheus.Desc
+	inputDesc                     *prometheus.Desc
+	outputDesc                    *prometheus.Desc
+	opModeDesc                    *prometheus.Desc
+	opModeIDDesc                  *prometheus.Desc
+	ssPowerConsumptionDesc        *prometheus.Desc // under System Status=ss
+	ssHeatingCapacityDesc         *prometheus.Desc // under System Status=ss
+	suppliedHeatDesc              *prometheus.Desc // total values as Gauge because values will go down during defrost
+	suppliedHeatCntrDesc          *prometheus.Desc // total values as Counter without lower values than previous val.
+	energyInputDesc               *prometheus.Desc // total values / counter
+	latestErrorDesc               *prometheus.Desc
+	switchOffDesc                 *prometheus.Desc
+	nodeTimeDesc                  *prometheus.Desc
+	impulsesDesc                  *prometheus.Desc
+	defrostDesc                   *prometheus.Desc
+	counterResetsDesc             *prometheus.Desc
+	copInstantaneousDesc          *prometheus.Desc
+	copCumulativeDesc             *prometheus.Desc
+	copSeasonalDesc               *prometheus.Desc
+	estimatedHeatPowerDesc        *prometheus.Desc
+	estimatedHeatDesc             *prometheus.Desc
+	compressorRunDesc             *prometheus.Desc
+	compressorPauseDesc           *prometheus.Desc
+	compressorStartsPerHourDesc   *prometheus.Desc
+	compressorShortCyclingDesc    *prometheus.Desc
+	compressorMissedStartsDesc    *prometheus.Desc
+	defrostEventsDesc             *prometheus.Desc
+	defrostDurationDesc           *prometheus.Desc
+	defrostIntervalDesc           *prometheus.Desc
+	defrostOutdoorTemperatureDesc *prometheus.Desc
+	journalEventsDesc             *prometheus.Desc
+	scrapeDurationDesc            *prometheus.Desc
+	collectorSuccessDesc          *prometheus.Desc
+	quirkActiveDesc               *prometheus.Desc
+	parseErrors                   *prometheus.CounterVec
+	roundTripDuration             *prometheus.HistogramVec
+	state                         *stateStore
+	counterResetRatio             float64
+	copWindows                    []model.Duration
+	estimateMode                  estimateMode
+	fluid                         fluidParams
+	compressorLimits              compressorLimits
+	journalMaxEntries             int
+	notifier                      *notifier
+	disabledCollectors            map[string]bool
+	modules                       *luxwscollect.Registry
+	quirksDB                      *quirksDB
+	metricNames                   map[*prometheus.Desc]string
+	cache                         scrapeCache
+	lastTrace                     traceStore
+	now                           func() time.Time
 }
 
+// Default fraction of the previous value by which a counter must decrease to
+// be considered reset.
+const defaultCounterResetRatio = 0.5
+
 type collectorOpts struct {
 	maxConcurrent int64
 	timeout       time.Duration
@@ -64,6 +105,40 @@ type collectorOpts struct {
 	loc           *time.Location
 	terms         *luxwslang.Terminology
 	log           *zap.Logger
+	state         *stateStore
+
+	// Decreases of counters by more than this fraction of the previous value
+	// are treated as a reset. Defaults to defaultCounterResetRatio.
+	counterResetRatio float64
+
+	// Windows over which seasonal COP values are computed.
+	copWindows []model.Duration
+
+	// Whether to estimate the heat output from flow rate and temperatures.
+	estimateMode estimateMode
+	fluid        fluidParams
+
+	compressorLimits compressorLimits
+
+	// Maximum number of journal entries to retain.
+	journalMaxEntries int
+
+	// Receives notifications about new errors, switch-offs and operation
+	// mode changes. May be nil.
+	notifier *notifier
+
+	// Names of collectors and modules not to run (see builtinModules).
+	disabledCollectors map[string]bool
+
+	// Collector modules run after the built-in collectors. Their names must
+	// have been verified using checkModules.
+	modules []luxwscollect.Module
+
+	// Quirks of particular controllers. Defaults to the built-in quirks.
+	quirks *quirksDB
+
+	// Source of the controller password. Takes precedence over password.
+	passwordSource *passwordSource
 }
 
 func newCollector(opts collectorOpts) *collector {
@@ -73,60 +148,130 @@ func newCollector(opts collectorOpts) *collector {
 		opts.maxConcurrent = 1
 	}
 
-	return &collector{
-		log:                        opts.log,
-		httpDo:                     cleanhttp.DefaultClient().Do,
-		sem:                        semaphore.NewWeighted(opts.maxConcurrent),
-		timeout:                    opts.timeout,
-		address:                    opts.address,
-		password:                   opts.password,
-		clientOpts:                 clientOpts,
-		httpAddress:                opts.httpAddress,
-		loc:                        opts.loc,
-		terms:                      opts.terms,
-		upDesc:                     prometheus.NewDesc("luxws_up", "Whether scrape was successful", []string{"status"}, nil),
-		temperatureDesc:            prometheus.NewDesc("luxws_temperature", "Sensor temperature", []string{"name", "unit"}, nil),
-		operatingDurationDesc:      prometheus.NewDesc("luxws_operating_duration_seconds", "Operating time", []string{"name"}, nil),
-		elapsedDurationDesc:        prometheus.NewDesc("luxws_elapsed_duration_seconds", "Elapsed time", []string{"name"}, nil),
-		inputDesc:                  prometheus.NewDesc("luxws_input", "Input values", []string{"name", "unit"}, nil),
-		outputDesc:                 prometheus.NewDesc("luxws_output", "Output values", []string{"name", "unit"}, nil),
-		infoDesc:                   prometheus.NewDesc("luxws_info", "Controller information", []string{"swversion", "hptype"}, nil),
-		opModeDesc:                 prometheus.NewDesc("luxws_operational_mode", "Operational mode", []string{"mode"}, nil),
-		opModeIDDesc:               prometheus.NewDesc("luxws_operational_mode_id", "Operational mode by ID", []string{"mode"}, nil),
-		ssPowerConsumptionDesc:     prometheus.NewDesc("luxws_ss_energy_input", "System Status / Power Consumption", []string{"unit"}, nil),
-		ssHeatingCapacityDesc:      prometheus.NewDesc("luxws_ss_heat_capacity", "System Status / Heating Capacity", []string{"unit"}, nil),
-		energyInputDesc:            prometheus.NewDesc("luxws_energy_input", "Energy Input / Power Consumption / Energy Monitor", []string{"name", "unit"}, nil),      // counter
-		suppliedHeatDesc:           prometheus.NewDesc("luxws_supplied_heat", "Supplied heat / Heat Quantity / Energy Monitor", []string{"name", "unit"}, nil),        // counter
-		suppliedHeatCntrDesc:       prometheus.NewDesc("luxws_supplied_heat_cntr", "Supplied heat 2 / Heat Quantity / Energy Monitor", []string{"name", "unit"}, nil), // counter
-		latestErrorDesc:            prometheus.NewDesc("luxws_latest_error", "Latest error", []string{"reason"}, nil),
-		switchOffDesc:              prometheus.NewDesc("luxws_latest_switchoff", "Latest switch-off", []string{"reason"}, nil),
-		nodeTimeDesc:               prometheus.NewDesc("luxws_node_time_seconds", "System time in seconds since epoch (1970)", nil, nil),
-		impulsesDesc:               prometheus.NewDesc("luxws_impulses", "Impulses via operating hours", []string{"name", "unit"}, nil),
-		defrostDesc:                prometheus.NewDesc("luxws_defrost", "Defrost demand in %% and last defrost time", []string{"name", "unit"}, nil), // yes two %% because of fmt.Sp....
-		nonDecreasingCounterValues: map[string]float64{},
+	if opts.counterResetRatio <= 0 {
+		opts.counterResetRatio = defaultCounterResetRatio
+	}
+
+	if opts.state == nil {
+		// Keep state in memory only
+		opts.state, _ = newStateStore("")
+	}
+
+	if opts.passwordSource == nil {
+		opts.passwordSource = &passwordSource{value: opts.password}
 	}
+
+	if opts.quirks == nil {
+		opts.quirks, _ = loadQuirksDB("")
+	}
+
+	metricNames := map[*prometheus.Desc]string{}
+
+	// Metric names are kept for recording the outcome of items.
+	newDesc := func(name, help string, labels []string, constLabels prometheus.Labels) *prometheus.Desc {
+		desc := prometheus.NewDesc(name, help, labels, constLabels)
+		metricNames[desc] = name
+
+		return desc
+	}
+
+	c := &collector{
+		log:                           opts.log,
+		httpDo:                        cleanhttp.DefaultClient().Do,
+		sem:                           semaphore.NewWeighted(opts.maxConcurrent),
+		timeout:                       opts.timeout,
+		address:                       opts.address,
+		password:                      opts.passwordSource,
+		clientOpts:                    clientOpts,
+		httpAddress:                   opts.httpAddress,
+		loc:                           opts.loc,
+		terms:                         opts.terms,
+		upDesc:                        newDesc("luxws_up", "Whether scrape was successful", []string{"reason"}, nil),
+		temperatureDesc:               newDesc("luxws_temperature", "Sensor temperature", []string{"name", "unit"}, nil),
+		operatingDurationDesc:         newDesc("luxws_operating_duration_seconds", "Operating time", []string{"name"}, nil),
+		elapsedDurationDesc:           newDesc("luxws_elapsed_duration_seconds", "Elapsed time", []string{"name"}, nil),
+		inputDesc:                     newDesc("luxws_input", "Input values", []string{"name", "unit"}, nil),
+		outputDesc:                    newDesc("luxws_output", "Output values", []string{"name", "unit"}, nil),
+		infoDesc:                      newDesc("luxws_info", "Controller information", []string{"swversion", "hptype"}, nil),
+		opModeDesc:                    newDesc("luxws_operational_mode", "Operational mode", []string{"mode"}, nil),
+		opModeIDDesc:                  newDesc("luxws_operational_mode_id", "Operational mode by ID", []string{"mode"}, nil),
+		ssPowerConsumptionDesc:        newDesc("luxws_ss_energy_input", "System Status / Power Consumption", []string{"unit"}, nil),
+		ssHeatingCapacityDesc:         newDesc("luxws_ss_heat_capacity", "System Status / Heating Capacity", []string{"unit"}, nil),
+		energyInputDesc:               newDesc("luxws_energy_input", "Energy Input / Power Consumption / Energy Monitor", []string{"name", "unit"}, nil),      // counter
+		suppliedHeatDesc:              newDesc("luxws_supplied_heat", "Supplied heat / Heat Quantity / Energy Monitor", []string{"name", "unit"}, nil),        // counter
+		suppliedHeatCntrDesc:          newDesc("luxws_supplied_heat_cntr", "Supplied heat 2 / Heat Quantity / Energy Monitor", []string{"name", "unit"}, nil), // counter
+		latestErrorDesc:               newDesc("luxws_latest_error", "Latest error", []string{"reason"}, nil),
+		switchOffDesc:                 newDesc("luxws_latest_switchoff", "Latest switch-off", []string{"reason"}, nil),
+		nodeTimeDesc:                  newDesc("luxws_node_time_seconds", "System time in seconds since epoch (1970)", nil, nil),
+		impulsesDesc:                  newDesc("luxws_impulses", "Impulses via operating hours", []string{"name", "unit"}, nil),
+		defrostDesc:                   newDesc("luxws_defrost", "Defrost demand in %% and last defrost time", []string{"name", "unit"}, nil), // yes two %% because of fmt.Sp....
+		counterResetsDesc:             newDesc("luxws_counter_resets_total", "Number of detected counter resets", []string{"group", "name"}, nil),
+		state:                         opts.state,
+		copInstantaneousDesc:          newDesc("luxws_cop_instantaneous", "Coefficient of performance from current heating capacity and power consumption", nil, nil),
+		copCumulativeDesc:             newDesc("luxws_cop_cumulative", "Coefficient of performance from energy monitor totals", []string{"name"}, nil),
+		copSeasonalDesc:               newDesc("luxws_cop_seasonal", "Seasonal coefficient of performance (JAZ) from energy monitor over a time window", []string{"name", "window"}, nil),
+		estimatedHeatPowerDesc:        newDesc("luxws_estimated_heat_power", "Estimated heat output from flow rate and flow/return temperatures", []string{"unit"}, nil),
+		estimatedHeatDesc:             newDesc("luxws_estimated_supplied_heat_total", "Estimated supplied heat integrated from the estimated heat output", []string{"unit"}, nil),
+		compressorRunDesc:             newDesc("luxws_compressor_run_duration_seconds", "Duration of compressor runs", nil, nil),
+		compressorPauseDesc:           newDesc("luxws_compressor_pause_duration_seconds", "Duration of pauses between compressor runs", nil, nil),
+		compressorStartsPerHourDesc:   newDesc("luxws_compressor_starts_per_hour", "Compressor starts within the last hour", nil, nil),
+		compressorShortCyclingDesc:    newDesc("luxws_compressor_short_cycling", "Whether the compressor is short cycling", nil, nil),
+		compressorMissedStartsDesc:    newDesc("luxws_compressor_missed_starts_total", "Compressor starts of runs shorter than the interval between scrapes", nil, nil),
+		defrostEventsDesc:             newDesc("luxws_defrost_events_total", "Number of observed defrosts", nil, nil),
+		defrostDurationDesc:           newDesc("luxws_defrost_duration_seconds", "Duration of defrosts observed via the operation mode", nil, nil),
+		defrostIntervalDesc:           newDesc("luxws_defrost_interval_seconds", "Time between two defrosts", nil, nil),
+		defrostOutdoorTemperatureDesc: newDesc("luxws_defrost_outdoor_temperature_celsius", "Outdoor temperature at the time of defrosts", nil, nil),
+		journalEventsDesc:             newDesc("luxws_journal_events_total", "Number of error memory and switch-off entries seen", []string{"kind", "reason", "code"}, nil),
+		scrapeDurationDesc:            newDesc("luxws_scrape_duration_seconds", "Duration of the phases of a scrape via LuxWS", []string{"phase"}, nil),
+		collectorSuccessDesc:          newDesc("luxws_collector_success", "Whether a collector succeeded", []string{"collector"}, nil),
+		quirkActiveDesc:               newDesc("luxws_quirk_active", "Whether an entry of the quirks database applies to the controller", []string{"quirk"}, nil),
+		parseErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "luxws_parse_errors_total",
+			Help: "Number of values which couldn't be parsed",
+		}, []string{"group", "name"}),
+		roundTripDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "luxws_roundtrip_duration_seconds",
+			Help:    "Latency of LuxWS requests",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"command"}),
+		counterResetRatio:  opts.counterResetRatio,
+		copWindows:         opts.copWindows,
+		estimateMode:       opts.estimateMode,
+		fluid:              opts.fluid,
+		compressorLimits:   opts.compressorLimits,
+		journalMaxEntries:  opts.journalMaxEntries,
+		notifier:           opts.notifier,
+		disabledCollectors: opts.disabledCollectors,
+		quirksDB:           opts.quirks,
+		metricNames:        metricNames,
+		now:                time.Now,
+	}
+
+	c.clientOpts = append(c.clientOpts, luxwsclient.WithRoundTripFunc(c.observeRoundTrip))
+
+	modules, err := newModuleRegistry(c, opts.modules)
+	if err != nil {
+		panic(err)
+	}
+
+	c.modules = modules
+
+	return c
 }
 
 func (c *collector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- c.upDesc
-	ch <- c.infoDesc
-	ch <- c.temperatureDesc
-	ch <- c.operatingDurationDesc
-	ch <- c.elapsedDurationDesc
-	ch <- c.inputDesc
-	ch <- c.outputDesc
-	ch <- c.opModeDesc
-	ch <- c.opModeIDDesc
-	ch <- c.ssPowerConsumptionDesc
-	ch <- c.ssHeatingCapacityDesc
-	ch <- c.energyInputDesc
-	ch <- c.suppliedHeatDesc
-	ch <- c.suppliedHeatCntrDesc
-	ch <- c.latestErrorDesc
-	ch <- c.switchOffDesc
 	ch <- c.nodeTimeDesc
-	ch <- c.impulsesDesc
-	ch <- c.defrostDesc
+	ch <- c.counterResetsDesc
+	ch <- c.scrapeDurationDesc
+	ch <- c.collectorSuccessDesc
+	ch <- c.quirkActiveDesc
+	c.parseErrors.Describe(ch)
+	c.roundTripDuration.Describe(ch)
+
+	for _, m := range c.enabledModules() {
+		m.Describe(ch)
+	}
 }
 
 func (c *collector) parseValue(text string) (float64, string, error) {
@@ -144,9 +289,9 @@ func (c *collector) parseValue(text string) (float64, string, error) {
 }
 
 func (c *collector) collectInfo(
+	env *luxwscollect.Env,
 	ch chan<- prometheus.Metric,
 	content *luxwsclient.ContentRoot,
-	q *quirks,
 ) error {
 	var swVersion, opMode, heatOutputUnit, heatCapUnit, defrostDemandUnit string
 	var powerConsumptionValue, heatCapacityValue, defrostDemandValue float64
@@ -159,40 +304,50 @@ func (c *collector) collectInfo(
 	}
 
 	group.EachNonNil(func(item *luxwsclient.ContentItem) {
+		// Descriptors of the metrics to which the item contributes
+		var descs []*prometheus.Desc
+
 		switch item.Name {
 		case c.terms.StatusType:
-			name := normalizeSpace(*item.Value)
-
-			if strings.EqualFold(name, "L2A") {
-				q.missingSuppliedHeat = true
-			}
-
-			hpType = append(hpType, name)
+			hpType = append(hpType, normalizeSpace(*item.Value))
+			descs = append(descs, c.infoDesc)
 		case c.terms.StatusSoftwareVersion:
 			swVersion = normalizeSpace(*item.Value)
+			descs = append(descs, c.infoDesc)
 		case c.terms.StatusOperationMode:
 			opMode = normalizeSpace(*item.Value)
 			if opMode == "" {
 				opMode = "off"
 			}
+			descs = append(descs, c.opModeDesc, c.opModeIDDesc)
 		case c.terms.StatusHeatingCapacity:
 			if heatCapacityValue, heatCapUnit, err = c.parseValue(*item.Value); err != nil {
-				c.log.Error("StatusHeatingCapacity parseValue failed", zap.Error(err), zap.Stringp("value", item.Value))
+				c.parseError(env, c.terms.NavSystemStatus, item, err)
+			} else {
+				descs = append(descs, c.ssHeatingCapacityDesc)
 			}
 		case c.terms.StatusPowerConsumption:
 			if powerConsumptionValue, heatOutputUnit, err = c.parseValue(*item.Value); err != nil {
-				c.log.Error("StatusPowerConsumption parseValue failed", zap.Error(err), zap.Stringp("value", item.Value))
+				c.parseError(env, c.terms.NavSystemStatus, item, err)
+			} else {
+				descs = append(descs, c.ssPowerConsumptionDesc)
 			}
 		case c.terms.StatusDefrostDemand:
 			if defrostDemandValue, defrostDemandUnit, err = c.parseValue(*item.Value); err != nil {
-				c.log.Error("StatusDefrostDemand parseValue failed", zap.Error(err), zap.Stringp("value", item.Value))
+				c.parseError(env, c.terms.NavSystemStatus, item, err)
+			} else {
+				descs = append(descs, c.defrostDesc)
 			}
 		case c.terms.StatusLastDefrost:
 			if lastDefrost, err = c.terms.ParseTimestampShort(*item.Value, c.loc); err != nil {
-				c.log.Error("StatusLastDefrost parseValue failed", zap.Error(err), zap.Stringp("value", item.Value))
+				c.parseError(env, c.terms.NavSystemStatus, item, err)
+			} else {
+				descs = append(descs, c.defrostDesc)
 			}
 
 		}
+
+		c.recordItem(env, c.terms.NavSystemStatus, item.Name, descs...)
 	})
 
 	sort.Strings(hpType)
@@ -220,6 +375,7 @@ type collectOptions struct {
 }
 
 func (c *collector) collectMeasurements(
+	env *luxwscollect.Env,
 	ch chan<- prometheus.Metric,
 	desc *prometheus.Desc,
 	content *luxwsclient.ContentRoot,
@@ -246,10 +402,12 @@ func (c *collector) collectMeasurements(
 
 		value, unit, err := c.parseValue(*item.Value)
 		if err != nil {
-			c.log.Error("parseValue failed", zap.Error(err), zap.Stringp("value", item.Value))
+			c.parseError(env, groupName, item, err)
 			return
 		}
 
+		c.recordItem(env, groupName, item.Name, desc)
+
 		counterMapKey := fmt.Sprintf("%s_%s_%s", groupName, item.Name, vt.ToDTO().String())
 
 		switch vt {
@@ -257,13 +415,22 @@ func (c *collector) collectMeasurements(
 			ch <- prometheus.MustNewConstMetric(desc, vt, value, normalizeSpace(item.Name), unit)
 
 		case prometheus.CounterValue:
-			if prevVal := c.nonDecreasingCounterValues[counterMapKey]; prevVal <= value {
-				ch <- prometheus.MustNewConstMetric(desc, vt, value, normalizeSpace(item.Name), unit)
-				c.nonDecreasingCounterValues[counterMapKey] = value
-			} else if c.log != nil {
-				// skip decreasing counter value
-				c.log.Warn("skipping decreasing counter value",
-					zap.Float64("value_prev", prevVal),
+			reported, update := c.state.updateCounter(counterMapKey, groupName, normalizeSpace(item.Name), value, c.counterResetRatio)
+
+			ch <- prometheus.MustNewConstMetric(desc, vt, reported, normalizeSpace(item.Name), unit)
+
+			if c.log == nil {
+				break
+			}
+
+			switch update {
+			case counterHeld:
+				c.log.Warn("holding previous value of decreasing counter",
+					zap.Float64("value_prev", reported),
+					zap.Float64("value_new", value),
+					zap.String("map_key", counterMapKey))
+			case counterReset:
+				c.log.Warn("counter reset detected",
 					zap.Float64("value_new", value),
 					zap.String("map_key", counterMapKey))
 			}
@@ -280,6 +447,7 @@ func (c *collector) collectMeasurements(
 }
 
 func (c *collector) collectDurations(
+	env *luxwscollect.Env,
 	ch chan<- prometheus.Metric,
 	desc *prometheus.Desc,
 	content *luxwsclient.ContentRoot,
@@ -300,9 +468,12 @@ func (c *collector) collectDurations(
 
 		duration, err := c.terms.ParseDuration(*item.Value)
 		if err != nil {
+			c.parseError(env, groupName, item, err)
 			return err
 		}
 
+		c.recordItem(env, groupName, item.Name, desc)
+
 		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue,
 			duration.Seconds(), normalizeSpace(item.Name))
 
@@ -317,31 +488,23 @@ func (c *collector) collectDurations(
 	return nil
 }
 
-func (c *collector) collectTimetable(ch chan<- prometheus.Metric, desc *prometheus.Desc, content *luxwsclient.ContentRoot, groupName string) error {
+func (c *collector) collectTimetable(env *luxwscollect.Env, ch chan<- prometheus.Metric, desc *prometheus.Desc, content *luxwsclient.ContentRoot, groupName string) error {
 	group, err := content.FindByName(luxwsclient.CmpName(groupName))
 	if err != nil {
 		return fmt.Errorf("collectTimetable.content.FindByName %q failed: %w", groupName, err)
 	}
 
-	latest := map[string]time.Time{}
-
-	for _, item := range group.Items {
-		tsRaw := normalizeSpace(item.Name)
-
-		if item.Value == nil || strings.Trim(tsRaw, "-") == "" {
-			continue
-		}
-
-		ts, err := c.terms.ParseTimestamp(tsRaw, c.loc)
-		if err != nil {
-			return err
-		}
+	entries, err := c.timetableEntries(env, group, desc)
+	if err != nil {
+		return err
+	}
 
-		reason := normalizeSpace(*item.Value)
+	latest := map[string]time.Time{}
 
+	for _, e := range entries {
 		// Use only the most recent timestamp per reason
-		if prev := latest[reason]; prev.IsZero() || prev.Before(ts) {
-			latest[reason] = ts
+		if prev := latest[e.Reason]; prev.IsZero() || prev.Before(e.Time) {
+			latest[e.Reason] = e.Time
 		}
 	}
 
@@ -356,104 +519,186 @@ func (c *collector) collectTimetable(ch chan<- prometheus.Metric, desc *promethe
 	return nil
 }
 
-func (c *collector) collectTemperatures(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, _ *quirks) error {
-	return c.collectMeasurements(ch, c.temperatureDesc, content, c.terms.NavTemperatures, prometheus.GaugeValue, collectOptions{})
+func (c *collector) collectTemperatures(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	return c.collectMeasurements(env, ch, c.temperatureDesc, content, c.terms.NavTemperatures, prometheus.GaugeValue, collectOptions{})
 }
 
-func (c *collector) collectOperatingDuration(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, _ *quirks) error {
-	return c.collectDurations(ch, c.operatingDurationDesc, content, c.terms.NavOpHours, c.terms.HoursImpulsesFn)
+func (c *collector) collectOperatingDuration(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	return c.collectDurations(env, ch, c.operatingDurationDesc, content, c.terms.NavOpHours, c.terms.HoursImpulsesFn)
 }
 
-func (c *collector) collectElapsedTime(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, _ *quirks) error {
-	return c.collectDurations(ch, c.elapsedDurationDesc, content, c.terms.NavElapsedTimes, nil)
+func (c *collector) collectElapsedTime(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	return c.collectDurations(env, ch, c.elapsedDurationDesc, content, c.terms.NavElapsedTimes, nil)
 }
 
-func (c *collector) collectInputs(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, _ *quirks) error {
-	return c.collectMeasurements(ch, c.inputDesc, content, c.terms.NavInputs, prometheus.GaugeValue, collectOptions{})
+func (c *collector) collectInputs(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	return c.collectMeasurements(env, ch, c.inputDesc, content, c.terms.NavInputs, prometheus.GaugeValue, collectOptions{})
 }
 
-func (c *collector) collectOutputs(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, _ *quirks) error {
-	return c.collectMeasurements(ch, c.outputDesc, content, c.terms.NavOutputs, prometheus.GaugeValue, collectOptions{})
+func (c *collector) collectOutputs(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	return c.collectMeasurements(env, ch, c.outputDesc, content, c.terms.NavOutputs, prometheus.GaugeValue, collectOptions{})
 }
 
-func (c *collector) collectImpulses(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, _ *quirks) error {
-	return c.collectMeasurements(ch, c.impulsesDesc, content, c.terms.NavOpHours, prometheus.CounterValue, collectOptions{optionalIsAllowed: c.terms.HoursImpulsesFn})
+func (c *collector) collectImpulses(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	return c.collectMeasurements(env, ch, c.impulsesDesc, content, c.terms.NavOpHours, prometheus.CounterValue, collectOptions{optionalIsAllowed: c.terms.HoursImpulsesFn})
 }
 
-func (c *collector) collectSuppliedHeat(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, q *quirks) error {
-	if q.missingSuppliedHeat {
+func (c *collector) collectSuppliedHeat(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	if env.Quirks.MissingSuppliedHeat {
 		return nil
 	}
 
 	return errors.Join(
-		c.collectMeasurements(ch, c.suppliedHeatDesc, content, c.terms.NavHeatQuantity, prometheus.GaugeValue, collectOptions{}),
-		c.collectMeasurements(ch, c.suppliedHeatCntrDesc, content, c.terms.NavHeatQuantity, prometheus.CounterValue, collectOptions{}),
+		c.collectMeasurements(env, ch, c.suppliedHeatDesc, content, c.terms.NavHeatQuantity, prometheus.GaugeValue, collectOptions{}),
+		c.collectMeasurements(env, ch, c.suppliedHeatCntrDesc, content, c.terms.NavHeatQuantity, prometheus.CounterValue, collectOptions{}),
 	)
 }
 
-func (c *collector) collectEnergyInput(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, _ *quirks) error {
-	return c.collectMeasurements(ch, c.energyInputDesc, content, c.terms.NavEnergyInput, prometheus.CounterValue, collectOptions{
+func (c *collector) collectEnergyInput(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	return c.collectMeasurements(env, ch, c.energyInputDesc, content, c.terms.NavEnergyInput, prometheus.CounterValue, collectOptions{
 		ItemCompareFn: func(groupName string) luxwsclient.CompareFn {
 			return luxwsclient.CmpNameAndItems(groupName)
 		},
 	})
 }
 
-func (c *collector) collectLatestError(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, _ *quirks) error {
-	return c.collectTimetable(ch, c.latestErrorDesc, content, c.terms.NavErrorMemory)
+func (c *collector) collectLatestError(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	return c.collectTimetable(env, ch, c.latestErrorDesc, content, c.terms.NavErrorMemory)
 }
 
-func (c *collector) collectLatestSwitchOff(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, _ *quirks) error {
-	return c.collectTimetable(ch, c.switchOffDesc, content, c.terms.NavSwitchOffs)
+func (c *collector) collectLatestSwitchOff(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	return c.collectTimetable(env, ch, c.switchOffDesc, content, c.terms.NavSwitchOffs)
 }
 
-func (c *collector) collectAll(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+// collectAll runs the enabled collector modules, starting with the built-in
+// ones. Quirks are detected and applied to the information page first. How
+// items were used is recorded in outcomes if not nil.
+func (c *collector) collectAll(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot, pages map[string]fetchedPage, outcomes *luxwscollect.Outcomes) error {
 	var err error
-	var q quirks
-
-	for _, fn := range []contentCollectFunc{
-		c.collectInfo,
-		c.collectTemperatures,
-		c.collectOperatingDuration,
-		c.collectElapsedTime,
-		c.collectInputs,
-		c.collectOutputs,
-		c.collectSuppliedHeat,
-		c.collectEnergyInput,
-		c.collectLatestError,
-		c.collectLatestSwitchOff,
-		c.collectImpulses,
-	} {
-		multierr.AppendInto(&err, fn(ch, content, &q))
+
+	content, q, missing := c.detectQuirks(ch, content)
+
+	env := &luxwscollect.Env{
+		Terms:    c.terms,
+		Location: c.loc,
+		Quirks:   &q,
+		Log:      c.log,
+		Outcomes: outcomes,
+	}
+
+	for _, m := range c.enabledModules() {
+		required := moduleRequired(m)
+
+		if missing[m.Name()] && !required {
+			continue
+		}
+
+		mPages, mErr := c.modulePages(m, content, pages)
+		if mErr == nil {
+			mErr = m.Collect(env, ch, mPages)
+		}
+
+		success := 1.0
+
+		if mErr != nil {
+			success = 0
+
+			if required {
+				multierr.AppendInto(&err, mErr)
+			} else if c.log != nil {
+				c.log.Warn("Collector failed", zap.String("collector", m.Name()), zap.Error(mErr))
+			}
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.collectorSuccessDesc, prometheus.GaugeValue, success, m.Name())
 	}
 
 	return err
 }
 
-func (c *collector) collectWebSocket(ctx context.Context, ch chan<- prometheus.Metric) error {
-	cl, err := luxwsclient.Dial(ctx, c.address, c.clientOpts...)
+// fetchInformation retrieves the navigation and the information page from
+// the controller. The result is cached for the API. The duration of each
+// phase is recorded if phases is not nil. If outcomes is not nil the fetch is
+// part of a collection: the caller fills outcomes while collecting and the
+// messages are kept as the trace of the last scrape. If fetch is not nil it's
+// invoked before the connection is closed to retrieve further pages.
+func (c *collector) fetchInformation(ctx context.Context, phases *scrapePhases, outcomes *luxwscollect.Outcomes, fetch func(*luxwsclient.Client, *luxwsclient.NavRoot, *luxwsclient.ContentRoot)) (nav *luxwsclient.NavRoot, content *luxwsclient.ContentRoot, err error) {
+	var opts []luxwsclient.Option
+
+	if outcomes != nil {
+		trace := newScrapeTrace(c.now, outcomes)
+
+		defer func() {
+			c.lastTrace.store(trace, c.now(), content, err)
+		}()
+
+		opts = append(opts, luxwsclient.WithMessageFunc(trace.record))
+	}
+
+	phases.start()
+
+	cl, err := c.dial(ctx, opts...)
 	if err != nil {
-		return err
+		return nil, nil, err
 	}
 
 	defer cl.Close()
 
-	nav, err := cl.Login(ctx, c.password)
-	if err != nil {
-		return err
+	phases.done("dial")
+
+	if nav, err = cl.Login(ctx, c.password.get()); err != nil {
+		return nil, nil, err
 	}
 
+	phases.done("login")
+
 	info := nav.FindByName(c.terms.NavInformation)
 	if info == nil {
-		return errors.New("information ID not found in response")
+		return nil, nil, fmt.Errorf("information page %q: %w", c.terms.NavInformation, luxwsclient.ErrNavItemNotFound)
+	}
+
+	content, err = cl.Get(ctx, info.ID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("fetching ID %q failed: %w", info.ID, err)
 	}
 
-	content, err := cl.Get(ctx, info.ID)
+	if fetch != nil {
+		fetch(cl, nav, content)
+	}
+
+	phases.done("get")
+
+	c.cache.store(c.now(), nav, content, outcomes)
+
+	return nav, content, nil
+}
+
+func (c *collector) collectWebSocket(ctx context.Context, ch chan<- prometheus.Metric) error {
+	var phases scrapePhases
+
+	var pages map[string]fetchedPage
+
+	outcomes := luxwscollect.NewOutcomes()
+
+	_, content, err := c.fetchInformation(ctx, &phases, outcomes, func(cl *luxwsclient.Client, nav *luxwsclient.NavRoot, _ *luxwsclient.ContentRoot) {
+		pages = c.fetchModulePages(ctx, cl, nav)
+	})
 	if err != nil {
-		return fmt.Errorf("fetching ID %q failed: %w", info.ID, err)
+		return err
 	}
 
-	return c.collectAll(ch, content)
+	for key, p := range pages {
+		if p.err == nil {
+			c.cache.storePage(c.now(), key, p.content)
+		}
+	}
+
+	err = c.collectAll(ch, content, pages, outcomes)
+
+	phases.done("parse")
+	phases.collect(ch, c.scrapeDurationDesc)
+
+	return err
 }
 
 func (c *collector) collectHTTP(ctx context.Context, ch chan<- prometheus.Metric) error {
@@ -507,7 +752,7 @@ func (c *collector) collect(ctx context.Context, ch chan<- prometheus.Metric) er
 	if c.httpAddress != "" {
 		g.Go(func() error {
 			if err := c.collectHTTP(ctx, ch); err != nil {
-				return fmt.Errorf("collection via HTTP protocol failed: %w", err)
+				return fmt.Errorf("%w: %w", errHTTPCollection, err)
 			}
 
 			return nil
@@ -517,6 +762,12 @@ func (c *collector) collect(ctx context.Context, ch chan<- prometheus.Metric) er
 	return g.Wait()
 }
 
+func (c *collector) collectCounterResets(ch chan<- prometheus.Metric) {
+	c.state.eachCounterResets(func(r counterResets) {
+		ch <- prometheus.MustNewConstMetric(c.counterResetsDesc, prometheus.CounterValue, r.Count, r.Group, r.Name)
+	})
+}
+
 func (c *collector) Collect(ch chan<- prometheus.Metric) {
 	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
 	defer cancel()
@@ -525,6 +776,15 @@ func (c *collector) Collect(ch chan<- prometheus.Metric) {
 		ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, 1, "")
 	} else {
 		c.log.Error("Scrape failed", zap.Error(err))
-		ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, 0, err.Error())
+		c.cache.storeError(c.now(), err)
+		ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, 0, errorReason(err))
+	}
+
+	c.collectCounterResets(ch)
+	c.parseErrors.Collect(ch)
+	c.roundTripDuration.Collect(ch)
+
+	if err := c.state.save(); err != nil {
+		c.log.Error("Saving state failed", zap.Error(err))
 	}
 }
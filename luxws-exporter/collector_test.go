@@ -3,12 +3,14 @@ package main
 import (
 	"context"
 	"encoding/xml"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"slices"
 	"strings"
 	"testing"
 	"time"
@@ -16,9 +18,11 @@ import (
 	"github.com/google/go-cmp/cmp"
 	"github.com/google/go-cmp/cmp/cmpopts"
 	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
 	"github.com/hansmi/wp2reg-luxws/luxwslang"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 	"go.uber.org/zap"
 )
 
@@ -63,6 +67,11 @@ func (a *adapter) collectAndCompare(t *testing.T, want string, wantErr error) {
 	}
 }
 
+// testEnv returns a collection environment with the given quirks.
+func testEnv(q quirks) *luxwscollect.Env {
+	return &luxwscollect.Env{Quirks: &q}
+}
+
 func TestCollectWebSocketParts(t *testing.T) {
 	c := newCollector(collectorOpts{
 		terms: luxwslang.German,
@@ -70,13 +79,11 @@ func TestCollectWebSocketParts(t *testing.T) {
 	})
 
 	for _, tc := range []struct {
-		name       string
-		fn         contentCollectFunc
-		input      *luxwsclient.ContentRoot
-		quirks     quirks
-		want       string
-		wantErr    error
-		wantQuirks quirks
+		name    string
+		fn      contentCollectFunc
+		input   *luxwsclient.ContentRoot
+		want    string
+		wantErr error
 	}{
 		{
 			name: "info empty",
@@ -120,7 +127,7 @@ luxws_ss_heat_capacity{unit=""} 0
 							{Name: "Wärmepumpen Typ", Value: luxwsclient.String("typeA")},
 							{Name: "Softwarestand", Value: luxwsclient.String("v1.2.3")},
 							{Name: "Betriebszustand", Value: luxwsclient.String("running")},
-							{Name: "Leistung Ist", Value: luxwsclient.String("999 kWh")},
+							{Name: "Eingesetzte Energie", Value: luxwsclient.String("999 kWh")},
 							{Name: "Wärmepumpen Typ", Value: luxwsclient.String("typeB")},
 						},
 					},
@@ -183,9 +190,6 @@ luxws_ss_energy_input{unit=""} 0
 # TYPE luxws_ss_heat_capacity gauge
 luxws_ss_heat_capacity{unit=""} 0
 `,
-			wantQuirks: quirks{
-				missingSuppliedHeat: true,
-			},
 		},
 		{
 			name: "temperatures empty",
@@ -541,18 +545,75 @@ luxws_latest_switchoff{reason="bbb"} 1585954800
 			a := &adapter{
 				c: c,
 				collect: func(ch chan<- prometheus.Metric) error {
-					return tc.fn(ch, tc.input, &tc.quirks)
+					return tc.fn(testEnv(quirks{}), ch, tc.input)
 				},
 			}
 			a.collectAndCompare(t, tc.want, tc.wantErr)
-
-			if diff := cmp.Diff(tc.wantQuirks, tc.quirks, cmp.AllowUnexported(quirks{})); diff != "" {
-				t.Errorf("%s failed: Quirks diff (-want +got):\n%s", tc.name, diff)
-			}
 		})
 	}
 }
 
+// collectorSuccessMetrics returns the luxws_collector_success metrics reported
+// by collectAll with the given collectors failing.
+func collectorSuccessMetrics(failed ...string) string {
+	return collectorSuccessMetricsSkipping(nil, failed...)
+}
+
+// collectorSuccessMetricsSkipping is like collectorSuccessMetrics with some
+// collectors not running at all.
+func collectorSuccessMetricsSkipping(skipped []string, failed ...string) string {
+	var sb strings.Builder
+
+	sb.WriteString(`
+# HELP luxws_collector_success Whether a collector succeeded
+# TYPE luxws_collector_success gauge
+`)
+
+	for _, name := range []string{
+		"compressor", "cop", "defrost", "elapsed_time", "energy_input",
+		"estimated_heat", "impulses", "info", "inputs", "journal",
+		"latest_error", "latest_switchoff", "operating_duration",
+		"opmode_change", "outputs", "supplied_heat", "temperatures",
+	} {
+		if slices.Contains(skipped, name) {
+			continue
+		}
+
+		value := 1
+
+		if slices.Contains(failed, name) {
+			value = 0
+		}
+
+		fmt.Fprintf(&sb, "luxws_collector_success{collector=%q} %d\n", name, value)
+	}
+
+	return sb.String()
+}
+
+// quirkActiveMetrics returns the luxws_quirk_active metrics for the built-in
+// quirks with the given quirks being active.
+func quirkActiveMetrics(active ...string) string {
+	var sb strings.Builder
+
+	sb.WriteString(`
+# HELP luxws_quirk_active Whether an entry of the quirks database applies to the controller
+# TYPE luxws_quirk_active gauge
+`)
+
+	for _, name := range []string{"l2a_missing_supplied_heat"} {
+		value := 0
+
+		if slices.Contains(active, name) {
+			value = 1
+		}
+
+		fmt.Fprintf(&sb, "luxws_quirk_active{quirk=%q} %d\n", name, value)
+	}
+
+	return sb.String()
+}
+
 func TestCollectAll(t *testing.T) {
 	for _, tc := range []struct {
 		name    string
@@ -561,9 +622,10 @@ func TestCollectAll(t *testing.T) {
 		wantErr error
 	}{
 		{
-			name:    "empty",
-			input:   &luxwsclient.ContentRoot{},
-			want:    "",
+			name:  "empty",
+			input: &luxwsclient.ContentRoot{},
+			want: collectorSuccessMetrics("elapsed_time", "energy_input", "impulses", "info", "inputs",
+				"latest_error", "latest_switchoff", "operating_duration", "outputs", "supplied_heat", "temperatures") + quirkActiveMetrics(),
 			wantErr: cmpopts.AnyError,
 		},
 		{
@@ -636,7 +698,7 @@ luxws_supplied_heat_cntr{name="",unit=""} 0
 # HELP luxws_temperature Sensor temperature
 # TYPE luxws_temperature gauge
 luxws_temperature{name="",unit=""} 0
-`,
+` + emptyDefrostMetrics + collectorSuccessMetrics() + quirkActiveMetrics(),
 		},
 		{
 			// Heat pump controllers of type L2A don't report the amount of
@@ -712,7 +774,7 @@ luxws_ss_heat_capacity{unit=""} 0
 # HELP luxws_temperature Sensor temperature
 # TYPE luxws_temperature gauge
 luxws_temperature{name="",unit=""} 0
-`,
+` + emptyDefrostMetrics + collectorSuccessMetricsSkipping([]string{"supplied_heat"}) + quirkActiveMetrics("l2a_missing_supplied_heat"),
 		},
 		{
 			// Heat pump controllers of type L2A don't report the amount of
@@ -733,7 +795,14 @@ luxws_temperature{name="",unit=""} 0
 				}
 				return &cr
 			}(t),
-			want: `# HELP luxws_defrost Defrost demand in %% and last defrost time
+			// Only a subset of the XML is provided; the failing optional
+			// collectors are reported via luxws_collector_success.
+			want: `# HELP luxws_cop_cumulative Coefficient of performance from energy monitor totals
+# TYPE luxws_cop_cumulative gauge
+luxws_cop_cumulative{name="domestic hot water"} 9.089082125603866
+luxws_cop_cumulative{name="heating"} 14.142477375565612
+luxws_cop_cumulative{name="total"} 12.998249835922119
+# HELP luxws_defrost Defrost demand in %% and last defrost time
 # TYPE luxws_defrost gauge
 luxws_defrost{name="demand",unit="pct"} 0
 luxws_defrost{name="last",unit="ts"} 1.71804228e+09
@@ -767,8 +836,7 @@ luxws_supplied_heat{name="total",unit="kWh"} 29707.5
 luxws_supplied_heat_cntr{name="domestic hot water",unit="kWh"} 4703.6
 luxws_supplied_heat_cntr{name="heating",unit="kWh"} 25003.9
 luxws_supplied_heat_cntr{name="total",unit="kWh"} 29707.5
-`,
-			wantErr: luxwsclient.ErrContentItemNotFound, // because only subset of the XML in the test provided
+` + emptyDefrostMetrics + collectorSuccessMetrics("elapsed_time", "impulses", "inputs", "latest_error", "latest_switchoff", "operating_duration", "outputs", "temperatures") + quirkActiveMetrics(),
 		},
 		{
 			name: "Real Decode Content EN All data",
@@ -785,7 +853,55 @@ luxws_supplied_heat_cntr{name="total",unit="kWh"} 29707.5
 				}
 				return &cr
 			}(t),
-			want: `# HELP luxws_defrost Defrost demand in %% and last defrost time
+			want: `# HELP luxws_compressor_missed_starts_total Compressor starts of runs shorter than the interval between scrapes
+# TYPE luxws_compressor_missed_starts_total counter
+luxws_compressor_missed_starts_total 0
+# HELP luxws_compressor_pause_duration_seconds Duration of pauses between compressor runs
+# TYPE luxws_compressor_pause_duration_seconds histogram
+luxws_compressor_pause_duration_seconds_bucket{le="60"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="180"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="300"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="600"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="900"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="1200"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="1800"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="2700"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="3600"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="7200"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="14400"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="28800"} 0
+luxws_compressor_pause_duration_seconds_bucket{le="+Inf"} 0
+luxws_compressor_pause_duration_seconds_sum 0
+luxws_compressor_pause_duration_seconds_count 0
+# HELP luxws_compressor_run_duration_seconds Duration of compressor runs
+# TYPE luxws_compressor_run_duration_seconds histogram
+luxws_compressor_run_duration_seconds_bucket{le="60"} 0
+luxws_compressor_run_duration_seconds_bucket{le="180"} 0
+luxws_compressor_run_duration_seconds_bucket{le="300"} 0
+luxws_compressor_run_duration_seconds_bucket{le="600"} 0
+luxws_compressor_run_duration_seconds_bucket{le="900"} 0
+luxws_compressor_run_duration_seconds_bucket{le="1200"} 0
+luxws_compressor_run_duration_seconds_bucket{le="1800"} 0
+luxws_compressor_run_duration_seconds_bucket{le="2700"} 0
+luxws_compressor_run_duration_seconds_bucket{le="3600"} 0
+luxws_compressor_run_duration_seconds_bucket{le="7200"} 0
+luxws_compressor_run_duration_seconds_bucket{le="14400"} 0
+luxws_compressor_run_duration_seconds_bucket{le="28800"} 0
+luxws_compressor_run_duration_seconds_bucket{le="+Inf"} 0
+luxws_compressor_run_duration_seconds_sum 0
+luxws_compressor_run_duration_seconds_count 0
+# HELP luxws_compressor_short_cycling Whether the compressor is short cycling
+# TYPE luxws_compressor_short_cycling gauge
+luxws_compressor_short_cycling 0
+# HELP luxws_cop_cumulative Coefficient of performance from energy monitor totals
+# TYPE luxws_cop_cumulative gauge
+luxws_cop_cumulative{name="domestic hot water"} 8.37648237848672
+luxws_cop_cumulative{name="heating"} 12.504982320797172
+luxws_cop_cumulative{name="total"} 11.614716899582191
+# HELP luxws_cop_instantaneous Coefficient of performance from current heating capacity and power consumption
+# TYPE luxws_cop_instantaneous gauge
+luxws_cop_instantaneous 4.857142857142857
+# HELP luxws_defrost Defrost demand in %% and last defrost time
 # TYPE luxws_defrost gauge
 luxws_defrost{name="demand",unit="pct"} 36.4
 luxws_defrost{name="last",unit="ts"} 1.73340612e+09
@@ -828,6 +944,10 @@ luxws_input{name="SWT",unit="bool"} 0
 luxws_input{name="analog in 21",unit="V"} 0.01
 luxws_input{name="analog in 22",unit="V"} 0.01
 luxws_input{name="flow rate",unit="l/h"} 612
+# HELP luxws_journal_events_total Number of error memory and switch-off entries seen
+# TYPE luxws_journal_events_total counter
+luxws_journal_events_total{code="",kind="switchoff",reason="no requ."} 5
+luxws_journal_events_total{code="718",kind="error",reason="max. outdoor temp."} 5
 # HELP luxws_latest_error Latest error
 # TYPE luxws_latest_error gauge
 luxws_latest_error{reason="max. outdoor temp. (718)"} 1.725203567e+09
@@ -908,7 +1028,7 @@ luxws_temperature{name="return",unit="degC"} 27.2
 luxws_temperature{name="return target",unit="degC"} 26.7
 luxws_temperature{name="suction compressor",unit="degC"} 6.3
 luxws_temperature{name="target overheating",unit="K"} 8
-`,
+` + emptyDefrostMetrics + collectorSuccessMetrics() + quirkActiveMetrics(),
 		},
 	} {
 		t.Run(tc.name, func(t *testing.T) {
@@ -920,7 +1040,7 @@ luxws_temperature{name="target overheating",unit="K"} 8
 			a := &adapter{
 				c: c,
 				collect: func(ch chan<- prometheus.Metric) error {
-					return c.collectAll(ch, tc.input)
+					return c.collectAll(ch, tc.input, nil, nil)
 				},
 			}
 			a.collectAndCompare(t, tc.want, tc.wantErr)
@@ -928,6 +1048,87 @@ luxws_temperature{name="target overheating",unit="K"} 8
 	}
 }
 
+func TestCollectCounterReset(t *testing.T) {
+	// Uses the default reset ratio
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+	})
+
+	content := func(value string) *luxwsclient.ContentRoot {
+		return &luxwsclient.ContentRoot{
+			Items: luxwsclient.ContentItems{
+				{
+					Name: "Heat Quantity",
+					Items: luxwsclient.ContentItems{
+						{Name: "total", Value: luxwsclient.String(value)},
+					},
+				},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name:  "initial",
+			input: "1000 kWh",
+			want: `
+# HELP luxws_supplied_heat_cntr Supplied heat 2 / Heat Quantity / Energy Monitor
+# TYPE luxws_supplied_heat_cntr counter
+luxws_supplied_heat_cntr{name="total",unit="kWh"} 1000
+`,
+		},
+		{
+			name:  "defrost dip",
+			input: "999.5 kWh",
+			want: `
+# HELP luxws_supplied_heat_cntr Supplied heat 2 / Heat Quantity / Energy Monitor
+# TYPE luxws_supplied_heat_cntr counter
+luxws_supplied_heat_cntr{name="total",unit="kWh"} 1000
+`,
+		},
+		{
+			name:  "reset",
+			input: "1.5 kWh",
+			want: `
+# HELP luxws_supplied_heat_cntr Supplied heat 2 / Heat Quantity / Energy Monitor
+# TYPE luxws_supplied_heat_cntr counter
+luxws_supplied_heat_cntr{name="total",unit="kWh"} 1.5
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			a := &adapter{
+				c:           c,
+				metricNames: []string{"luxws_supplied_heat_cntr"},
+				collect: func(ch chan<- prometheus.Metric) error {
+					return c.collectSuppliedHeat(testEnv(quirks{}), ch, content(tc.input))
+				},
+			}
+			a.collectAndCompare(t, tc.want, nil)
+		})
+	}
+
+	want := `
+# HELP luxws_counter_resets_total Number of detected counter resets
+# TYPE luxws_counter_resets_total counter
+luxws_counter_resets_total{group="Heat Quantity",name="total"} 1
+`
+
+	a := &adapter{
+		c: c,
+		collect: func(ch chan<- prometheus.Metric) error {
+			c.collectCounterResets(ch)
+			return nil
+		},
+	}
+	a.collectAndCompare(t, want, nil)
+}
+
 func TestCollectHTTP(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	t.Cleanup(cancel)
@@ -986,7 +1187,7 @@ func TestCollect(t *testing.T) {
 	want := `
 # HELP luxws_up Whether scrape was successful
 # TYPE luxws_up gauge
-luxws_up{status="collection via LuxWS protocol failed: websocket: bad handshake"} 0
+luxws_up{reason="dial"} 0
 `
 
 	discardAllLogs(t)
@@ -1003,3 +1204,111 @@ luxws_up{status="collection via LuxWS protocol failed: websocket: bad handshake"
 	}
 	a.collectAndCompare(t, want, nil)
 }
+
+func TestCollectAllDisabled(t *testing.T) {
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+		disabledCollectors: map[string]bool{
+			"info":         true, // required, ignored
+			"energy_input": true,
+			"temperatures": true,
+		},
+	})
+
+	input := &luxwsclient.ContentRoot{
+		Items: luxwsclient.ContentItems{
+			{Name: "system status"},
+		},
+	}
+
+	var names []string
+
+	ch := make(chan prometheus.Metric)
+
+	go func() {
+		defer close(ch)
+
+		if err := c.collectAll(ch, input, nil, nil); err != nil {
+			t.Errorf("collectAll() failed: %v", err)
+		}
+	}()
+
+	for m := range ch {
+		if m.Desc() != c.collectorSuccessDesc {
+			continue
+		}
+
+		var pb dto.Metric
+
+		if err := m.Write(&pb); err != nil {
+			t.Fatal(err)
+		}
+
+		names = append(names, pb.GetLabel()[0].GetValue())
+	}
+
+	for _, name := range names {
+		if name == "energy_input" || name == "temperatures" {
+			t.Errorf("Disabled collector %q ran", name)
+		}
+	}
+
+	if !slices.Contains(names, "info") {
+		t.Errorf("Required collector didn't run: %q", names)
+	}
+}
+
+func TestCollectAllOutcomes(t *testing.T) {
+	xmlData, err := os.ReadFile("../luxwsclient/testdata/content_en.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := luxwsclient.NewContentRoot(xmlData, "content")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := newCollector(collectorOpts{
+		terms:        luxwslang.English,
+		loc:          time.UTC,
+		estimateMode: estimateAlways,
+	})
+
+	outcomes := luxwscollect.NewOutcomes()
+
+	ch := make(chan prometheus.Metric)
+
+	go func() {
+		defer close(ch)
+
+		if err := c.collectAll(ch, content, nil, outcomes); err != nil {
+			t.Errorf("collectAll() failed: %v", err)
+		}
+	}()
+
+	for range ch {
+	}
+
+	for _, tc := range []struct {
+		group, item string
+		want        []string
+	}{
+		{"temperatures", "flow", []string{"luxws_temperature", "luxws_estimated_heat_power", "luxws_estimated_supplied_heat_total"}},
+		{"temperatures", "outdoor temp.", []string{"luxws_temperature", "luxws_defrost_outdoor_temperature_celsius"}},
+		{"inputs", "flow rate", []string{"luxws_input", "luxws_estimated_heat_power", "luxws_estimated_supplied_heat_total"}},
+		{"outputs", "VD1", []string{"luxws_output", "luxws_compressor_run_duration_seconds", "luxws_compressor_pause_duration_seconds", "luxws_compressor_short_cycling"}},
+		{"elapsed times", "HP since", []string{"luxws_elapsed_duration_seconds", "luxws_compressor_run_duration_seconds", "luxws_compressor_pause_duration_seconds"}},
+	} {
+		got, ok := outcomes.Lookup(tc.group, tc.item)
+		if !ok {
+			t.Errorf("No outcome for %q / %q", tc.group, tc.item)
+			continue
+		}
+
+		if diff := cmp.Diff(tc.want, got.Metrics); diff != "" {
+			t.Errorf("Metrics of %q / %q diff (-want +got):\n%s", tc.group, tc.item, diff)
+		}
+	}
+}
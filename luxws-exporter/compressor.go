@@ -0,0 +1,290 @@
+package main
+
+import (
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// The duration of a compressor cycle is unknown if two samples are further
+// apart than this duration.
+const compressorMaxGap = 15 * time.Minute
+
+// Window for computing the number of compressor starts per hour.
+const compressorStartsWindow = time.Hour
+
+// Upper bounds in seconds for compressor run and pause durations.
+var compressorDurationBuckets = []float64{
+	60, 180, 300, 600, 900, 1200, 1800, 2700, 3600, 7200, 14400, 28800,
+}
+
+// compressorLimits configures when the compressor is considered to be short
+// cycling.
+type compressorLimits struct {
+	minRunTime       time.Duration
+	maxStartsPerHour float64
+}
+
+type impulseSample struct {
+	Time  int64   `json:"time"`
+	Count float64 `json:"count"`
+}
+
+// compressorState tracks the compressor between scrapes.
+type compressorState struct {
+	Running  bool  `json:"running"`
+	LastSeen int64 `json:"last_seen"`
+
+	// Time of the most recent observed state change or zero if unknown.
+	Since int64 `json:"since,omitempty"`
+
+	// Time at which the most recent run shorter than the minimum run time
+	// ended or zero if none was seen.
+	LastShortRun int64 `json:"last_short_run,omitempty"`
+
+	// Number of starts not observed as a change of the compressor state,
+	// i.e. of runs shorter than the interval between scrapes.
+	MissedStarts float64 `json:"missed_starts,omitempty"`
+
+	Run    histogramState  `json:"run"`
+	Pause  histogramState  `json:"pause"`
+	Starts []impulseSample `json:"starts,omitempty"`
+}
+
+// compressorSample is the compressor state reported by the controller.
+type compressorSample struct {
+	running bool
+
+	// Value of the start counter, if available.
+	starts *float64
+
+	// Duration of the current run ("HP since"), if available.
+	runningFor *time.Duration
+}
+
+type compressorStats struct {
+	run           histogramState
+	pause         histogramState
+	lastShortRun  time.Time
+	missedStarts  float64
+	startsPerHour float64
+	startsKnown   bool
+}
+
+// updateCompressor records the current compressor state. Runs shorter than
+// minRunTime are remembered as short runs.
+func (s *stateStore) updateCompressor(now time.Time, sample compressorSample, minRunTime time.Duration) compressorStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nowMs := now.UnixMilli()
+
+	// Start of the current run according to the controller
+	var runStart int64
+
+	if sample.running && sample.runningFor != nil {
+		runStart = nowMs - sample.runningFor.Milliseconds()
+	}
+
+	st := s.data.Compressor
+
+	// LastSeen alone changes on every scrape and doesn't mark the state as
+	// modified. It's persisted together with the next actual change.
+	switch {
+	case st == nil:
+		st = &compressorState{Running: sample.running, Since: runStart}
+		s.data.Compressor = st
+		s.dirty = true
+
+	case nowMs < st.LastSeen:
+		// Out-of-order scrape, e.g. from concurrent collections
+
+	case nowMs-st.LastSeen > compressorMaxGap.Milliseconds():
+		if st.Running != sample.running || st.Since != runStart {
+			st.Running = sample.running
+			st.Since = runStart
+			s.dirty = true
+		}
+
+	case st.Running != sample.running:
+		since := nowMs
+
+		if runStart > st.LastSeen {
+			since = runStart
+		}
+
+		if st.Since != 0 {
+			duration := time.Duration(since-st.Since) * time.Millisecond
+
+			if st.Running {
+				st.Run.observe(compressorDurationBuckets, duration.Seconds())
+
+				if duration < minRunTime {
+					st.LastShortRun = nowMs
+				}
+			} else {
+				st.Pause.observe(compressorDurationBuckets, duration.Seconds())
+			}
+		}
+
+		st.Running = sample.running
+		st.Since = since
+		s.dirty = true
+
+	case st.Running && runStart > st.LastSeen && runStart != st.Since:
+		// The compressor stopped and started again between scrapes. The
+		// end of the previous run is unknown.
+		st.Since = runStart
+		s.dirty = true
+	}
+
+	result := compressorStats{}
+
+	if sample.starts != nil {
+		cutoff := now.Add(-compressorStartsWindow).UnixMilli()
+		starts := *sample.starts
+
+		if n := len(st.Starts); n > 0 && starts < st.Starts[n-1].Count {
+			// Counter reset
+			st.Starts = nil
+			s.dirty = true
+		}
+
+		if n := len(st.Starts); n > 0 && nowMs > st.LastSeen && nowMs-st.LastSeen <= compressorMaxGap.Milliseconds() {
+			// Every start apart from the one of a currently running
+			// compressor belongs to a run which both started and ended
+			// between the scrapes.
+			missed := starts - st.Starts[n-1].Count
+
+			if sample.running {
+				missed--
+			}
+
+			if missed > 0 {
+				st.MissedStarts += missed
+				s.dirty = true
+
+				if time.Duration(nowMs-st.LastSeen)*time.Millisecond <= minRunTime {
+					st.LastShortRun = nowMs
+				}
+			}
+		}
+
+		// Samples are only stored when the counter changes. The first
+		// sample is the newest one at or before the cutoff and its count
+		// is the value at the start of the window.
+		for len(st.Starts) > 1 && st.Starts[1].Time <= cutoff {
+			st.Starts = st.Starts[1:]
+			s.dirty = true
+		}
+
+		if len(st.Starts) > 0 {
+			base := st.Starts[0]
+
+			if elapsed := time.Duration(nowMs-base.Time) * time.Millisecond; elapsed >= compressorStartsWindow/4 {
+				result.startsPerHour = (starts - base.Count) / min(elapsed, compressorStartsWindow).Hours()
+				result.startsKnown = true
+			}
+		}
+
+		if n := len(st.Starts); n == 0 || (st.Starts[n-1].Time < nowMs && st.Starts[n-1].Count != starts) {
+			st.Starts = append(st.Starts, impulseSample{Time: nowMs, Count: starts})
+			s.dirty = true
+		}
+	}
+
+	st.LastSeen = max(st.LastSeen, nowMs)
+
+	if st.LastShortRun != 0 {
+		result.lastShortRun = time.UnixMilli(st.LastShortRun)
+	}
+
+	result.missedStarts = st.MissedStarts
+	result.run = st.Run
+	result.run.Counts = append([]uint64(nil), st.Run.Counts...)
+	result.pause = st.Pause
+	result.pause.Counts = append([]uint64(nil), st.Pause.Counts...)
+
+	return result
+}
+
+func (c *collector) collectCompressor(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	// Missing groups are reported by the collectors for the raw values.
+	outputs, err := c.groupMeasurements(content, luxwsclient.CmpName(c.terms.NavOutputs))
+	if err != nil {
+		return nil
+	}
+
+	compressor, ok := outputs[normalizeSpace(c.terms.OutputCompressor)]
+	if !ok {
+		return nil
+	}
+
+	sample := compressorSample{running: compressor.value != 0}
+
+	var startsItem, runningForItem string
+
+	if opHours, err := c.groupMeasurements(content, luxwsclient.CmpName(c.terms.NavOpHours)); err == nil {
+		if m, ok := opHours[normalizeSpace(c.terms.ImpulsesCompressor)]; ok {
+			sample.starts = &m.value
+			startsItem = m.item
+		}
+	}
+
+	if elapsed, err := content.FindByName(luxwsclient.CmpName(c.terms.NavElapsedTimes)); err == nil {
+		elapsed.EachNonNil(func(item *luxwsclient.ContentItem) {
+			if normalizeSpace(item.Name) != normalizeSpace(c.terms.ElapsedHeatPumpSince) {
+				return
+			}
+
+			if d, err := c.terms.ParseDuration(*item.Value); err == nil {
+				sample.runningFor = &d
+				runningForItem = item.Name
+			}
+		})
+	}
+
+	now := c.now()
+	stats := c.state.updateCompressor(now, sample, c.compressorLimits.minRunTime)
+
+	ch <- stats.run.metric(c.compressorRunDesc, compressorDurationBuckets)
+	ch <- stats.pause.metric(c.compressorPauseDesc, compressorDurationBuckets)
+
+	c.recordItem(env, c.terms.NavOutputs, compressor.item, c.compressorRunDesc, c.compressorPauseDesc, c.compressorShortCyclingDesc)
+
+	if sample.runningFor != nil {
+		c.recordItem(env, c.terms.NavElapsedTimes, runningForItem, c.compressorRunDesc, c.compressorPauseDesc)
+	}
+
+	// A short run is only considered for as long as its start would count
+	// towards the starts per hour.
+	shortCycling := !stats.lastShortRun.IsZero() && now.Sub(stats.lastShortRun) < compressorStartsWindow
+
+	if sample.starts != nil {
+		ch <- prometheus.MustNewConstMetric(c.compressorMissedStartsDesc, prometheus.CounterValue, stats.missedStarts)
+
+		c.recordItem(env, c.terms.NavOpHours, startsItem, c.compressorMissedStartsDesc, c.compressorShortCyclingDesc)
+	}
+
+	if stats.startsKnown {
+		ch <- prometheus.MustNewConstMetric(c.compressorStartsPerHourDesc, prometheus.GaugeValue, stats.startsPerHour)
+
+		c.recordItem(env, c.terms.NavOpHours, startsItem, c.compressorStartsPerHourDesc)
+
+		if c.compressorLimits.maxStartsPerHour > 0 && stats.startsPerHour > c.compressorLimits.maxStartsPerHour {
+			shortCycling = true
+		}
+	}
+
+	var shortCyclingValue float64
+
+	if shortCycling {
+		shortCyclingValue = 1
+	}
+
+	ch <- prometheus.MustNewConstMetric(c.compressorShortCyclingDesc, prometheus.GaugeValue, shortCyclingValue)
+
+	return nil
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestStateStoreUpdateCompressor(t *testing.T) {
+	s, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	starts := func(v float64) *float64 { return &v }
+	duration := func(d time.Duration) *time.Duration { return &d }
+
+	const minRunTime = 8 * time.Minute
+
+	for _, tc := range []struct {
+		offset          time.Duration
+		running         bool
+		starts          *float64
+		runningFor      *time.Duration
+		wantRunCount    uint64
+		wantPauseCount  uint64
+		wantShortRun    time.Duration
+		wantMissed      float64
+		wantStartsPerH  float64
+		wantStartsKnown bool
+	}{
+		{offset: 0, running: false, starts: starts(100)},
+		// First observed start; pause duration is unknown
+		{offset: 5 * time.Minute, running: true, starts: starts(101)},
+		{offset: 10 * time.Minute, running: true, starts: starts(101)},
+		{offset: 15 * time.Minute, running: false, starts: starts(101), wantRunCount: 1, wantStartsPerH: 4, wantStartsKnown: true},
+		{offset: 20 * time.Minute, running: true, starts: starts(102), wantRunCount: 1, wantPauseCount: 1, wantStartsPerH: 6, wantStartsKnown: true},
+		// Gap in observations
+		{offset: 60 * time.Minute, running: false, starts: starts(103), wantRunCount: 1, wantPauseCount: 1, wantStartsPerH: 3, wantStartsKnown: true},
+		// Start time from "HP since"
+		{offset: 65 * time.Minute, running: true, starts: starts(104), runningFor: duration(2 * time.Minute), wantRunCount: 1, wantPauseCount: 1, wantStartsPerH: 3, wantStartsKnown: true},
+		// Stopped and started again between scrapes with one more run in
+		// between
+		{offset: 70 * time.Minute, running: true, starts: starts(106), runningFor: duration(time.Minute), wantRunCount: 1, wantPauseCount: 1, wantShortRun: 70 * time.Minute, wantMissed: 1, wantStartsPerH: 5, wantStartsKnown: true},
+		// Run of six minutes and two missed runs
+		{offset: 75 * time.Minute, running: false, starts: starts(108), wantRunCount: 2, wantPauseCount: 1, wantShortRun: 75 * time.Minute, wantMissed: 3, wantStartsPerH: 7, wantStartsKnown: true},
+	} {
+		got := s.updateCompressor(start.Add(tc.offset), compressorSample{
+			running:    tc.running,
+			starts:     tc.starts,
+			runningFor: tc.runningFor,
+		}, minRunTime)
+
+		if got.run.Count != tc.wantRunCount || got.pause.Count != tc.wantPauseCount {
+			t.Errorf("At %v: got %d runs and %d pauses, want %d and %d", tc.offset, got.run.Count, got.pause.Count, tc.wantRunCount, tc.wantPauseCount)
+		}
+
+		var wantShortRun time.Time
+
+		if tc.wantShortRun != 0 {
+			wantShortRun = start.Add(tc.wantShortRun)
+		}
+
+		if !got.lastShortRun.Equal(wantShortRun) {
+			t.Errorf("At %v: last short run %v, want %v", tc.offset, got.lastShortRun, wantShortRun)
+		}
+
+		if diff := cmp.Diff([]any{tc.wantMissed, tc.wantStartsPerH, tc.wantStartsKnown}, []any{got.missedStarts, got.startsPerHour, got.startsKnown}); diff != "" {
+			t.Errorf("At %v: starts diff (-want +got):\n%s", tc.offset, diff)
+		}
+	}
+
+	if got := s.data.Compressor.Run.Sum; got != (10*time.Minute).Seconds()+(6*time.Minute).Seconds() {
+		t.Errorf("Sum of run durations %v, want 16 minutes", got)
+	}
+}
+
+func TestStateStoreUpdateCompressorDirty(t *testing.T) {
+	s, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	starts := func(v float64) *float64 { return &v }
+
+	for _, tc := range []struct {
+		offset    time.Duration
+		running   bool
+		starts    float64
+		wantDirty bool
+	}{
+		{offset: 0, starts: 100, wantDirty: true},
+		{offset: time.Minute, starts: 100},
+		{offset: 2 * time.Minute, starts: 100},
+		{offset: 3 * time.Minute, running: true, starts: 101, wantDirty: true},
+		{offset: 4 * time.Minute, running: true, starts: 101},
+		{offset: 5 * time.Minute, starts: 101, wantDirty: true},
+	} {
+		s.dirty = false
+
+		s.updateCompressor(start.Add(tc.offset), compressorSample{running: tc.running, starts: starts(tc.starts)}, time.Minute)
+
+		if s.dirty != tc.wantDirty {
+			t.Errorf("At %v: dirty is %t, want %t", tc.offset, s.dirty, tc.wantDirty)
+		}
+	}
+}
+
+func TestCollectCompressorShortCycling(t *testing.T) {
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+		compressorLimits: compressorLimits{
+			minRunTime:       10 * time.Minute,
+			maxStartsPerHour: 3,
+		},
+	})
+
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	content := func(running, starts string) *luxwsclient.ContentRoot {
+		return &luxwsclient.ContentRoot{
+			Items: luxwsclient.ContentItems{
+				{
+					Name: "outputs",
+					Items: luxwsclient.ContentItems{
+						{Name: "VD1", Value: luxwsclient.String(running)},
+					},
+				},
+				{
+					Name: "operating hours",
+					Items: luxwsclient.ContentItems{
+						{Name: "impulse VD1", Value: luxwsclient.String(starts)},
+					},
+				},
+			},
+		}
+	}
+
+	for _, i := range []struct {
+		advance time.Duration
+		running string
+		starts  string
+	}{
+		{0, "Off", "10"},
+		{time.Minute, "On", "11"},
+		{4 * time.Minute, "Off", "11"},
+		{5 * time.Minute, "On", "12"},
+		{5 * time.Minute, "Off", "12"},
+	} {
+		now = now.Add(i.advance)
+
+		ch := make(chan prometheus.Metric, 16)
+
+		if err := c.collectCompressor(testEnv(quirks{}), ch, content(i.running, i.starts)); err != nil {
+			t.Errorf("collectCompressor() failed: %v", err)
+		}
+	}
+
+	a := &adapter{
+		c:           c,
+		metricNames: []string{"luxws_compressor_short_cycling", "luxws_compressor_starts_per_hour"},
+		collect: func(ch chan<- prometheus.Metric) error {
+			return c.collectCompressor(testEnv(quirks{}), ch, content("Off", "12"))
+		},
+	}
+	a.collectAndCompare(t, `
+# HELP luxws_compressor_short_cycling Whether the compressor is short cycling
+# TYPE luxws_compressor_short_cycling gauge
+luxws_compressor_short_cycling 1
+# HELP luxws_compressor_starts_per_hour Compressor starts within the last hour
+# TYPE luxws_compressor_starts_per_hour gauge
+luxws_compressor_starts_per_hour 8
+`, nil)
+
+	// Neither a short run nor too many starts within the last hour
+	now = now.Add(61 * time.Minute)
+
+	a.collectAndCompare(t, `
+# HELP luxws_compressor_short_cycling Whether the compressor is short cycling
+# TYPE luxws_compressor_short_cycling gauge
+luxws_compressor_short_cycling 0
+# HELP luxws_compressor_starts_per_hour Compressor starts within the last hour
+# TYPE luxws_compressor_starts_per_hour gauge
+luxws_compressor_starts_per_hour 0
+`, nil)
+}
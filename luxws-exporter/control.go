@@ -0,0 +1,406 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"go.uber.org/zap"
+)
+
+var (
+	errControlUnauthorized = errors.New("missing or invalid token")
+	errControlNotAllowed   = errors.New("parameter not allowed")
+	errControlInvalid      = luxwsclient.ErrInvalidValue
+)
+
+// parseControlTokens reads API tokens in the format "<user>:<token>", one per
+// line. Empty lines and lines starting with "#" are ignored. The returned map
+// is keyed by token.
+func parseControlTokens(r io.Reader) (map[string]string, error) {
+	result := map[string]string{}
+
+	scanner := bufio.NewScanner(r)
+
+	for lineno := 1; scanner.Scan(); lineno++ {
+		line := strings.TrimSpace(scanner.Text())
+
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, token, ok := strings.Cut(line, ":")
+		if !ok || user == "" || token == "" {
+			return nil, fmt.Errorf("line %d: expected format <user>:<token>", lineno)
+		}
+
+		if _, ok := result[token]; ok {
+			return nil, fmt.Errorf("line %d: duplicate token", lineno)
+		}
+
+		result[token] = user
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(result) == 0 {
+		return nil, errors.New("no tokens configured")
+	}
+
+	return result, nil
+}
+
+type controlOpts struct {
+	log *zap.Logger
+
+	// Paths of parameters which may be changed, e.g.
+	// "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll".
+	params []string
+
+	// Users keyed by token.
+	tokens map[string]string
+
+	// Receives one JSON object per change attempt. May be nil.
+	audit io.Writer
+
+	// Validate changes without applying them.
+	dryRun bool
+}
+
+// controlParam is a parameter which may be changed.
+type controlParam struct {
+	path []string
+
+	// Canonical ID derived from the path. Unlike the item IDs sent by the
+	// controller it doesn't change between connections.
+	id string
+}
+
+// controlParamID returns the canonical ID of a parameter, e.g.
+// "einstellungen_warmwasser_temperaturen_warmwasser_soll".
+func controlParamID(path []string) string {
+	return mqttSlug(strings.Join(path, "_"))
+}
+
+// controlAPI changes whitelisted parameters on the controller.
+type controlAPI struct {
+	c      *collector
+	log    *zap.Logger
+	params []controlParam
+	tokens map[string]string
+	dryRun bool
+
+	auditMu sync.Mutex
+	audit   io.Writer
+}
+
+func newControlAPI(c *collector, opts controlOpts) (*controlAPI, error) {
+	a := &controlAPI{
+		c:      c,
+		log:    opts.log,
+		tokens: opts.tokens,
+		dryRun: opts.dryRun,
+		audit:  opts.audit,
+	}
+
+	seen := map[string]string{}
+
+	for _, p := range opts.params {
+		path := luxwsclient.SplitPath(p)
+		if len(path) == 0 {
+			continue
+		}
+
+		id := controlParamID(path)
+
+		if other, ok := seen[id]; ok {
+			return nil, fmt.Errorf("parameters %q and %q have the same ID %q", other, p, id)
+		}
+
+		seen[id] = p
+
+		a.params = append(a.params, controlParam{path: path, id: id})
+	}
+
+	return a, nil
+}
+
+type controlRequest struct {
+	Path   string          `json:"path"`
+	ID     string          `json:"id"`
+	Value  json.RawMessage `json:"value"`
+	DryRun bool            `json:"dry_run"`
+}
+
+// controlResult describes a change attempt. It's returned to the client and
+// written to the audit log.
+type controlResult struct {
+	Time     time.Time `json:"time"`
+	User     string    `json:"user"`
+	Remote   string    `json:"remote,omitempty"`
+	Path     string    `json:"path,omitempty"`
+	ID       string    `json:"id,omitempty"`
+	Previous string    `json:"previous,omitempty"`
+	Value    string    `json:"value"`
+	Raw      string    `json:"raw,omitempty"`
+	DryRun   bool      `json:"dry_run"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// authenticate returns the user owning the bearer token of a request.
+func (a *controlAPI) authenticate(r *http.Request) (string, error) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		return "", errControlUnauthorized
+	}
+
+	var user string
+
+	for candidate, name := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(candidate)) == 1 {
+			user = name
+		}
+	}
+
+	if user == "" {
+		return "", errControlUnauthorized
+	}
+
+	return user, nil
+}
+
+// param returns the allowed parameter addressed by a request. If both a path
+// and an ID are given they must refer to the same parameter.
+func (a *controlAPI) param(req controlRequest) (*controlParam, error) {
+	if req.Path == "" && req.ID == "" {
+		return nil, fmt.Errorf("%w: path or ID required", errControlInvalid)
+	}
+
+	path := strings.Join(luxwsclient.SplitPath(req.Path), "/")
+
+	var result *controlParam
+
+	for idx, p := range a.params {
+		if (req.Path != "" && strings.Join(p.path, "/") == path) || (req.ID != "" && p.id == req.ID) {
+			if result != nil {
+				return nil, fmt.Errorf("%w: path and ID refer to different parameters", errControlInvalid)
+			}
+
+			result = &a.params[idx]
+		}
+	}
+
+	if result == nil {
+		return nil, errControlNotAllowed
+	}
+
+	if (req.Path != "" && strings.Join(result.path, "/") != path) || (req.ID != "" && result.id != req.ID) {
+		return nil, errControlNotAllowed
+	}
+
+	return result, nil
+}
+
+// findItem retrieves the page containing a parameter and returns the
+// parameter. The page remains the current page of the connection as required
+// by the "SET" command.
+func (a *controlAPI) findItem(ctx context.Context, cl *luxwsclient.Client, nav *luxwsclient.NavRoot, path []string) (*luxwsclient.ContentItem, error) {
+	page, rest := nav.FindPath(path)
+	if page == nil || len(rest) == 0 {
+		return nil, errAPINotFound
+	}
+
+	content, err := cl.Get(ctx, page.ID)
+	if err != nil {
+		return nil, fmt.Errorf("fetching ID %q failed: %w", page.ID, err)
+	}
+
+	items, _, ok := content.Items.FindPath(rest[:len(rest)-1])
+	if !ok {
+		return nil, errAPINotFound
+	}
+
+	for _, item := range items {
+		if item.Name == rest[len(rest)-1] && item.Value != nil {
+			return item, nil
+		}
+	}
+
+	return nil, errAPINotFound
+}
+
+// apply validates and, unless in dry-run mode, applies a change. The result
+// is filled in as far as the change progressed.
+func (a *controlAPI) apply(ctx context.Context, req controlRequest, result *controlResult) error {
+	param, err := a.param(req)
+	if err != nil {
+		return err
+	}
+
+	result.Path = strings.Join(param.path, "/")
+	result.ID = param.id
+
+	if err := a.c.sem.Acquire(ctx, 1); err != nil {
+		return err
+	}
+
+	defer a.c.sem.Release(1)
+
+	cl, nav, err := a.c.login(ctx)
+	if err != nil {
+		return err
+	}
+
+	defer cl.Close()
+
+	item, err := a.findItem(ctx, cl, nav, param.path)
+	if err != nil {
+		return err
+	}
+
+	if item.Value != nil {
+		result.Previous = *item.Value
+	}
+
+	if result.Raw, err = item.RawValue(result.Value); err != nil {
+		return err
+	}
+
+	if result.DryRun {
+		return nil
+	}
+
+	if err := cl.Set(ctx, item.ID, result.Raw); err != nil {
+		return fmt.Errorf("setting ID %q failed: %w", item.ID, err)
+	}
+
+	if _, err := cl.Save(ctx); err != nil {
+		return fmt.Errorf("saving failed: %w", err)
+	}
+
+	return nil
+}
+
+func (a *controlAPI) writeAudit(result controlResult) {
+	if a.log != nil {
+		a.log.Info("Parameter change",
+			zap.String("user", result.User),
+			zap.String("remote", result.Remote),
+			zap.String("path", result.Path),
+			zap.String("id", result.ID),
+			zap.String("previous", result.Previous),
+			zap.String("value", result.Value),
+			zap.Bool("dry_run", result.DryRun),
+			zap.String("error", result.Error))
+	}
+
+	if a.audit == nil {
+		return
+	}
+
+	buf, err := json.Marshal(result)
+	if err != nil {
+		return
+	}
+
+	a.auditMu.Lock()
+	defer a.auditMu.Unlock()
+
+	if _, err := a.audit.Write(append(buf, '\n')); err != nil && a.log != nil {
+		a.log.Error("Writing audit log failed", zap.Error(err))
+	}
+}
+
+func (a *controlAPI) handleSet(w http.ResponseWriter, r *http.Request) {
+	user, err := a.authenticate(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAPIError(w, err)
+		return
+	}
+
+	var req controlRequest
+
+	if err := json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&req); err != nil {
+		writeAPIError(w, fmt.Errorf("%w: decoding request: %v", errControlInvalid, err))
+		return
+	}
+
+	result := controlResult{
+		Time:   a.c.now(),
+		User:   user,
+		Remote: r.RemoteAddr,
+		Path:   req.Path,
+		ID:     req.ID,
+		DryRun: a.dryRun || req.DryRun,
+	}
+
+	// Accept both strings and numbers
+	if err := json.Unmarshal(req.Value, &result.Value); err != nil {
+		result.Value = string(req.Value)
+	}
+
+	ctx, cancel := a.c.apiContext(r)
+	defer cancel()
+
+	if result.Value == "" {
+		err = fmt.Errorf("%w: value required", errControlInvalid)
+	} else {
+		err = a.apply(ctx, req, &result)
+	}
+
+	if err != nil {
+		result.Error = err.Error()
+	}
+
+	a.writeAudit(result)
+
+	if err != nil {
+		writeAPIError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+type controlParamInfo struct {
+	Path string `json:"path"`
+	ID   string `json:"id"`
+}
+
+// handleList returns the allowed parameters with their canonical IDs.
+func (a *controlAPI) handleList(w http.ResponseWriter, r *http.Request) {
+	if _, err := a.authenticate(r); err != nil {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeAPIError(w, err)
+		return
+	}
+
+	result := []controlParamInfo{}
+
+	for _, p := range a.params {
+		result = append(result, controlParamInfo{
+			Path: strings.Join(p.path, "/"),
+			ID:   p.id,
+		})
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
+
+// register adds the control API handlers to a mux.
+func (a *controlAPI) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /api/v1/control", a.handleList)
+	mux.HandleFunc("POST /api/v1/control", a.handleSet)
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/websocket"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+)
+
+func TestParseControlTokens(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "empty", wantErr: true},
+		{
+			name:  "tokens",
+			input: "# comment\nalice:secret1\n\n bob:secret2 \n",
+			want:  map[string]string{"secret1": "alice", "secret2": "bob"},
+		},
+		{name: "missing token", input: "alice:\n", wantErr: true},
+		{name: "duplicate", input: "alice:x\nbob:x\n", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseControlTokens(strings.NewReader(tc.input))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("parseControlTokens() error %v, want error %v", err, tc.wantErr)
+			}
+
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("Tokens diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+// newFakeController starts a LuxWS server responding to LOGIN with nav and to
+// GET with the content from pages keyed by ID. SET commands are recorded.
+func newFakeController(t *testing.T, nav string, pages map[string]string) (string, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var changes []string
+
+	var upgrader websocket.Upgrader
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			response := "<unknown></unknown>"
+
+			cmd := string(msg)
+
+			switch {
+			case strings.HasPrefix(cmd, "LOGIN;"):
+				response = nav
+			case strings.HasPrefix(cmd, "GET;"):
+				if content, ok := pages[strings.TrimPrefix(cmd, "GET;")]; ok {
+					response = content
+				}
+			case strings.HasPrefix(cmd, "SET;"):
+				mu.Lock()
+				changes = append(changes, cmd)
+				mu.Unlock()
+				continue
+			case cmd == "SAVE;1":
+				response = `<Content></Content>`
+			}
+
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(response)); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return serverURL.Host, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), changes...)
+	}
+}
+
+// newFakeSettingsController starts a LuxWS server with a single settings page.
+func newFakeSettingsController(t *testing.T) (string, func() []string) {
+	return newFakeController(t,
+		`<Navigation id="0x1"><item id="0x2"><name>Einstellungen</name>`+
+			`<item id="0x3"><name>Warmwasser</name></item></item></Navigation>`,
+		map[string]string{
+			"0x3": `<Content><item id="0x10"><name>Temperaturen</name>` +
+				`<item id="0x11"><name>Warmwasser-Soll</name><min>300</min><max>650</max><step>5</step>` +
+				`<div>10.00</div><raw>480</raw><value>48.0°C</value></item>` +
+				`<item id="0x12"><name>Hysterese</name><min>10</min><max>300</max><step>5</step>` +
+				`<div>10.00</div><raw>20</raw><value>2.0 K</value></item></item></Content>`,
+		})
+}
+
+func TestControlAPI(t *testing.T) {
+	address, changes := newFakeSettingsController(t)
+
+	c := newCollector(collectorOpts{
+		address: address,
+		terms:   luxwslang.German,
+		loc:     time.UTC,
+		timeout: time.Minute,
+	})
+
+	now := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	var audit bytes.Buffer
+
+	mux := http.NewServeMux()
+
+	a, err := newControlAPI(c, controlOpts{
+		params: []string{
+			"Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll",
+			"Einstellungen/Warmwasser/Temperaturen/Nicht vorhanden",
+		},
+		tokens: map[string]string{"secret": "alice"},
+		audit:  &audit,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.register(mux)
+
+	for _, tc := range []struct {
+		name       string
+		token      string
+		body       string
+		wantStatus int
+		wantAudit  bool
+	}{
+		{
+			name:       "no token",
+			body:       `{"path": "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll", "value": 50}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "wrong token",
+			token:      "wrong",
+			body:       `{"path": "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll", "value": 50}`,
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "not allowed",
+			token:      "secret",
+			body:       `{"path": "Einstellungen/Warmwasser/Temperaturen/Hysterese", "value": 3}`,
+			wantStatus: http.StatusForbidden,
+			wantAudit:  true,
+		},
+		{
+			name:       "out of range",
+			token:      "secret",
+			body:       `{"path": "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll", "value": 70}`,
+			wantStatus: http.StatusBadRequest,
+			wantAudit:  true,
+		},
+		{
+			name:       "dry run",
+			token:      "secret",
+			body:       `{"path": "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll", "value": 50, "dry_run": true}`,
+			wantStatus: http.StatusOK,
+			wantAudit:  true,
+		},
+		{
+			name:       "by path",
+			token:      "secret",
+			body:       `{"path": "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll", "value": 52.5}`,
+			wantStatus: http.StatusOK,
+			wantAudit:  true,
+		},
+		{
+			name:       "by ID",
+			token:      "secret",
+			body:       `{"id": "einstellungen_warmwasser_temperaturen_warmwasser_soll", "value": "51"}`,
+			wantStatus: http.StatusOK,
+			wantAudit:  true,
+		},
+		{
+			name:       "controller ID",
+			token:      "secret",
+			body:       `{"id": "0x11", "value": "51"}`,
+			wantStatus: http.StatusForbidden,
+			wantAudit:  true,
+		},
+		{
+			name:       "unknown ID",
+			token:      "secret",
+			body:       `{"id": "einstellungen_warmwasser_temperaturen_hysterese", "value": "3"}`,
+			wantStatus: http.StatusForbidden,
+			wantAudit:  true,
+		},
+		{
+			name:       "path and ID differ",
+			token:      "secret",
+			body:       `{"path": "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll", "id": "einstellungen_warmwasser_temperaturen_nicht_vorhanden", "value": "51"}`,
+			wantStatus: http.StatusBadRequest,
+			wantAudit:  true,
+		},
+		{
+			name:       "missing on controller",
+			token:      "secret",
+			body:       `{"id": "einstellungen_warmwasser_temperaturen_nicht_vorhanden", "value": "51"}`,
+			wantStatus: http.StatusNotFound,
+			wantAudit:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			audit.Reset()
+
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/control", strings.NewReader(tc.body))
+
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+
+			rec := httptest.NewRecorder()
+			mux.ServeHTTP(rec, req)
+
+			if rec.Code != tc.wantStatus {
+				t.Errorf("Status %d, want %d: %s", rec.Code, tc.wantStatus, rec.Body.String())
+			}
+
+			if got := audit.Len() > 0; got != tc.wantAudit {
+				t.Errorf("Audit log written %v, want %v", got, tc.wantAudit)
+			}
+		})
+	}
+
+	if diff := cmp.Diff([]string{
+		"SET;set_0x11;525",
+		"SET;set_0x11;510",
+	}, changes()); diff != "" {
+		t.Errorf("Changes diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestControlAPIAuditEntry(t *testing.T) {
+	address, _ := newFakeSettingsController(t)
+
+	c := newCollector(collectorOpts{
+		address: address,
+		terms:   luxwslang.German,
+		loc:     time.UTC,
+		timeout: time.Minute,
+	})
+
+	now := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	var audit bytes.Buffer
+
+	mux := http.NewServeMux()
+
+	a, err := newControlAPI(c, controlOpts{
+		params: []string{"Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll"},
+		tokens: map[string]string{"secret": "alice"},
+		audit:  &audit,
+		dryRun: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	a.register(mux)
+
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/control",
+		strings.NewReader(`{"path": "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll", "value": 50}`))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.RemoteAddr = "192.0.2.1:1234"
+
+	mux.ServeHTTP(httptest.NewRecorder(), req)
+
+	var got controlResult
+
+	if err := json.Unmarshal(audit.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(controlResult{
+		Time:     now,
+		User:     "alice",
+		Remote:   "192.0.2.1:1234",
+		Path:     "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll",
+		ID:       "einstellungen_warmwasser_temperaturen_warmwasser_soll",
+		Previous: "48.0°C",
+		Value:    "50",
+		Raw:      "500",
+		DryRun:   true,
+	}, got); diff != "" {
+		t.Errorf("Audit entry diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestControlAPIParams(t *testing.T) {
+	a, err := newControlAPI(nil, controlOpts{
+		params: []string{
+			"Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll",
+			"/Einstellungen/Heizung/Temperaturen/Rückl.-Begr./",
+		},
+		tokens: map[string]string{"secret": "alice"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	a.register(mux)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/v1/control", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Status %d, want %d: %s", rec.Code, http.StatusOK, rec.Body.String())
+	}
+
+	var got []controlParamInfo
+
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff([]controlParamInfo{
+		{
+			Path: "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll",
+			ID:   "einstellungen_warmwasser_temperaturen_warmwasser_soll",
+		},
+		{
+			Path: "Einstellungen/Heizung/Temperaturen/Rückl.-Begr.",
+			ID:   "einstellungen_heizung_temperaturen_rueckl_begr",
+		},
+	}, got); diff != "" {
+		t.Errorf("Parameters diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestControlAPIDuplicateID(t *testing.T) {
+	if _, err := newControlAPI(nil, controlOpts{
+		params: []string{"Heizung/Soll-Wert", "Heizung/Soll Wert"},
+	}); err == nil {
+		t.Errorf("newControlAPI() succeeded with duplicate IDs")
+	}
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+// copSampleInterval is the minimum time between two energy monitor samples
+// kept for computing seasonal COP values.
+const copSampleInterval = time.Hour
+
+// copSample is a snapshot of the energy monitor counters of one category.
+type copSample struct {
+	Time   int64   `json:"time"`
+	Heat   float64 `json:"heat"`
+	Energy float64 `json:"energy"`
+}
+
+// addCOPSample records a sample for the given category unless the most recent
+// sample is younger than minInterval. Samples older than maxAge are removed.
+func (s *stateStore) addCOPSample(category string, sample copSample, minInterval, maxAge time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.COPSamples == nil {
+		s.data.COPSamples = map[string][]copSample{}
+	}
+
+	samples := s.data.COPSamples[category]
+
+	if n := len(samples); n > 0 && time.Unix(sample.Time, 0).Sub(time.Unix(samples[n-1].Time, 0)) < minInterval {
+		return
+	}
+
+	cutoff := time.Unix(sample.Time, 0).Add(-maxAge).Unix()
+
+	for len(samples) > 1 && samples[1].Time <= cutoff {
+		// Keep the newest sample older than the cutoff as the baseline for
+		// the longest window.
+		samples = samples[1:]
+	}
+
+	s.data.COPSamples[category] = append(samples, sample)
+	s.dirty = true
+}
+
+// copBaseline returns the most recent sample of a category taken at or before
+// the given time.
+func (s *stateStore) copBaseline(category string, before time.Time) (copSample, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var result copSample
+	var found bool
+
+	for _, sample := range s.data.COPSamples[category] {
+		if sample.Time > before.Unix() {
+			break
+		}
+
+		result = sample
+		found = true
+	}
+
+	return result, found
+}
+
+type measurement struct {
+	value float64
+	unit  string
+
+	// Name of the content item
+	item string
+}
+
+// groupMeasurements parses all values of a content group and returns them by
+// normalized item name.
+func (c *collector) groupMeasurements(content *luxwsclient.ContentRoot, cmp luxwsclient.CompareFn) (map[string]measurement, error) {
+	group, err := content.FindByName(cmp)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]measurement{}
+
+	group.EachNonNil(func(item *luxwsclient.ContentItem) {
+		if value, unit, err := c.parseValue(*item.Value); err == nil {
+			result[normalizeSpace(item.Name)] = measurement{value, unit, item.Name}
+		}
+	})
+
+	return result, nil
+}
+
+func (c *collector) collectCOP(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	if status, err := c.groupMeasurements(content, luxwsclient.CmpName(c.terms.NavSystemStatus)); err == nil {
+		heat := status[normalizeSpace(c.terms.StatusHeatingCapacity)]
+		power := status[normalizeSpace(c.terms.StatusPowerConsumption)]
+
+		if heat.unit == power.unit && power.value > 0 {
+			ch <- prometheus.MustNewConstMetric(c.copInstantaneousDesc, prometheus.GaugeValue, heat.value/power.value)
+
+			c.recordItem(env, c.terms.NavSystemStatus, heat.item, c.copInstantaneousDesc)
+			c.recordItem(env, c.terms.NavSystemStatus, power.item, c.copInstantaneousDesc)
+		}
+	}
+
+	if env.Quirks.MissingSuppliedHeat {
+		return nil
+	}
+
+	// Missing groups are reported by the collectors for the raw values.
+	heat, err := c.groupMeasurements(content, luxwsclient.CmpName(c.terms.NavHeatQuantity))
+	if err != nil {
+		return nil
+	}
+
+	energy, err := c.groupMeasurements(content, luxwsclient.CmpNameAndItems(c.terms.NavEnergyInput))
+	if err != nil {
+		return nil
+	}
+
+	var maxWindow time.Duration
+
+	for _, window := range c.copWindows {
+		maxWindow = max(maxWindow, time.Duration(window))
+	}
+
+	now := c.now()
+
+	for name, h := range heat {
+		e, ok := energy[name]
+		if !ok || e.unit != h.unit || e.value <= 0 {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.copCumulativeDesc, prometheus.GaugeValue, h.value/e.value, name)
+
+		c.recordItem(env, c.terms.NavHeatQuantity, h.item, c.copCumulativeDesc)
+		c.recordItem(env, c.terms.NavEnergyInput, e.item, c.copCumulativeDesc)
+
+		if len(c.copWindows) == 0 {
+			continue
+		}
+
+		for _, window := range c.copWindows {
+			base, ok := c.state.copBaseline(name, now.Add(-time.Duration(window)))
+			if !ok {
+				continue
+			}
+
+			deltaHeat := h.value - base.Heat
+			deltaEnergy := e.value - base.Energy
+
+			if deltaHeat < 0 || deltaEnergy <= 0 {
+				// Counter reset or no energy used
+				continue
+			}
+
+			ch <- prometheus.MustNewConstMetric(c.copSeasonalDesc, prometheus.GaugeValue,
+				deltaHeat/deltaEnergy, name, window.String())
+
+			c.recordItem(env, c.terms.NavHeatQuantity, h.item, c.copSeasonalDesc)
+			c.recordItem(env, c.terms.NavEnergyInput, e.item, c.copSeasonalDesc)
+		}
+
+		c.state.addCOPSample(name, copSample{
+			Time:   now.Unix(),
+			Heat:   h.value,
+			Energy: e.value,
+		}, copSampleInterval, maxWindow)
+	}
+
+	return nil
+}
+
+// parseCOPWindows parses durations in the Prometheus format, e.g. "30d".
+func parseCOPWindows(values []string) ([]model.Duration, error) {
+	var result []model.Duration
+
+	for _, i := range values {
+		d, err := model.ParseDuration(i)
+		if err != nil {
+			return nil, err
+		}
+
+		if d <= 0 {
+			continue
+		}
+
+		result = append(result, d)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
+)
+
+func TestCollectCOPSeasonal(t *testing.T) {
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+		copWindows: []model.Duration{
+			model.Duration(24 * time.Hour),
+			model.Duration(7 * 24 * time.Hour),
+		},
+	})
+
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	content := func(heat, energy string) *luxwsclient.ContentRoot {
+		return &luxwsclient.ContentRoot{
+			Items: luxwsclient.ContentItems{
+				{
+					Name: "Heat Quantity",
+					Items: luxwsclient.ContentItems{
+						{Name: "total", Value: luxwsclient.String(heat)},
+					},
+				},
+				{
+					Name: "Power Consumption",
+					Items: luxwsclient.ContentItems{
+						{Name: "total", Value: luxwsclient.String(energy)},
+					},
+				},
+			},
+		}
+	}
+
+	for _, tc := range []struct {
+		name    string
+		advance time.Duration
+		heat    string
+		energy  string
+		want    string
+	}{
+		{
+			// No history yet
+			name:   "initial",
+			heat:   "1000 kWh",
+			energy: "400 kWh",
+			want: `
+# HELP luxws_cop_cumulative Coefficient of performance from energy monitor totals
+# TYPE luxws_cop_cumulative gauge
+luxws_cop_cumulative{name="total"} 2.5
+`,
+		},
+		{
+			name:    "one day",
+			advance: 24 * time.Hour,
+			heat:    "1040 kWh",
+			energy:  "410 kWh",
+			want: `
+# HELP luxws_cop_cumulative Coefficient of performance from energy monitor totals
+# TYPE luxws_cop_cumulative gauge
+luxws_cop_cumulative{name="total"} 2.5365853658536586
+# HELP luxws_cop_seasonal Seasonal coefficient of performance (JAZ) from energy monitor over a time window
+# TYPE luxws_cop_seasonal gauge
+luxws_cop_seasonal{name="total",window="1d"} 4
+`,
+		},
+		{
+			name:    "eight days",
+			advance: 7 * 24 * time.Hour,
+			heat:    "1400 kWh",
+			energy:  "510 kWh",
+			want: `
+# HELP luxws_cop_cumulative Coefficient of performance from energy monitor totals
+# TYPE luxws_cop_cumulative gauge
+luxws_cop_cumulative{name="total"} 2.7450980392156863
+# HELP luxws_cop_seasonal Seasonal coefficient of performance (JAZ) from energy monitor over a time window
+# TYPE luxws_cop_seasonal gauge
+luxws_cop_seasonal{name="total",window="1d"} 3.6
+luxws_cop_seasonal{name="total",window="1w"} 3.6
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.advance)
+
+			a := &adapter{
+				c: c,
+				collect: func(ch chan<- prometheus.Metric) error {
+					return c.collectCOP(testEnv(quirks{}), ch, content(tc.heat, tc.energy))
+				},
+			}
+			a.collectAndCompare(t, tc.want, nil)
+		})
+	}
+}
+
+func TestCollectCOPMissingSuppliedHeat(t *testing.T) {
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+	})
+
+	a := &adapter{
+		c: c,
+		collect: func(ch chan<- prometheus.Metric) error {
+			return c.collectCOP(testEnv(quirks{MissingSuppliedHeat: true}), ch, &luxwsclient.ContentRoot{
+				Items: luxwsclient.ContentItems{
+					{
+						Name: "system status",
+						Items: luxwsclient.ContentItems{
+							{Name: "Heating capacity", Value: luxwsclient.String("6.0 kW")},
+							{Name: "Power Consumption", Value: luxwsclient.String("1.5 kW")},
+						},
+					},
+					{
+						Name: "Heat Quantity",
+						Items: luxwsclient.ContentItems{
+							{Name: "total", Value: luxwsclient.String("0 kWh")},
+						},
+					},
+				},
+			})
+		},
+	}
+	a.collectAndCompare(t, `
+# HELP luxws_cop_instantaneous Coefficient of performance from current heating capacity and power consumption
+# TYPE luxws_cop_instantaneous gauge
+luxws_cop_instantaneous 4
+`, nil)
+}
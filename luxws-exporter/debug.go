@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxws"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+)
+
+type traceMessage struct {
+	time    time.Time
+	sent    bool
+	payload string
+}
+
+// scrapeTrace records the messages exchanged with the controller during
+// a scrape.
+type scrapeTrace struct {
+	now      func() time.Time
+	mu       sync.Mutex
+	start    time.Time
+	end      time.Time
+	messages []traceMessage
+	content  *luxwsclient.ContentRoot
+	err      error
+
+	// How items were used by the collection.
+	outcomes *luxwscollect.Outcomes
+}
+
+func newScrapeTrace(now func() time.Time, outcomes *luxwscollect.Outcomes) *scrapeTrace {
+	return &scrapeTrace{now: now, start: now(), outcomes: outcomes}
+}
+
+func (t *scrapeTrace) record(sent bool, payload []byte) {
+	msg := traceMessage{
+		time:    t.now(),
+		sent:    sent,
+		payload: string(payload),
+	}
+
+	if sent {
+		msg.payload = luxws.RedactCommand(msg.payload)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.messages = append(t.messages, msg)
+}
+
+// traceStore keeps the trace of the most recently started scrape which has
+// finished.
+type traceStore struct {
+	mu    sync.Mutex
+	trace *scrapeTrace
+}
+
+func (s *traceStore) store(t *scrapeTrace, end time.Time, content *luxwsclient.ContentRoot, err error) {
+	t.mu.Lock()
+	t.end = end
+	t.content = content
+	t.err = err
+	t.mu.Unlock()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.trace == nil || !t.start.Before(s.trace.start) {
+		s.trace = t
+	}
+}
+
+func (s *traceStore) get() *scrapeTrace {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.trace
+}
+
+// writeItemOutcomes writes the outcome recorded for every item with a value.
+func writeItemOutcomes(w io.Writer, outcomes *luxwscollect.Outcomes, names outcomeNames, path []string, items luxwsclient.ContentItems) {
+	for _, item := range items {
+		itemPath := append(path[:len(path):len(path)], item.Name)
+
+		if item.Value != nil {
+			var groupName string
+
+			if len(path) > 0 {
+				groupName = path[len(path)-1]
+			}
+
+			fmt.Fprintf(w, "%s: %q", strings.Join(itemPath, " / "), *item.Value)
+
+			outcome, ok := names.lookup(outcomes, groupName, item)
+
+			switch {
+			case !ok:
+				fmt.Fprintf(w, " -> ignored\n")
+			case outcome.Err != nil:
+				fmt.Fprintf(w, " -> parse error: %v\n", outcome.Err)
+			default:
+				fmt.Fprintf(w, " -> %s\n", strings.Join(outcome.Metrics, ", "))
+			}
+		}
+
+		writeItemOutcomes(w, outcomes, names, itemPath, item.Items)
+	}
+}
+
+// handleLastScrape shows the messages exchanged during the most recent scrape
+// and how each item of the information page was processed.
+func (c *collector) handleLastScrape(w http.ResponseWriter, r *http.Request) {
+	t := c.lastTrace.get()
+	if t == nil {
+		http.Error(w, "No scrape finished yet", http.StatusNotFound)
+		return
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	fmt.Fprintf(w, "Started: %s\n", t.start.Format(time.RFC3339Nano))
+	fmt.Fprintf(w, "Duration: %s\n", t.end.Sub(t.start))
+
+	if t.err != nil {
+		fmt.Fprintf(w, "Error: %v\n", t.err)
+	}
+
+	fmt.Fprintf(w, "\n== Messages ==\n")
+
+	for _, msg := range t.messages {
+		direction := "<"
+
+		if msg.sent {
+			direction = ">"
+		}
+
+		fmt.Fprintf(w, "\n[+%s] %s %s\n", msg.time.Sub(t.start).Round(time.Millisecond), direction, msg.payload)
+	}
+
+	if t.content != nil {
+		fmt.Fprintf(w, "\n== Items ==\n\n")
+
+		writeItemOutcomes(w, t.outcomes, c.outcomeNames(t.content), nil, t.content.Items)
+	}
+}
+
+// registerDebug adds debugging handlers to a mux.
+func (c *collector) registerDebug(mux *http.ServeMux) {
+	mux.HandleFunc("GET /debug/last-scrape", c.handleLastScrape)
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestLastScrape(t *testing.T) {
+	address, _ := newFakeController(t,
+		`<Navigation id="0x1"><item id="0x2"><name>information</name></item></Navigation>`,
+		map[string]string{
+			"0x2": `<Content><item id="0x10"><name>temperatures</name>` +
+				`<item id="0x11"><name>flow</name><value>30.2°C</value></item>` +
+				`<item id="0x12"><name>mode</name><value>heating</value></item></item>` +
+				`<item id="0x20"><name>other</name><item id="0x21"><name>unknown</name><value>1 h</value></item></item></Content>`,
+		})
+
+	c := newCollector(collectorOpts{
+		address:  address,
+		password: "secret",
+		terms:    luxwslang.English,
+		loc:      time.UTC,
+		timeout:  time.Minute,
+	})
+
+	now := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	mux := http.NewServeMux()
+	c.registerDebug(mux)
+
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/last-scrape", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status %d before first scrape, want %d", rec.Code, http.StatusNotFound)
+	}
+
+	ch := make(chan prometheus.Metric)
+
+	go func() {
+		for range ch {
+		}
+	}()
+
+	// The information collector fails due to the missing system status
+	if err := c.collectWebSocket(context.Background(), ch); err == nil {
+		t.Errorf("collectWebSocket() succeeded")
+	}
+
+	close(ch)
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/last-scrape", nil))
+
+	want := `Started: 2024-09-01T12:00:00Z
+Duration: 0s
+
+== Messages ==
+
+[+0s] > LOGIN;<redacted>
+
+[+0s] < <Navigation id="0x1"><item id="0x2"><name>information</name></item></Navigation>
+
+[+0s] > GET;0x2
+
+[+0s] < <Content><item id="0x10"><name>temperatures</name><item id="0x11"><name>flow</name><value>30.2°C</value></item><item id="0x12"><name>mode</name><value>heating</value></item></item><item id="0x20"><name>other</name><item id="0x21"><name>unknown</name><value>1 h</value></item></item></Content>
+
+== Items ==
+
+temperatures / flow: "30.2°C" -> luxws_temperature
+temperatures / mode: "heating" -> parse error: unrecognized measurement format "heating"
+other / unknown: "1 h" -> ignored
+`
+
+	if diff := cmp.Diff(want, rec.Body.String()); diff != "" {
+		t.Errorf("Body diff (-want +got):\n%s", diff)
+	}
+
+	// Fetches for the API on an expired cache don't replace the trace
+	now = now.Add(apiCacheMaxAge + time.Minute)
+
+	if _, _, _, cached, err := c.snapshot(context.Background()); err != nil || cached {
+		t.Errorf("snapshot() returned cached %t, error %v", cached, err)
+	}
+
+	rec = httptest.NewRecorder()
+	mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/last-scrape", nil))
+
+	if diff := cmp.Diff(want, rec.Body.String()); diff != "" {
+		t.Errorf("Body after API fetch diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteItemOutcomesRenamed(t *testing.T) {
+	outcomes := luxwscollect.NewOutcomes()
+	outcomes.Metric("temperatures", "flow", "luxws_temperature")
+
+	item := &luxwsclient.ContentItem{Name: "flow temp.", Value: luxwsclient.String("30.2°C")}
+	items := luxwsclient.ContentItems{
+		{Name: "temps", Items: luxwsclient.ContentItems{item}},
+	}
+
+	var buf bytes.Buffer
+
+	writeItemOutcomes(&buf, outcomes, outcomeNames{item: {"temperatures", "flow"}}, nil, items)
+
+	if diff := cmp.Diff("temps / flow temp.: \"30.2°C\" -> luxws_temperature\n", buf.String()); diff != "" {
+		t.Errorf("Output diff (-want +got):\n%s", diff)
+	}
+}
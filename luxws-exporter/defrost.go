@@ -0,0 +1,216 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// A change of the "last defrost" timestamp within this duration of a defrost
+// observed via the operation mode is considered to be the same event.
+const defrostMatchWindow = 30 * time.Minute
+
+// The duration of a defrost is unknown if two samples are further apart than
+// this duration.
+const defrostMaxGap = 15 * time.Minute
+
+// Upper bounds in seconds for defrost durations.
+var defrostDurationBuckets = []float64{
+	30, 60, 120, 180, 300, 450, 600, 900, 1200,
+}
+
+// Upper bounds in seconds for the time between defrosts.
+var defrostIntervalBuckets = []float64{
+	900, 1800, 3600, 2 * 3600, 3 * 3600, 4 * 3600, 6 * 3600, 12 * 3600, 24 * 3600, 48 * 3600,
+}
+
+// Upper bounds in degrees Celsius for the outdoor temperature at the time of
+// a defrost.
+var defrostOutdoorTemperatureBuckets = []float64{
+	-20, -15, -10, -7, -5, -3, -1, 0, 1, 3, 5, 7, 10, 15,
+}
+
+// defrostState tracks defrost events between scrapes.
+type defrostState struct {
+	LastSeen int64 `json:"last_seen"`
+
+	// Most recent value of the "last defrost" timestamp as reported by the
+	// controller.
+	Reported int64 `json:"reported,omitempty"`
+
+	// Start of an ongoing defrost observed via the operation mode or zero.
+	Active int64 `json:"active,omitempty"`
+
+	// Time of the most recent counted event.
+	LastEvent int64 `json:"last_event,omitempty"`
+
+	Events             float64        `json:"events"`
+	Duration           histogramState `json:"duration"`
+	Interval           histogramState `json:"interval"`
+	OutdoorTemperature histogramState `json:"outdoor_temperature"`
+}
+
+type defrostObservation struct {
+	now         time.Time
+	defrosting  bool
+	lastDefrost time.Time
+
+	outdoorTemperature      float64
+	outdoorTemperatureKnown bool
+}
+
+// updateDefrost records an observation of the defrost-related values and
+// returns a copy of the resulting state.
+func (s *stateStore) updateDefrost(obs defrostObservation) defrostState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	nowMs := obs.now.UnixMilli()
+
+	st := s.data.Defrost
+	if st == nil {
+		st = &defrostState{}
+		s.data.Defrost = st
+		s.dirty = true
+
+		// Establish a baseline without counting events
+		if !obs.lastDefrost.IsZero() {
+			st.Reported = obs.lastDefrost.UnixMilli()
+		}
+	}
+
+	if nowMs < st.LastSeen {
+		// Out-of-order scrape, e.g. from concurrent collections
+		return st.copy()
+	}
+
+	gap := st.LastSeen != 0 && nowMs-st.LastSeen > defrostMaxGap.Milliseconds()
+
+	countEvent := func(ts int64) {
+		if st.LastEvent != 0 && ts > st.LastEvent {
+			st.Interval.observe(defrostIntervalBuckets, float64(ts-st.LastEvent)/1000)
+		}
+
+		st.Events++
+		st.LastEvent = max(st.LastEvent, ts)
+		s.dirty = true
+
+		if obs.outdoorTemperatureKnown {
+			st.OutdoorTemperature.observe(defrostOutdoorTemperatureBuckets, obs.outdoorTemperature)
+		}
+	}
+
+	isRecent := func(ts int64) bool {
+		return st.LastEvent != 0 && abs(ts-st.LastEvent) <= defrostMatchWindow.Milliseconds()
+	}
+
+	switch {
+	case obs.defrosting && st.Active == 0:
+		if st.LastSeen != 0 && !isRecent(nowMs) {
+			countEvent(nowMs)
+		}
+
+		st.Active = nowMs
+		s.dirty = true
+
+	case !obs.defrosting && st.Active != 0:
+		if !gap {
+			st.Duration.observe(defrostDurationBuckets, float64(nowMs-st.Active)/1000)
+		}
+
+		st.Active = 0
+		s.dirty = true
+	}
+
+	if !obs.lastDefrost.IsZero() {
+		reported := obs.lastDefrost.UnixMilli()
+
+		if reported > st.Reported {
+			if st.Reported != 0 && !isRecent(reported) {
+				countEvent(reported)
+			}
+
+			st.Reported = reported
+			s.dirty = true
+		}
+	}
+
+	// Not a modification on its own (see updateCompressor)
+	st.LastSeen = nowMs
+
+	return st.copy()
+}
+
+func (st *defrostState) copy() defrostState {
+	result := *st
+
+	for _, h := range []*histogramState{&result.Duration, &result.Interval, &result.OutdoorTemperature} {
+		h.Counts = append([]uint64(nil), h.Counts...)
+	}
+
+	return result
+}
+
+func abs(v int64) int64 {
+	if v < 0 {
+		return -v
+	}
+
+	return v
+}
+
+func (c *collector) collectDefrost(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	// Missing groups are reported by the other collectors.
+	status, err := content.FindByName(luxwsclient.CmpName(c.terms.NavSystemStatus))
+	if err != nil {
+		return nil
+	}
+
+	obs := defrostObservation{
+		now: c.now(),
+	}
+
+	eventDescs := []*prometheus.Desc{c.defrostEventsDesc, c.defrostDurationDesc, c.defrostIntervalDesc}
+
+	status.EachNonNil(func(item *luxwsclient.ContentItem) {
+		switch item.Name {
+		case c.terms.StatusOperationMode:
+			opMode := strings.ToLower(normalizeSpace(*item.Value))
+			obs.defrosting = c.terms.OperationModeMapping[opMode] == luxwslang.OpModeIDDefrosting
+
+			c.recordItem(env, c.terms.NavSystemStatus, item.Name, eventDescs...)
+
+		case c.terms.StatusLastDefrost:
+			if ts, err := c.terms.ParseTimestampShort(*item.Value, c.loc); err == nil {
+				obs.lastDefrost = ts
+
+				c.recordItem(env, c.terms.NavSystemStatus, item.Name, eventDescs...)
+			} else if c.log != nil {
+				c.log.Debug("StatusLastDefrost parsing failed", zap.Error(err), zap.Stringp("value", item.Value))
+			}
+		}
+	})
+
+	if temperatures, err := c.groupMeasurements(content, luxwsclient.CmpName(c.terms.NavTemperatures)); err == nil {
+		if m, ok := temperatures[normalizeSpace(c.terms.TemperatureOutdoor)]; ok && m.unit == "degC" {
+			obs.outdoorTemperature = m.value
+			obs.outdoorTemperatureKnown = true
+
+			c.recordItem(env, c.terms.NavTemperatures, m.item, c.defrostOutdoorTemperatureDesc)
+		}
+	}
+
+	st := c.state.updateDefrost(obs)
+
+	ch <- prometheus.MustNewConstMetric(c.defrostEventsDesc, prometheus.CounterValue, st.Events)
+	ch <- st.Duration.metric(c.defrostDurationDesc, defrostDurationBuckets)
+	ch <- st.Interval.metric(c.defrostIntervalDesc, defrostIntervalBuckets)
+	ch <- st.OutdoorTemperature.metric(c.defrostOutdoorTemperatureDesc, defrostOutdoorTemperatureBuckets)
+
+	return nil
+}
@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func formatEmptyHistogram(name, help string, bounds []float64) string {
+	var buf strings.Builder
+
+	fmt.Fprintf(&buf, "# HELP %s %s\n# TYPE %s histogram\n", name, help, name)
+
+	for _, upper := range bounds {
+		fmt.Fprintf(&buf, "%s_bucket{le=\"%g\"} 0\n", name, upper)
+	}
+
+	fmt.Fprintf(&buf, "%s_bucket{le=\"+Inf\"} 0\n%s_sum 0\n%s_count 0\n", name, name, name)
+
+	return buf.String()
+}
+
+// Metrics reported by collectDefrost on the first observation.
+var emptyDefrostMetrics = `
+# HELP luxws_defrost_events_total Number of observed defrosts
+# TYPE luxws_defrost_events_total counter
+luxws_defrost_events_total 0
+` + formatEmptyHistogram("luxws_defrost_duration_seconds", "Duration of defrosts observed via the operation mode", defrostDurationBuckets) +
+	formatEmptyHistogram("luxws_defrost_interval_seconds", "Time between two defrosts", defrostIntervalBuckets) +
+	formatEmptyHistogram("luxws_defrost_outdoor_temperature_celsius", "Outdoor temperature at the time of defrosts", defrostOutdoorTemperatureBuckets)
+
+func TestStateStoreUpdateDefrost(t *testing.T) {
+	s, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		name           string
+		offset         time.Duration
+		defrosting     bool
+		lastDefrost    time.Duration
+		wantEvents     float64
+		wantDurations  uint64
+		wantIntervals  uint64
+		wantOutdoorSum float64
+	}{
+		{name: "baseline", offset: 0, lastDefrost: -time.Hour},
+		{name: "defrost starts", offset: time.Minute, defrosting: true, lastDefrost: -time.Hour, wantEvents: 1, wantOutdoorSum: -3},
+		{name: "timestamp updated", offset: 2 * time.Minute, defrosting: true, lastDefrost: time.Minute, wantEvents: 1, wantOutdoorSum: -3},
+		{name: "defrost ends", offset: 5 * time.Minute, lastDefrost: time.Minute, wantEvents: 1, wantDurations: 1, wantOutdoorSum: -3},
+		{name: "missed defrost", offset: 2 * time.Hour, lastDefrost: 90 * time.Minute, wantEvents: 2, wantDurations: 1, wantIntervals: 1, wantOutdoorSum: -6},
+		{name: "no change", offset: 2*time.Hour + time.Minute, lastDefrost: 90 * time.Minute, wantEvents: 2, wantDurations: 1, wantIntervals: 1, wantOutdoorSum: -6},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			got := s.updateDefrost(defrostObservation{
+				now:                     start.Add(tc.offset),
+				defrosting:              tc.defrosting,
+				lastDefrost:             start.Add(tc.lastDefrost),
+				outdoorTemperature:      -3,
+				outdoorTemperatureKnown: true,
+			})
+
+			if got.Events != tc.wantEvents {
+				t.Errorf("Events = %v, want %v", got.Events, tc.wantEvents)
+			}
+
+			if got.Duration.Count != tc.wantDurations {
+				t.Errorf("Duration count = %v, want %v", got.Duration.Count, tc.wantDurations)
+			}
+
+			if got.Interval.Count != tc.wantIntervals {
+				t.Errorf("Interval count = %v, want %v", got.Interval.Count, tc.wantIntervals)
+			}
+
+			if got.OutdoorTemperature.Sum != tc.wantOutdoorSum {
+				t.Errorf("Outdoor temperature sum = %v, want %v", got.OutdoorTemperature.Sum, tc.wantOutdoorSum)
+			}
+		})
+	}
+}
+
+func TestStateStoreUpdateDefrostDirty(t *testing.T) {
+	s, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+	lastDefrost := start.Add(-time.Hour)
+
+	for _, tc := range []struct {
+		offset     time.Duration
+		defrosting bool
+		wantDirty  bool
+	}{
+		{offset: 0, wantDirty: true},
+		{offset: time.Minute},
+		{offset: 2 * time.Minute, defrosting: true, wantDirty: true},
+		{offset: 3 * time.Minute, defrosting: true},
+		{offset: 4 * time.Minute, wantDirty: true},
+		{offset: 5 * time.Minute},
+	} {
+		s.dirty = false
+
+		s.updateDefrost(defrostObservation{
+			now:         start.Add(tc.offset),
+			defrosting:  tc.defrosting,
+			lastDefrost: lastDefrost,
+		})
+
+		if s.dirty != tc.wantDirty {
+			t.Errorf("At %v: dirty is %t, want %t", tc.offset, s.dirty, tc.wantDirty)
+		}
+	}
+}
+
+func TestCollectDefrost(t *testing.T) {
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+	})
+
+	now := time.Date(2024, time.December, 5, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	content := func(lastDefrost string) *luxwsclient.ContentRoot {
+		return &luxwsclient.ContentRoot{
+			Items: luxwsclient.ContentItems{
+				{
+					Name: "system status",
+					Items: luxwsclient.ContentItems{
+						{Name: "operation mode", Value: luxwsclient.String("heating")},
+						{Name: "last defrost", Value: luxwsclient.String(lastDefrost)},
+					},
+				},
+				{
+					Name: "temperatures",
+					Items: luxwsclient.ContentItems{
+						{Name: "outdoor temp.", Value: luxwsclient.String("2.5°C")},
+					},
+				},
+			},
+		}
+	}
+
+	for _, i := range []string{"05.12.24 09:00", "05.12.24 11:00"} {
+		now = now.Add(time.Minute)
+
+		ch := make(chan prometheus.Metric, 16)
+
+		if err := c.collectDefrost(testEnv(quirks{}), ch, content(i)); err != nil {
+			t.Errorf("collectDefrost() failed: %v", err)
+		}
+	}
+
+	a := &adapter{
+		c:           c,
+		metricNames: []string{"luxws_defrost_events_total", "luxws_defrost_outdoor_temperature_celsius"},
+		collect: func(ch chan<- prometheus.Metric) error {
+			return c.collectDefrost(testEnv(quirks{}), ch, content("05.12.24 11:00"))
+		},
+	}
+	a.collectAndCompare(t, `
+# HELP luxws_defrost_events_total Number of observed defrosts
+# TYPE luxws_defrost_events_total counter
+luxws_defrost_events_total 1
+# HELP luxws_defrost_outdoor_temperature_celsius Outdoor temperature at the time of defrosts
+# TYPE luxws_defrost_outdoor_temperature_celsius histogram
+luxws_defrost_outdoor_temperature_celsius_bucket{le="-20"} 0
+luxws_defrost_outdoor_temperature_celsius_bucket{le="-15"} 0
+luxws_defrost_outdoor_temperature_celsius_bucket{le="-10"} 0
+luxws_defrost_outdoor_temperature_celsius_bucket{le="-7"} 0
+luxws_defrost_outdoor_temperature_celsius_bucket{le="-5"} 0
+luxws_defrost_outdoor_temperature_celsius_bucket{le="-3"} 0
+luxws_defrost_outdoor_temperature_celsius_bucket{le="-1"} 0
+luxws_defrost_outdoor_temperature_celsius_bucket{le="0"} 0
+luxws_defrost_outdoor_temperature_celsius_bucket{le="1"} 0
+luxws_defrost_outdoor_temperature_celsius_bucket{le="3"} 1
+luxws_defrost_outdoor_temperature_celsius_bucket{le="5"} 1
+luxws_defrost_outdoor_temperature_celsius_bucket{le="7"} 1
+luxws_defrost_outdoor_temperature_celsius_bucket{le="10"} 1
+luxws_defrost_outdoor_temperature_celsius_bucket{le="15"} 1
+luxws_defrost_outdoor_temperature_celsius_bucket{le="+Inf"} 1
+luxws_defrost_outdoor_temperature_celsius_sum 2.5
+luxws_defrost_outdoor_temperature_celsius_count 1
+`, nil)
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+var dumpFormats = []string{"prometheus", "json", "csv"}
+
+var errDumpScrapeFailed = errors.New("scrape failed")
+
+type dumpSample struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	Value  float64           `json:"value"`
+}
+
+// formatDumpLabels formats labels like in the Prometheus text format, e.g.
+// `name="flow",unit="degC"`.
+func formatDumpLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+
+	for k := range labels {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+
+	for _, k := range keys {
+		parts = append(parts, k+"="+strconv.Quote(labels[k]))
+	}
+
+	return strings.Join(parts, ",")
+}
+
+// writeDump writes gathered metrics in the given format.
+func writeDump(w io.Writer, format string, ts time.Time, families []*dto.MetricFamily) error {
+	switch format {
+	case "prometheus":
+		for _, mf := range families {
+			if _, err := expfmt.MetricFamilyToText(w, mf); err != nil {
+				return err
+			}
+		}
+
+		return nil
+
+	case "json":
+		result := struct {
+			Time    time.Time    `json:"time"`
+			Samples []dumpSample `json:"samples"`
+		}{
+			Time:    ts,
+			Samples: []dumpSample{},
+		}
+
+		for _, s := range flattenFamilies(families) {
+			result.Samples = append(result.Samples, dumpSample{s.name, s.labels, s.value})
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+
+		return enc.Encode(result)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		cw.Write([]string{"time", "name", "labels", "value"})
+
+		for _, s := range flattenFamilies(families) {
+			cw.Write([]string{
+				ts.Format(time.RFC3339),
+				s.name,
+				formatDumpLabels(s.labels),
+				strconv.FormatFloat(s.value, 'g', -1, 64),
+			})
+		}
+
+		cw.Flush()
+
+		return cw.Error()
+	}
+
+	return fmt.Errorf("unknown format %q", format)
+}
+
+// dump runs a single collection and writes the result to the given file or,
+// if empty, to stdout. The output is written even if the scrape failed, in
+// which case errDumpScrapeFailed is returned.
+func dump(c prometheus.Collector, now time.Time, format, output string) error {
+	reg := prometheus.NewPedanticRegistry()
+
+	if err := reg.Register(c); err != nil {
+		return err
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		return err
+	}
+
+	if output == "" {
+		err = writeDump(os.Stdout, format, now, families)
+	} else {
+		var buf bytes.Buffer
+
+		if err = writeDump(&buf, format, now, families); err == nil {
+			// The node_exporter textfile collector may run as another user
+			err = writeFileAtomic(output, buf.Bytes(), 0o644)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, s := range flattenFamilies(families) {
+		if s.name == "luxws_up" && s.value != 1 {
+			return errDumpScrapeFailed
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func dumpTestFamilies(t *testing.T) []*dto.MetricFamily {
+	t.Helper()
+
+	reg := prometheus.NewPedanticRegistry()
+
+	temperature := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "luxws_temperature",
+		Help: "Sensor temperature",
+	}, []string{"name", "unit"})
+	temperature.WithLabelValues("flow", "degC").Set(30.2)
+	temperature.WithLabelValues(`say "hi"`, "degC").Set(-1.5)
+
+	reg.MustRegister(temperature)
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return families
+}
+
+func TestWriteDump(t *testing.T) {
+	ts := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		format string
+		want   string
+	}{
+		{
+			format: "prometheus",
+			want: `# HELP luxws_temperature Sensor temperature
+# TYPE luxws_temperature gauge
+luxws_temperature{name="flow",unit="degC"} 30.2
+luxws_temperature{name="say \"hi\"",unit="degC"} -1.5
+`,
+		},
+		{
+			format: "json",
+			want: `{
+  "time": "2024-09-01T12:00:00Z",
+  "samples": [
+    {
+      "name": "luxws_temperature",
+      "labels": {
+        "name": "flow",
+        "unit": "degC"
+      },
+      "value": 30.2
+    },
+    {
+      "name": "luxws_temperature",
+      "labels": {
+        "name": "say \"hi\"",
+        "unit": "degC"
+      },
+      "value": -1.5
+    }
+  ]
+}
+`,
+		},
+		{
+			format: "csv",
+			want: `time,name,labels,value
+2024-09-01T12:00:00Z,luxws_temperature,"name=""flow"",unit=""degC""",30.2
+2024-09-01T12:00:00Z,luxws_temperature,"name=""say \""hi\"""",unit=""degC""",-1.5
+`,
+		},
+	} {
+		t.Run(tc.format, func(t *testing.T) {
+			var buf bytes.Buffer
+
+			if err := writeDump(&buf, tc.format, ts, dumpTestFamilies(t)); err != nil {
+				t.Fatalf("writeDump() failed: %v", err)
+			}
+
+			if diff := cmp.Diff(tc.want, buf.String()); diff != "" {
+				t.Errorf("Output diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if err := writeDump(&bytes.Buffer{}, "xml", ts, nil); err == nil {
+		t.Errorf("writeDump() succeeded for unknown format")
+	}
+}
+
+func TestDumpToFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "luxws.prom")
+
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "luxws_up", Help: "Whether scrape was successful"})
+	up.Set(1)
+
+	if err := dump(up, time.Now(), "prometheus", path); err != nil {
+		t.Fatalf("dump() failed: %v", err)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff("# HELP luxws_up Whether scrape was successful\n# TYPE luxws_up gauge\nluxws_up 1\n", string(content)); diff != "" {
+		t.Errorf("File diff (-want +got):\n%s", diff)
+	}
+
+	if fi, err := os.Stat(path); err != nil {
+		t.Error(err)
+	} else if got := fi.Mode().Perm(); got != 0o644 {
+		t.Errorf("File mode %v, want %v", got, os.FileMode(0o644))
+	}
+
+	if entries, err := os.ReadDir(dir); err != nil {
+		t.Error(err)
+	} else if len(entries) != 1 {
+		t.Errorf("Temporary files left behind: %v", entries)
+	}
+
+	up.Set(0)
+
+	if err := dump(up, time.Now(), "prometheus", path); !errors.Is(err, errDumpScrapeFailed) {
+		t.Errorf("dump() returned %v, want %v", err, errDumpScrapeFailed)
+	}
+}
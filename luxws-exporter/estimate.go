@@ -0,0 +1,123 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Integration of the estimated heat output is skipped if two samples are
+// further apart than this duration as the output in between is unknown.
+const estimateMaxGap = 15 * time.Minute
+
+type estimateMode string
+
+const (
+	// Estimate heat output only for heat pumps without a heat meter.
+	estimateAuto   estimateMode = "auto"
+	estimateAlways estimateMode = "always"
+	estimateNever  estimateMode = "never"
+)
+
+// fluidParams describes the heat transfer fluid circulating through the heat
+// pump.
+type fluidParams struct {
+	// Density in kg/l.
+	density float64
+
+	// Specific heat capacity in kJ/(kg·K).
+	heatCapacity float64
+}
+
+// power returns the thermal power in kW transferred by the given flow rate in
+// l/h at a temperature difference in K.
+func (p fluidParams) power(flowRate, deltaT float64) float64 {
+	return flowRate / 3600 * p.density * p.heatCapacity * deltaT
+}
+
+// estimatedHeat is the state of the heat output integration.
+type estimatedHeat struct {
+	Time   int64   `json:"time"`
+	Power  float64 `json:"power"`
+	Energy float64 `json:"energy"`
+}
+
+// integrateEstimatedHeat adds the energy supplied since the previous sample to
+// the total using the trapezoidal rule. Negative power, e.g. while defrosting,
+// doesn't reduce the total. The new total in kWh is returned.
+func (s *stateStore) integrateEstimatedHeat(now time.Time, power float64) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.data.EstimatedHeat
+	next := estimatedHeat{
+		Time:  now.UnixMilli(),
+		Power: power,
+	}
+
+	if prev != nil {
+		next.Energy = prev.Energy
+
+		if elapsed := now.Sub(time.UnixMilli(prev.Time)); elapsed > 0 && elapsed <= estimateMaxGap {
+			next.Energy += max(0, (prev.Power+power)/2) * elapsed.Hours()
+		} else if elapsed <= 0 {
+			// Concurrent or out-of-order scrape
+			return prev.Energy
+		}
+	}
+
+	s.data.EstimatedHeat = &next
+	s.dirty = true
+
+	return next.Energy
+}
+
+func (c *collector) collectEstimatedHeat(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	switch c.estimateMode {
+	case estimateNever:
+		return nil
+	case estimateAlways:
+	default:
+		if !env.Quirks.MissingSuppliedHeat {
+			return nil
+		}
+	}
+
+	temperatures, err := c.groupMeasurements(content, luxwsclient.CmpName(c.terms.NavTemperatures))
+	if err != nil {
+		return nil
+	}
+
+	inputs, err := c.groupMeasurements(content, luxwsclient.CmpName(c.terms.NavInputs))
+	if err != nil {
+		return nil
+	}
+
+	flow, flowOk := temperatures[normalizeSpace(c.terms.TemperatureFlow)]
+	ret, retOk := temperatures[normalizeSpace(c.terms.TemperatureReturn)]
+	flowRate, flowRateOk := inputs[normalizeSpace(c.terms.InputFlowRate)]
+
+	if !(flowOk && retOk && flowRateOk) {
+		return nil
+	}
+
+	if flow.unit != "degC" || ret.unit != "degC" || flowRate.unit != "l/h" {
+		return fmt.Errorf("unexpected units for estimating heat output: flow %q, return %q, flow rate %q",
+			flow.unit, ret.unit, flowRate.unit)
+	}
+
+	power := c.fluid.power(flowRate.value, flow.value-ret.value)
+	energy := c.state.integrateEstimatedHeat(c.now(), power)
+
+	ch <- prometheus.MustNewConstMetric(c.estimatedHeatPowerDesc, prometheus.GaugeValue, power, "kW")
+	ch <- prometheus.MustNewConstMetric(c.estimatedHeatDesc, prometheus.CounterValue, energy, "kWh")
+
+	c.recordItem(env, c.terms.NavTemperatures, flow.item, c.estimatedHeatPowerDesc, c.estimatedHeatDesc)
+	c.recordItem(env, c.terms.NavTemperatures, ret.item, c.estimatedHeatPowerDesc, c.estimatedHeatDesc)
+	c.recordItem(env, c.terms.NavInputs, flowRate.item, c.estimatedHeatPowerDesc, c.estimatedHeatDesc)
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestFluidParamsPower(t *testing.T) {
+	p := fluidParams{density: 1, heatCapacity: 4.18}
+
+	// 612 l/h at 3 K
+	if got, want := p.power(612, 3), 2.1318; math.Abs(got-want) > 1e-9 {
+		t.Errorf("power() = %v, want %v", got, want)
+	}
+}
+
+func TestCollectEstimatedHeat(t *testing.T) {
+	content := func(flow, ret, flowRate string) *luxwsclient.ContentRoot {
+		return &luxwsclient.ContentRoot{
+			Items: luxwsclient.ContentItems{
+				{
+					Name: "temperatures",
+					Items: luxwsclient.ContentItems{
+						{Name: "flow", Value: luxwsclient.String(flow)},
+						{Name: "return", Value: luxwsclient.String(ret)},
+					},
+				},
+				{
+					Name: "inputs",
+					Items: luxwsclient.ContentItems{
+						{Name: "flow rate", Value: luxwsclient.String(flowRate)},
+					},
+				},
+			},
+		}
+	}
+
+	t.Run("heat meter present", func(t *testing.T) {
+		c := newCollector(collectorOpts{
+			terms: luxwslang.English,
+			loc:   time.UTC,
+		})
+
+		a := &adapter{
+			c: c,
+			collect: func(ch chan<- prometheus.Metric) error {
+				return c.collectEstimatedHeat(testEnv(quirks{}), ch, content("30 °C", "25 °C", "720 l/h"))
+			},
+		}
+		a.collectAndCompare(t, "", nil)
+	})
+
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+		fluid: fluidParams{
+			density:      1,
+			heatCapacity: 4,
+		},
+	})
+
+	now := time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	for _, tc := range []struct {
+		name    string
+		advance time.Duration
+		input   *luxwsclient.ContentRoot
+		want    string
+	}{
+		{
+			name:  "initial",
+			input: content("30 °C", "25 °C", "1800 l/h"),
+			want: `
+# HELP luxws_estimated_heat_power Estimated heat output from flow rate and flow/return temperatures
+# TYPE luxws_estimated_heat_power gauge
+luxws_estimated_heat_power{unit="kW"} 10
+# HELP luxws_estimated_supplied_heat_total Estimated supplied heat integrated from the estimated heat output
+# TYPE luxws_estimated_supplied_heat_total counter
+luxws_estimated_supplied_heat_total{unit="kWh"} 0
+`,
+		},
+		{
+			name:    "after 15 minutes",
+			advance: 15 * time.Minute,
+			input:   content("32 °C", "25 °C", "1800 l/h"),
+			want: `
+# HELP luxws_estimated_heat_power Estimated heat output from flow rate and flow/return temperatures
+# TYPE luxws_estimated_heat_power gauge
+luxws_estimated_heat_power{unit="kW"} 14
+# HELP luxws_estimated_supplied_heat_total Estimated supplied heat integrated from the estimated heat output
+# TYPE luxws_estimated_supplied_heat_total counter
+luxws_estimated_supplied_heat_total{unit="kWh"} 3
+`,
+		},
+		{
+			name:    "gap is not integrated",
+			advance: time.Hour,
+			input:   content("32 °C", "25 °C", "1800 l/h"),
+			want: `
+# HELP luxws_estimated_heat_power Estimated heat output from flow rate and flow/return temperatures
+# TYPE luxws_estimated_heat_power gauge
+luxws_estimated_heat_power{unit="kW"} 14
+# HELP luxws_estimated_supplied_heat_total Estimated supplied heat integrated from the estimated heat output
+# TYPE luxws_estimated_supplied_heat_total counter
+luxws_estimated_supplied_heat_total{unit="kWh"} 3
+`,
+		},
+		{
+			name:    "defrost",
+			advance: 15 * time.Minute,
+			input:   content("20 °C", "27 °C", "1800 l/h"),
+			want: `
+# HELP luxws_estimated_heat_power Estimated heat output from flow rate and flow/return temperatures
+# TYPE luxws_estimated_heat_power gauge
+luxws_estimated_heat_power{unit="kW"} -14
+# HELP luxws_estimated_supplied_heat_total Estimated supplied heat integrated from the estimated heat output
+# TYPE luxws_estimated_supplied_heat_total counter
+luxws_estimated_supplied_heat_total{unit="kWh"} 3
+`,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			now = now.Add(tc.advance)
+
+			a := &adapter{
+				c: c,
+				collect: func(ch chan<- prometheus.Metric) error {
+					return c.collectEstimatedHeat(testEnv(quirks{MissingSuppliedHeat: true}), ch, tc.input)
+				},
+			}
+			a.collectAndCompare(t, tc.want, nil)
+		})
+	}
+}
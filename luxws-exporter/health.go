@@ -0,0 +1,71 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+type healthStatus struct {
+	Status      string       `json:"status"`
+	Language    string       `json:"language"`
+	Firmware    string       `json:"firmware,omitempty"`
+	Type        string       `json:"type,omitempty"`
+	LastSuccess *time.Time   `json:"last_success,omitempty"`
+	LastError   *scrapeError `json:"last_error,omitempty"`
+}
+
+// health describes the state of the most recent scrapes. The status is "ok"
+// if the controller was reached successfully within maxAge.
+func (c *collector) health(maxAge time.Duration) healthStatus {
+	result := healthStatus{
+		Status:   "unavailable",
+		Language: c.terms.ID,
+	}
+
+	ts, content := c.cache.last()
+
+	if content != nil {
+		result.LastSuccess = &ts
+
+		if maxAge <= 0 || c.now().Sub(ts) <= maxAge {
+			result.Status = "ok"
+		}
+
+		hpType, version := c.controllerModel(content)
+
+		result.Firmware = version
+		result.Type = strings.Join(hpType, ", ")
+	}
+
+	if recent := c.cache.recentErrors(); len(recent) > 0 {
+		result.LastError = &recent[0]
+	}
+
+	return result
+}
+
+// registerHealth adds health and readiness handlers to a mux. The exporter is
+// ready if the controller was reached successfully within readyMaxAge.
+func (c *collector) registerHealth(mux *http.ServeMux, readyMaxAge time.Duration) {
+	mux.HandleFunc("GET /-/healthy", func(w http.ResponseWriter, r *http.Request) {
+		status := c.health(0)
+
+		// The process is alive regardless of the controller state
+		status.Status = "ok"
+
+		writeJSON(w, http.StatusOK, status)
+	})
+
+	mux.HandleFunc("GET /-/ready", func(w http.ResponseWriter, r *http.Request) {
+		status := c.health(readyMaxAge)
+
+		code := http.StatusOK
+
+		if status.Status != "ok" {
+			code = http.StatusServiceUnavailable
+		}
+
+		writeJSON(w, code, status)
+	})
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+)
+
+func TestHealth(t *testing.T) {
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+	})
+
+	now := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+
+	mux := http.NewServeMux()
+	c.registerHealth(mux, 3*time.Minute)
+
+	check := func(path string, wantStatus int, want string) {
+		t.Helper()
+
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != wantStatus {
+			t.Errorf("%s: status %d, want %d", path, rec.Code, wantStatus)
+		}
+
+		if diff := cmp.Diff(want, rec.Body.String()); diff != "" {
+			t.Errorf("%s: body diff (-want +got):\n%s", path, diff)
+		}
+	}
+
+	check("/-/healthy", http.StatusOK, `{
+  "status": "ok",
+  "language": "en"
+}
+`)
+	check("/-/ready", http.StatusServiceUnavailable, `{
+  "status": "unavailable",
+  "language": "en"
+}
+`)
+
+	c.cache.store(now.Add(-time.Minute), &luxwsclient.NavRoot{}, &luxwsclient.ContentRoot{
+		Items: luxwsclient.ContentItems{
+			{
+				Name: "system status",
+				Items: luxwsclient.ContentItems{
+					{Name: "type of heat pump", Value: luxwsclient.String("LWD")},
+					{Name: "software version", Value: luxwsclient.String("V3.89.0")},
+				},
+			},
+		},
+	}, nil)
+
+	check("/-/ready", http.StatusOK, `{
+  "status": "ok",
+  "language": "en",
+  "firmware": "V3.89.0",
+  "type": "LWD",
+  "last_success": "2024-09-01T11:59:00Z"
+}
+`)
+
+	now = now.Add(5 * time.Minute)
+	c.cache.storeError(now, errors.New("test"))
+
+	check("/-/ready", http.StatusServiceUnavailable, `{
+  "status": "unavailable",
+  "language": "en",
+  "firmware": "V3.89.0",
+  "type": "LWD",
+  "last_success": "2024-09-01T11:59:00Z",
+  "last_error": {
+    "time": "2024-09-01T12:05:00Z",
+    "message": "test"
+  }
+}
+`)
+	check("/-/healthy", http.StatusOK, `{
+  "status": "ok",
+  "language": "en",
+  "firmware": "V3.89.0",
+  "type": "LWD",
+  "last_success": "2024-09-01T11:59:00Z",
+  "last_error": {
+    "time": "2024-09-01T12:05:00Z",
+    "message": "test"
+  }
+}
+`)
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// histogramState is a histogram which can be stored in the state file. Counts
+// are cumulative per upper bound.
+type histogramState struct {
+	Count  uint64   `json:"count"`
+	Sum    float64  `json:"sum"`
+	Counts []uint64 `json:"counts"`
+}
+
+func (h *histogramState) observe(bounds []float64, value float64) {
+	if len(h.Counts) != len(bounds) {
+		// Bucket layout changed; start over
+		*h = histogramState{Counts: make([]uint64, len(bounds))}
+	}
+
+	h.Count++
+	h.Sum += value
+
+	for idx, upper := range bounds {
+		if value <= upper {
+			h.Counts[idx]++
+		}
+	}
+}
+
+func (h *histogramState) metric(desc *prometheus.Desc, bounds []float64, labelValues ...string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(bounds))
+
+	for idx, upper := range bounds {
+		if idx < len(h.Counts) {
+			buckets[upper] = h.Counts[idx]
+		} else {
+			buckets[upper] = 0
+		}
+	}
+
+	return prometheus.MustNewConstHistogram(desc, h.Count, h.Sum, buckets, labelValues...)
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// Maximum number of lines per write request.
+const influxBatchSize = 5000
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+	influxTagEscaper         = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+)
+
+// influxLine formats a sample as a line with a "value" field. Empty tag
+// values are omitted as they're not permitted by the line protocol.
+func influxLine(sample flatSample, ts time.Time) (string, bool) {
+	if math.IsNaN(sample.value) || math.IsInf(sample.value, 0) {
+		return "", false
+	}
+
+	keys := make([]string, 0, len(sample.labels))
+
+	for k, v := range sample.labels {
+		if v != "" {
+			keys = append(keys, k)
+		}
+	}
+
+	// Sorted tags are recommended for performance
+	sort.Strings(keys)
+
+	var buf strings.Builder
+
+	buf.WriteString(influxMeasurementEscaper.Replace(sample.name))
+
+	for _, k := range keys {
+		buf.WriteByte(',')
+		buf.WriteString(influxTagEscaper.Replace(k))
+		buf.WriteByte('=')
+		buf.WriteString(influxTagEscaper.Replace(sample.labels[k]))
+	}
+
+	buf.WriteString(" value=")
+	buf.WriteString(strconv.FormatFloat(sample.value, 'g', -1, 64))
+	buf.WriteByte(' ')
+	buf.WriteString(strconv.FormatInt(ts.UnixNano(), 10))
+
+	return buf.String(), true
+}
+
+// influxLines converts gathered metrics to line protocol. Metric names are
+// used as measurements.
+func influxLines(ts time.Time, families []*dto.MetricFamily) []string {
+	var result []string
+
+	for _, sample := range flattenFamilies(families) {
+		if line, ok := influxLine(sample, ts); ok {
+			result = append(result, line)
+		}
+	}
+
+	return result
+}
+
+type influxOpts struct {
+	log *zap.Logger
+
+	// Write endpoint including query parameters, e.g.
+	// "http://localhost:8086/write?db=luxws".
+	url string
+
+	// Token sent in the "Authorization" header if not empty.
+	token string
+
+	// Maximum number of lines kept while the endpoint is unavailable. The
+	// oldest lines are dropped first.
+	bufferSize int
+}
+
+// influxSink writes metrics to an endpoint accepting the InfluxDB line
+// protocol, e.g. InfluxDB or VictoriaMetrics.
+type influxSink struct {
+	log        *zap.Logger
+	httpDo     func(req *http.Request) (*http.Response, error)
+	url        string
+	token      string
+	bufferSize int
+
+	mu      sync.Mutex
+	pending []string
+}
+
+func newInfluxSink(opts influxOpts) *influxSink {
+	return &influxSink{
+		log:        opts.log,
+		httpDo:     cleanhttp.DefaultClient().Do,
+		url:        opts.url,
+		token:      opts.token,
+		bufferSize: opts.bufferSize,
+	}
+}
+
+func (s *influxSink) name() string {
+	return "influx"
+}
+
+// push buffers the lines for the given metrics and writes all buffered
+// lines. Lines are retained if writing fails and retried on the next push.
+func (s *influxSink) push(ctx context.Context, ts time.Time, families []*dto.MetricFamily) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pending = append(s.pending, influxLines(ts, families)...)
+
+	if s.bufferSize > 0 && len(s.pending) > s.bufferSize {
+		dropped := len(s.pending) - s.bufferSize
+
+		if s.log != nil {
+			s.log.Warn("Influx buffer full, dropping oldest lines", zap.Int("count", dropped))
+		}
+
+		s.pending = append([]string(nil), s.pending[dropped:]...)
+	}
+
+	for len(s.pending) > 0 {
+		n := min(len(s.pending), influxBatchSize)
+
+		retry, err := s.write(ctx, s.pending[:n])
+		if err != nil && retry {
+			return err
+		}
+
+		// Rejected data won't be accepted on retries either
+		s.pending = s.pending[n:]
+
+		if err != nil {
+			return err
+		}
+	}
+
+	s.pending = nil
+
+	return nil
+}
+
+func (s *influxSink) write(ctx context.Context, lines []string) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewBufferString(strings.Join(lines, "\n")+"\n"))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	if s.token != "" {
+		req.Header.Set("Authorization", "Token "+s.token)
+	}
+
+	resp, err := s.httpDo(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("%s %s: HTTP status %s: %s", req.Method, req.URL.Redacted(), resp.Status, bytes.TrimSpace(body))
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func gatherTestFamilies(t *testing.T, collect func(c *collector, ch chan<- prometheus.Metric)) []*dto.MetricFamily {
+	t.Helper()
+
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+	})
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(&adapter{
+		c: c,
+		collect: func(ch chan<- prometheus.Metric) error {
+			collect(c, ch)
+			return nil
+		},
+	})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return families
+}
+
+func TestInfluxLines(t *testing.T) {
+	families := gatherTestFamilies(t, func(c *collector, ch chan<- prometheus.Metric) {
+		ch <- prometheus.MustNewConstMetric(c.temperatureDesc, prometheus.GaugeValue, 3.1, "outdoor temp. ø", "degC")
+		ch <- prometheus.MustNewConstMetric(c.latestErrorDesc, prometheus.GaugeValue, 0, "")
+		ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, 1, "a=b,c")
+		ch <- (&histogramState{Count: 2, Sum: 90, Counts: []uint64{1, 2}}).metric(c.compressorRunDesc, []float64{60, 180})
+	})
+
+	got := influxLines(time.Unix(1725203567, 0), families)
+
+	if diff := cmp.Diff([]string{
+		"luxws_compressor_run_duration_seconds_count value=2 1725203567000000000",
+		"luxws_compressor_run_duration_seconds_sum value=90 1725203567000000000",
+		"luxws_compressor_run_duration_seconds_bucket,le=60 value=1 1725203567000000000",
+		"luxws_compressor_run_duration_seconds_bucket,le=180 value=2 1725203567000000000",
+		"luxws_compressor_run_duration_seconds_bucket,le=+Inf value=2 1725203567000000000",
+		"luxws_latest_error value=0 1725203567000000000",
+		"luxws_temperature,name=outdoor\\ temp.\\ ø,unit=degC value=3.1 1725203567000000000",
+		"luxws_up,reason=a\\=b\\,c value=1 1725203567000000000",
+	}, got); diff != "" {
+		t.Errorf("influxLines() diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestInfluxSinkPush(t *testing.T) {
+	var mu sync.Mutex
+	var received []string
+	var auth []string
+
+	failures := 1
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		if failures > 0 {
+			failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		body, _ := io.ReadAll(r.Body)
+
+		received = append(received, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		auth = append(auth, r.Header.Get("Authorization"))
+
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(srv.Close)
+
+	s := newInfluxSink(influxOpts{
+		url:        srv.URL + "/write?db=luxws",
+		token:      "secret",
+		bufferSize: 10,
+	})
+
+	push := func(value float64, ts int64) error {
+		return s.push(context.Background(), time.Unix(ts, 0), gatherTestFamilies(t, func(c *collector, ch chan<- prometheus.Metric) {
+			ch <- prometheus.MustNewConstMetric(c.temperatureDesc, prometheus.GaugeValue, value, "flow", "degC")
+		}))
+	}
+
+	if err := push(30, 1); err == nil {
+		t.Errorf("push() succeeded despite unavailable endpoint")
+	}
+
+	if err := push(31, 2); err != nil {
+		t.Errorf("push() failed: %v", err)
+	}
+
+	if diff := cmp.Diff([]string{
+		"luxws_temperature,name=flow,unit=degC value=30 1000000000",
+		"luxws_temperature,name=flow,unit=degC value=31 2000000000",
+	}, received); diff != "" {
+		t.Errorf("Received lines diff (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"Token secret"}, auth); diff != "" {
+		t.Errorf("Authorization diff (-want +got):\n%s", diff)
+	}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	journalKindError     = "error"
+	journalKindSwitchOff = "switchoff"
+)
+
+// Error reasons end with a numeric code in parentheses, e.g.
+// "max. outdoor temp. (718)".
+var journalCodeRe = regexp.MustCompile(`^(.*?)\s*\((\d+)\)$`)
+
+// journalEntry is a single row of the error memory or the list of switch-offs.
+type journalEntry struct {
+	Kind      string    `json:"kind"`
+	Time      time.Time `json:"time"`
+	Reason    string    `json:"reason"`
+	Code      string    `json:"code,omitempty"`
+	FirstSeen time.Time `json:"first_seen"`
+}
+
+func (e journalEntry) key() string {
+	return strings.Join([]string{e.Kind, e.Time.UTC().Format(time.RFC3339), e.Reason, e.Code}, "\x00")
+}
+
+// journalCount is the number of entries seen for a kind, reason and code.
+type journalCount struct {
+	Kind   string  `json:"kind"`
+	Reason string  `json:"reason"`
+	Code   string  `json:"code"`
+	Count  float64 `json:"count"`
+}
+
+// journalState keeps entries beyond the controller's ring buffer of five
+// entries per kind.
+type journalState struct {
+	// Whether entries have been imported before. Entries present on the
+	// controller at the first import are not new to the user.
+	Initialized bool `json:"initialized,omitempty"`
+
+	Entries []journalEntry           `json:"entries,omitempty"`
+	Counts  map[string]*journalCount `json:"counts,omitempty"`
+
+	// Keys of the entries in the most recent listing of each kind. Entries
+	// may have been removed from the retained entries while still being
+	// listed by the controller.
+	Seen map[string][]string `json:"seen,omitempty"`
+}
+
+// splitReasonCode separates the numeric code from an error reason.
+func splitReasonCode(text string) (string, string) {
+	if m := journalCodeRe.FindStringSubmatch(text); m != nil {
+		return m[1], m[2]
+	}
+
+	return text, ""
+}
+
+// timetableEntries returns all rows of a timetable group with a timestamp.
+// The rows are recorded as contributing to the metrics of descs.
+func (c *collector) timetableEntries(env *luxwscollect.Env, group *luxwsclient.ContentItem, descs ...*prometheus.Desc) ([]journalEntry, error) {
+	var result []journalEntry
+	var names []string
+
+	for _, item := range group.Items {
+		tsRaw := normalizeSpace(item.Name)
+
+		if item.Value == nil || strings.Trim(tsRaw, "-") == "" {
+			continue
+		}
+
+		ts, err := c.terms.ParseTimestamp(tsRaw, c.loc)
+		if err != nil {
+			env.Outcomes.ParseError(group.Name, item.Name, err)
+			return nil, err
+		}
+
+		result = append(result, journalEntry{
+			Time:   ts,
+			Reason: normalizeSpace(*item.Value),
+		})
+		names = append(names, item.Name)
+	}
+
+	for _, name := range names {
+		c.recordItem(env, group.Name, name, descs...)
+	}
+
+	return result, nil
+}
+
+// addJournalEntries stores entries not seen before. The journal is limited to
+// maxEntries with the oldest entries being removed first. Newly added entries
+// are returned together with whether they are from the initial import.
+func (s *stateStore) addJournalEntries(entries []journalEntry, maxEntries int) ([]journalEntry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st := &s.data.Journal
+
+	initial := !st.Initialized && len(st.Entries) == 0
+
+	if !st.Initialized {
+		st.Initialized = true
+		s.dirty = true
+	}
+
+	known := make(map[string]bool, len(st.Entries))
+
+	for _, e := range st.Entries {
+		known[e.key()] = true
+	}
+
+	for _, keys := range st.Seen {
+		for _, key := range keys {
+			known[key] = true
+		}
+	}
+
+	listed := map[string][]string{}
+
+	var added []journalEntry
+
+	for _, e := range entries {
+		key := e.key()
+
+		listed[e.Kind] = append(listed[e.Kind], key)
+
+		if known[key] {
+			continue
+		}
+
+		known[key] = true
+		added = append(added, e)
+
+		if st.Counts == nil {
+			st.Counts = map[string]*journalCount{}
+		}
+
+		countKey := strings.Join([]string{e.Kind, e.Reason, e.Code}, "\x00")
+
+		cnt := st.Counts[countKey]
+		if cnt == nil {
+			cnt = &journalCount{Kind: e.Kind, Reason: e.Reason, Code: e.Code}
+			st.Counts[countKey] = cnt
+		}
+
+		cnt.Count++
+	}
+
+	for kind, keys := range listed {
+		if !slices.Equal(st.Seen[kind], keys) {
+			if st.Seen == nil {
+				st.Seen = map[string][]string{}
+			}
+
+			st.Seen[kind] = keys
+			s.dirty = true
+		}
+	}
+
+	if len(added) == 0 {
+		return nil, initial
+	}
+
+	st.Entries = append(st.Entries, added...)
+
+	sort.SliceStable(st.Entries, func(a, b int) bool {
+		return st.Entries[a].Time.Before(st.Entries[b].Time)
+	})
+
+	if maxEntries > 0 && len(st.Entries) > maxEntries {
+		st.Entries = append([]journalEntry(nil), st.Entries[len(st.Entries)-maxEntries:]...)
+	}
+
+	s.dirty = true
+
+	return added, initial
+}
+
+// journalEntries returns a copy of all journal entries, newest first.
+func (s *stateStore) journalEntries() []journalEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]journalEntry, 0, len(s.data.Journal.Entries))
+
+	for i := len(s.data.Journal.Entries) - 1; i >= 0; i-- {
+		result = append(result, s.data.Journal.Entries[i])
+	}
+
+	return result
+}
+
+func (s *stateStore) eachJournalCount(fn func(journalCount)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, cnt := range s.data.Journal.Counts {
+		fn(*cnt)
+	}
+}
+
+func (c *collector) collectJournal(env *luxwscollect.Env, ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	var entries []journalEntry
+
+	now := c.now()
+
+	for _, i := range []struct {
+		kind      string
+		groupName string
+	}{
+		{journalKindError, c.terms.NavErrorMemory},
+		{journalKindSwitchOff, c.terms.NavSwitchOffs},
+	} {
+		// Missing groups and unparseable timestamps are reported by the
+		// collectors for the latest entries.
+		group, err := content.FindByName(luxwsclient.CmpName(i.groupName))
+		if err != nil {
+			continue
+		}
+
+		groupEntries, err := c.timetableEntries(env, group, c.journalEventsDesc)
+		if err != nil {
+			continue
+		}
+
+		for _, e := range groupEntries {
+			e.Kind = i.kind
+			e.Reason, e.Code = splitReasonCode(e.Reason)
+			e.FirstSeen = now
+			entries = append(entries, e)
+		}
+	}
+
+	if added, initial := c.state.addJournalEntries(entries, c.journalMaxEntries); !initial {
+		for _, e := range added {
+			c.notifier.notify(journalNotification(e))
+		}
+	}
+
+	c.state.eachJournalCount(func(cnt journalCount) {
+		ch <- prometheus.MustNewConstMetric(c.journalEventsDesc, prometheus.CounterValue, cnt.Count, cnt.Kind, cnt.Reason, cnt.Code)
+	})
+
+	return nil
+}
+
+// handleEvents serves the journal as JSON.
+func (c *collector) handleEvents(w http.ResponseWriter, r *http.Request) {
+	entries := c.state.journalEntries()
+
+	if kind := r.URL.Query().Get("kind"); kind != "" {
+		filtered := entries[:0]
+
+		for _, e := range entries {
+			if e.Kind == kind {
+				filtered = append(filtered, e)
+			}
+		}
+
+		entries = filtered
+	}
+
+	writeJSON(w, http.StatusOK, struct {
+		Events []journalEntry `json:"events"`
+	}{entries})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestSplitReasonCode(t *testing.T) {
+	for _, tc := range []struct {
+		input      string
+		wantReason string
+		wantCode   string
+	}{
+		{input: ""},
+		{input: "no requ.", wantReason: "no requ."},
+		{input: "max. outdoor temp. (718)", wantReason: "max. outdoor temp.", wantCode: "718"},
+		{input: "Wärmepumpe Störung(701)", wantReason: "Wärmepumpe Störung", wantCode: "701"},
+		{input: "(x) test", wantReason: "(x) test"},
+	} {
+		t.Run(tc.input, func(t *testing.T) {
+			reason, code := splitReasonCode(tc.input)
+
+			if diff := cmp.Diff([]string{tc.wantReason, tc.wantCode}, []string{reason, code}); diff != "" {
+				t.Errorf("splitReasonCode() diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestStateStoreAddJournalEntries(t *testing.T) {
+	s, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)
+
+	entry := func(hour int, reason string) journalEntry {
+		return journalEntry{
+			Kind:   journalKindSwitchOff,
+			Time:   base.Add(time.Duration(hour) * time.Hour),
+			Reason: reason,
+		}
+	}
+
+	if got, _ := s.addJournalEntries([]journalEntry{entry(1, "a"), entry(2, "b")}, 3); len(got) != 2 {
+		t.Errorf("addJournalEntries() returned %d entries, want 2", len(got))
+	}
+
+	// Repeated poll
+	if got, _ := s.addJournalEntries([]journalEntry{entry(1, "a"), entry(2, "b")}, 3); len(got) != 0 {
+		t.Errorf("addJournalEntries() returned %d entries, want none", len(got))
+	}
+
+	if got, _ := s.addJournalEntries([]journalEntry{entry(2, "b"), entry(3, "a"), entry(4, "a")}, 3); len(got) != 2 {
+		t.Errorf("addJournalEntries() returned %d entries, want 2", len(got))
+	}
+
+	if diff := cmp.Diff([]journalEntry{entry(4, "a"), entry(3, "a"), entry(2, "b")}, s.journalEntries()); diff != "" {
+		t.Errorf("journalEntries() diff (-want +got):\n%s", diff)
+	}
+
+	// Counts are retained when old entries are pruned
+	counts := map[string]float64{}
+
+	s.eachJournalCount(func(cnt journalCount) {
+		counts[cnt.Reason] = cnt.Count
+	})
+
+	if diff := cmp.Diff(map[string]float64{"a": 3, "b": 1}, counts); diff != "" {
+		t.Errorf("Counts diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestStateStoreAddJournalEntriesBelowControllerBuffer(t *testing.T) {
+	s, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	base := time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)
+
+	var listing []journalEntry
+
+	for i := range 5 {
+		listing = append(listing, journalEntry{
+			Kind:   journalKindError,
+			Time:   base.Add(time.Duration(i) * time.Hour),
+			Reason: "x",
+		})
+	}
+
+	if got, _ := s.addJournalEntries(listing, 2); len(got) != 5 {
+		t.Errorf("addJournalEntries() returned %d entries, want 5", len(got))
+	}
+
+	// Entries trimmed from the journal, but still listed by the controller,
+	// are not new
+	for range 3 {
+		if got, _ := s.addJournalEntries(listing, 2); len(got) != 0 {
+			t.Errorf("addJournalEntries() returned %d entries, want none", len(got))
+		}
+	}
+
+	if got := len(s.journalEntries()); got != 2 {
+		t.Errorf("journalEntries() returned %d entries, want 2", got)
+	}
+
+	s.eachJournalCount(func(cnt journalCount) {
+		if cnt.Count != 5 {
+			t.Errorf("Count for %q is %v, want 5", cnt.Reason, cnt.Count)
+		}
+	})
+}
+
+func TestCollectJournal(t *testing.T) {
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+	})
+
+	content := func(items ...*luxwsclient.ContentItem) *luxwsclient.ContentRoot {
+		return &luxwsclient.ContentRoot{
+			Items: luxwsclient.ContentItems{
+				{
+					Name:  "error memory",
+					Items: items,
+				},
+				{
+					Name: "switch offs",
+					Items: luxwsclient.ContentItems{
+						{Name: "01.09.24 10:00:00", Value: luxwsclient.String("no requ.")},
+					},
+				},
+			},
+		}
+	}
+
+	// The controller only keeps a few entries; older ones disappear
+	for _, i := range []*luxwsclient.ContentRoot{
+		content(
+			&luxwsclient.ContentItem{Name: "01.09.24 15:12:47", Value: luxwsclient.String("max. outdoor temp. (718)")},
+		),
+		content(
+			&luxwsclient.ContentItem{Name: "02.09.24 08:00:00", Value: luxwsclient.String("max. outdoor temp. (718)")},
+			&luxwsclient.ContentItem{Name: "03.09.24 09:30:00", Value: luxwsclient.String("low pressure (705)")},
+		),
+	} {
+		ch := make(chan prometheus.Metric, 16)
+
+		if err := c.collectJournal(testEnv(quirks{}), ch, i); err != nil {
+			t.Errorf("collectJournal() failed: %v", err)
+		}
+	}
+
+	a := &adapter{
+		c:           c,
+		metricNames: []string{"luxws_journal_events_total"},
+		collect: func(ch chan<- prometheus.Metric) error {
+			return c.collectJournal(testEnv(quirks{}), ch, content())
+		},
+	}
+	a.collectAndCompare(t, `
+# HELP luxws_journal_events_total Number of error memory and switch-off entries seen
+# TYPE luxws_journal_events_total counter
+luxws_journal_events_total{code="",kind="switchoff",reason="no requ."} 1
+luxws_journal_events_total{code="705",kind="error",reason="low pressure"} 1
+luxws_journal_events_total{code="718",kind="error",reason="max. outdoor temp."} 2
+`, nil)
+
+	rec := httptest.NewRecorder()
+	c.handleEvents(rec, httptest.NewRequest("GET", "/api/events?kind=error", nil))
+
+	var got struct {
+		Events []journalEntry `json:"events"`
+	}
+
+	if err := json.NewDecoder(rec.Body).Decode(&got); err != nil {
+		t.Fatalf("Decoding response failed: %v", err)
+	}
+
+	var reasons []string
+
+	for _, e := range got.Events {
+		reasons = append(reasons, e.Time.Format(time.DateTime)+" "+e.Reason)
+	}
+
+	if diff := cmp.Diff([]string{
+		"2024-09-03 09:30:00 low pressure",
+		"2024-09-02 08:00:00 max. outdoor temp.",
+		"2024-09-01 15:12:47 max. outdoor temp.",
+	}, reasons); diff != "" {
+		t.Errorf("Events diff (-want +got):\n%s", diff)
+	}
+}
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/alecthomas/kingpin/v2"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
 	"github.com/hansmi/wp2reg-luxws/luxwslang"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/collectors"
@@ -29,6 +33,16 @@ var (
 	maxConcurrent          = kingpin.Flag("web.max-requests", "Maximum number of concurrent scrape requests").Default("3").Uint()
 )
 
+var (
+	serveCmd = kingpin.Command("serve", "Serve metrics via HTTP and push them to sinks (default)").Default()
+
+	dumpCmd    = kingpin.Command("dump", "Collect values once and write them to stdout or a file")
+	dumpFormat = dumpCmd.Flag("format",
+		fmt.Sprintf("Output format (one of %q)", dumpFormats)).Default("prometheus").Enum(dumpFormats...)
+	dumpOutput = dumpCmd.Flag("output",
+		"Write to file instead of stdout; replaced atomically, e.g. for the node_exporter textfile collector").Short('o').PlaceHolder("PATH").String()
+)
+
 var (
 	verbose = kingpin.Flag("verbose", "Log sent and received messages").Bool()
 	timeout = kingpin.Flag("scrape-timeout", "Maximum duration for a scrape").Default("1m").Duration()
@@ -38,14 +52,132 @@ var (
 	target = kingpin.Flag("controller.address",
 		`host:port for controller Websocket service (e.g. "192.0.2.1:8214")`).PlaceHolder("HOST:PORT").Required().String()
 	password = kingpin.Flag("controller.password",
-		`password for controller Websocket service`).String()
+		`password for controller Websocket service; visible in the process list, prefer --controller.password-file`).
+		Envar("LUXWS_EXPORTER_CONTROLLER_PASSWORD").String()
+	passwordFile = kingpin.Flag("controller.password-file",
+		`File containing the password for controller Websocket service; re-read on SIGHUP`).PlaceHolder("PATH").String()
 	httpTarget = kingpin.Flag("controller.address.http",
 		`host:port for controller HTTP service; used to retrieve time (e.g. "192.0.2.1:80")`).PlaceHolder("HOST:PORT").String()
 )
 
+var stateFile = kingpin.Flag("state.file",
+	"File for persisting state across restarts, e.g. the most recent counter values").PlaceHolder("PATH").String()
+
+var counterResetThreshold = kingpin.Flag("counter.reset-threshold",
+	"Decreases of counters by more than this fraction of the previous value are treated as a reset; smaller decreases retain the previous value; greater than 0 and at most 1").Default("0.5").Float64()
+
+var copWindows = kingpin.Flag("cop.window",
+	`Time window for seasonal COP values (e.g. "30d"); can be repeated. A window is only reported once the recorded history covers it, e.g. a year after the first start or after losing the state file for "365d"`).Default("7d", "30d", "365d").Strings()
+
+var (
+	estimateSuppliedHeat = kingpin.Flag("estimate.supplied-heat",
+		`Estimate heat output from flow rate and flow/return temperatures ("auto" for heat pumps without heat meter)`).
+		Default(string(estimateAuto)).Enum(string(estimateAuto), string(estimateAlways), string(estimateNever))
+	fluidDensity = kingpin.Flag("estimate.fluid-density",
+		"Density of the heat transfer fluid in kg/l").Default("1.0").Float64()
+	fluidHeatCapacity = kingpin.Flag("estimate.fluid-heat-capacity",
+		"Specific heat capacity of the heat transfer fluid in kJ/(kg·K)").Default("4.18").Float64()
+)
+
+var (
+	compressorMinRunTime = kingpin.Flag("compressor.min-run-time",
+		"Compressor runs shorter than this duration are considered short cycling").Default("10m").Duration()
+	compressorMaxStartsPerHour = kingpin.Flag("compressor.max-starts-per-hour",
+		"More compressor starts per hour are considered short cycling (0 to disable)").Default("3").Float64()
+)
+
+var journalMaxEntries = kingpin.Flag("journal.max-entries",
+	"Maximum number of error memory and switch-off entries to retain").Default("1000").Int()
+
+var (
+	notifyURLs = kingpin.Flag("notify.url",
+		"Send notifications about new errors, switch-offs and operation mode changes to URL; "+
+			"prefix with \"ntfy+\" or \"gotify+\" for the respective format (repeatable)").PlaceHolder("URL").Strings()
+	notifyRetries = kingpin.Flag("notify.retries",
+		"Number of retries for failed notifications").Default("3").Int()
+	notifyBackoff = kingpin.Flag("notify.retry-delay",
+		"Delay before retrying a failed notification; doubled for every retry").Default("5s").Duration()
+)
+
+var (
+	pollInterval = kingpin.Flag("poll.interval",
+		"Interval for polling the controller when pushing values; also the expected scrape interval for readiness").Default("1m").Duration()
+	readyIntervals = kingpin.Flag("health.ready-intervals",
+		"Report as not ready if the controller wasn't reached successfully within this many poll intervals").Default("3").Int()
+)
+
+var (
+	mqttBroker = kingpin.Flag("mqtt.broker",
+		"Publish values to MQTT broker (e.g. tcp://localhost:1883)").PlaceHolder("URL").String()
+	mqttClientID = kingpin.Flag("mqtt.client-id",
+		"MQTT client ID").Default("luxws-exporter").String()
+	mqttUsername = kingpin.Flag("mqtt.username",
+		"MQTT username").String()
+	mqttPassword = kingpin.Flag("mqtt.password",
+		"MQTT password").String()
+	mqttTopicPrefix = kingpin.Flag("mqtt.topic-prefix",
+		"Prefix for MQTT state topics").Default("luxws").String()
+	mqttDiscoveryPrefix = kingpin.Flag("mqtt.discovery-prefix",
+		"Prefix for Home Assistant MQTT discovery messages (empty to disable)").Default("homeassistant").String()
+)
+
+var (
+	influxURL = kingpin.Flag("influx.url",
+		"Write values in InfluxDB line protocol to URL (e.g. http://localhost:8086/write?db=luxws)").PlaceHolder("URL").String()
+	influxToken = kingpin.Flag("influx.token",
+		"Token for authenticating InfluxDB writes").String()
+	influxBufferSize = kingpin.Flag("influx.buffer-size",
+		"Maximum number of lines kept while the InfluxDB endpoint is unavailable").Default("100000").Int()
+)
+
+var (
+	remoteWriteURL = kingpin.Flag("remote-write.url",
+		"Push values to Prometheus remote-write endpoint").PlaceHolder("URL").String()
+	remoteWriteBearerToken = kingpin.Flag("remote-write.bearer-token",
+		"Bearer token for the remote-write endpoint").String()
+	remoteWriteWALDir = kingpin.Flag("remote-write.wal-dir",
+		"Directory for buffering samples while the remote-write endpoint is unavailable (in memory if empty)").String()
+	remoteWriteWALMaxSize = kingpin.Flag("remote-write.wal-max-size",
+		"Maximum size of buffered remote-write samples").Default("256MB").Bytes()
+)
+
+var (
+	controlParams = kingpin.Flag("control.param",
+		`Allow changing parameter by its path of names via the control API, e.g. "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll" (repeatable)`).PlaceHolder("PATH").Strings()
+	controlTokensFile = kingpin.Flag("control.tokens-file",
+		`File with control API tokens in the format "<user>:<token>", one per line`).PlaceHolder("PATH").String()
+	controlAuditLog = kingpin.Flag("control.audit-log",
+		"Append control API changes as JSON lines to file").PlaceHolder("PATH").String()
+	controlDryRun = kingpin.Flag("control.dry-run",
+		"Validate control API changes without applying them").Bool()
+)
+
+var collectorFlags = func() map[string]*bool {
+	result := map[string]*bool{}
+
+	for _, i := range builtinModules {
+		if !i.required {
+			result[i.name] = kingpin.Flag("collector."+i.name,
+				fmt.Sprintf("Enable the %s collector: %s", i.name, i.help)).Default("true").Bool()
+		}
+	}
+
+	for _, m := range luxwscollect.Modules() {
+		if _, ok := result[m.Name()]; !ok {
+			result[m.Name()] = kingpin.Flag("collector."+m.Name(),
+				fmt.Sprintf("Enable the %s collector module", m.Name())).Default("true").Bool()
+		}
+	}
+
+	return result
+}()
+
 var timezone = kingpin.Flag("controller.timezone",
 	"Timezone for parsing timestamps").Default(time.Local.String()).String()
 
+var quirksFile = kingpin.Flag("controller.quirks-file",
+	"YAML file with additional or replacement entries for the quirks database").PlaceHolder("PATH").String()
+
 var lang = kingpin.Flag("controller.language",
 	fmt.Sprintf("Controller interface language (one of %q)", supportedLanguages())).PlaceHolder("NAME").Required().String()
 
@@ -59,11 +191,25 @@ func supportedLanguages() []string {
 	return result
 }
 
+// reloadOnSignal re-reads the password file whenever SIGHUP is received.
+func reloadOnSignal(log *zap.Logger, passwords *passwordSource) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGHUP)
+
+	for range ch {
+		if err := passwords.reload(); err != nil {
+			log.Error("Reloading password failed", zap.Error(err))
+		} else {
+			log.Info("Reloaded password")
+		}
+	}
+}
+
 func main() {
 	promslogConfig := &promslog.Config{}
 	promslogflag.AddFlags(kingpin.CommandLine, promslogConfig)
 
-	kingpin.Parse()
+	cmd := kingpin.Parse()
 
 	//var zapOpts []zap.Option
 	//if *verbose {
@@ -82,9 +228,16 @@ func main() {
 	if *verbose {
 		zapLvl = zap.DebugLevel
 	}
+
+	// Dumps may be written to stdout
+	logOutput := os.Stdout
+	if cmd == dumpCmd.FullCommand() {
+		logOutput = os.Stderr
+	}
+
 	zaplog := zap.New(zapcore.NewCore(
 		zapcore.NewJSONEncoder(zapencCfg),
-		zapcore.AddSync(os.Stdout),
+		zapcore.AddSync(logOutput),
 		zapLvl,
 	))
 	// zaplog.WithOptions(zapOpts...)
@@ -94,9 +247,35 @@ func main() {
 		maxConcurrent: int64(*maxConcurrent),
 		timeout:       *timeout,
 		address:       *target,
-		password:      *password,
 		httpAddress:   *httpTarget,
 		log:           zaplog,
+
+		counterResetRatio: *counterResetThreshold,
+		estimateMode:      estimateMode(*estimateSuppliedHeat),
+		fluid: fluidParams{
+			density:      *fluidDensity,
+			heatCapacity: *fluidHeatCapacity,
+		},
+		compressorLimits: compressorLimits{
+			minRunTime:       *compressorMinRunTime,
+			maxStartsPerHour: *compressorMaxStartsPerHour,
+		},
+		journalMaxEntries: *journalMaxEntries,
+		modules:           luxwscollect.Modules(),
+	}
+
+	if err := checkModules(opts.modules); err != nil {
+		zaplog.Fatal("Invalid collector module", zap.Error(err))
+	}
+
+	for name, enabled := range collectorFlags {
+		if !*enabled {
+			if opts.disabledCollectors == nil {
+				opts.disabledCollectors = map[string]bool{}
+			}
+
+			opts.disabledCollectors[name] = true
+		}
 	}
 
 	if loc, err := time.LoadLocation(*timezone); err != nil {
@@ -111,8 +290,130 @@ func main() {
 		opts.terms = terms
 	}
 
+	if *counterResetThreshold <= 0 || *counterResetThreshold > 1 {
+		zaplog.Fatal("Counter reset threshold must be greater than 0 and at most 1", zap.Float64p("threshold", counterResetThreshold))
+	}
+
+	if windows, err := parseCOPWindows(*copWindows); err != nil {
+		zaplog.Fatal("Parsing COP windows", zap.Error(err))
+	} else {
+		opts.copWindows = windows
+	}
+
+	if state, err := newStateStore(*stateFile); err != nil {
+		zaplog.Fatal("Loading state", zap.Error(err), zap.Stringp("file", stateFile))
+	} else {
+		opts.state = state
+	}
+
+	if passwords, err := newPasswordSource(*password, *passwordFile); err != nil {
+		zaplog.Fatal("Loading password", zap.Error(err), zap.Stringp("file", passwordFile))
+	} else {
+		opts.passwordSource = passwords
+
+		if *passwordFile != "" {
+			go reloadOnSignal(zaplog, passwords)
+		}
+	}
+
+	if db, err := loadQuirksDB(*quirksFile); err != nil {
+		zaplog.Fatal("Loading quirks", zap.Error(err), zap.Stringp("file", quirksFile))
+	} else {
+		opts.quirks = db
+	}
+
+	nOpts := notifierOpts{
+		log:     zaplog,
+		retries: *notifyRetries,
+		backoff: *notifyBackoff,
+	}
+
+	for _, value := range *notifyURLs {
+		if t, err := parseNotifyTarget(value); err != nil {
+			zaplog.Fatal("Parsing notification target", zap.Error(err))
+		} else {
+			nOpts.targets = append(nOpts.targets, t)
+		}
+	}
+
+	if opts.notifier = newNotifier(nOpts); opts.notifier != nil {
+		go opts.notifier.run(context.Background())
+	}
+
+	c := newCollector(opts)
+
+	if cmd == dumpCmd.FullCommand() {
+		if err := dump(c, time.Now(), *dumpFormat, *dumpOutput); err != nil {
+			zaplog.Fatal("Dump failed", zap.Error(err))
+		}
+
+		return
+	}
+
 	reg := prometheus.NewPedanticRegistry()
-	reg.MustRegister(newCollector(opts))
+
+	var sinks []pushSink
+
+	if *mqttBroker != "" {
+		sink, err := newMQTTSink(mqttOpts{
+			log:             zaplog,
+			broker:          *mqttBroker,
+			clientID:        *mqttClientID,
+			username:        *mqttUsername,
+			password:        *mqttPassword,
+			topicPrefix:     *mqttTopicPrefix,
+			discoveryPrefix: *mqttDiscoveryPrefix,
+		})
+		if err != nil {
+			zaplog.Fatal("Setting up MQTT", zap.Error(err))
+		}
+
+		sinks = append(sinks, sink)
+	}
+
+	if *influxURL != "" {
+		sinks = append(sinks, newInfluxSink(influxOpts{
+			log:        zaplog,
+			url:        *influxURL,
+			token:      *influxToken,
+			bufferSize: *influxBufferSize,
+		}))
+	}
+
+	if *remoteWriteURL != "" {
+		sinks = append(sinks, newRemoteWriteSink(remoteWriteOpts{
+			log:         zaplog,
+			url:         *remoteWriteURL,
+			bearerToken: *remoteWriteBearerToken,
+			walDir:      *remoteWriteWALDir,
+			walMaxSize:  int64(*remoteWriteWALMaxSize),
+		}))
+	}
+
+	if len(sinks) > 0 {
+		// Scrapes are served from the most recent poll to not collect
+		// concurrently.
+		cache := newMetricsCache(c)
+		reg.MustRegister(cache)
+
+		// Only controller values are pushed
+		pollReg := prometheus.NewRegistry()
+		pollReg.MustRegister(cache)
+
+		p := &poller{
+			log:      zaplog,
+			cache:    cache,
+			gatherer: pollReg,
+			interval: *pollInterval,
+			timeout:  *timeout,
+			sinks:    sinks,
+		}
+
+		go p.run(context.Background())
+	} else {
+		reg.MustRegister(c)
+	}
+
 	if !*disableExporterMetrics {
 		reg.MustRegister(
 			collectors.NewBuildInfoCollector(),
@@ -123,15 +424,49 @@ func main() {
 	}
 
 	http.Handle(*metricsPath, promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-			<head><title>LuxWS Exporter</title></head>
-			<body>
-			<h1>LuxWS Exporter</h1>
-			<p><a href="` + *metricsPath + `">Metrics</a></p>
-			</body>
-			</html>`))
-	})
+	c.registerAPI(http.DefaultServeMux)
+	c.registerDebug(http.DefaultServeMux)
+	c.registerHealth(http.DefaultServeMux, time.Duration(*readyIntervals)*(*pollInterval))
+	http.Handle("/", newUIHandler(*metricsPath))
+
+	if len(*controlParams) > 0 {
+		cOpts := controlOpts{
+			log:    zaplog,
+			params: *controlParams,
+			dryRun: *controlDryRun,
+		}
+
+		if *controlTokensFile == "" {
+			zaplog.Fatal("Control API requires --control.tokens-file")
+		} else if fh, err := os.Open(*controlTokensFile); err != nil {
+			zaplog.Fatal("Opening control tokens", zap.Error(err))
+		} else {
+			cOpts.tokens, err = parseControlTokens(fh)
+			fh.Close()
+
+			if err != nil {
+				zaplog.Fatal("Reading control tokens", zap.Error(err), zap.Stringp("file", controlTokensFile))
+			}
+		}
+
+		if *controlAuditLog != "" {
+			fh, err := os.OpenFile(*controlAuditLog, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+			if err != nil {
+				zaplog.Fatal("Opening control audit log", zap.Error(err))
+			}
+
+			defer fh.Close()
+
+			cOpts.audit = fh
+		}
+
+		a, err := newControlAPI(c, cOpts)
+		if err != nil {
+			zaplog.Fatal("Control API setup failed", zap.Error(err))
+		}
+
+		a.register(http.DefaultServeMux)
+	}
 
 	server := &http.Server{}
 
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+)
+
+// fetchedPage holds a page other than the information page retrieved for
+// the enabled modules.
+type fetchedPage struct {
+	content *luxwsclient.ContentRoot
+	err     error
+}
+
+// newModuleRegistry returns a registry with the built-in collectors followed
+// by modules.
+func newModuleRegistry(c *collector, modules []luxwscollect.Module) (*luxwscollect.Registry, error) {
+	r := luxwscollect.NewRegistry()
+
+	for _, b := range builtinModules {
+		b.c = c
+		r.MustRegister(&b)
+	}
+
+	for _, m := range modules {
+		if err := r.Register(m); err != nil {
+			return nil, err
+		}
+	}
+
+	return r, nil
+}
+
+// checkModules verifies that module names are valid and don't conflict with
+// built-in collectors or each other.
+func checkModules(modules []luxwscollect.Module) error {
+	_, err := newModuleRegistry(nil, modules)
+
+	return err
+}
+
+// enabledModules returns the modules not disabled via options. Required
+// modules are always enabled.
+func (c *collector) enabledModules() []luxwscollect.Module {
+	var result []luxwscollect.Module
+
+	for _, m := range c.modules.Modules() {
+		if !c.disabledCollectors[m.Name()] || moduleRequired(m) {
+			result = append(result, m)
+		}
+	}
+
+	return result
+}
+
+func (c *collector) isInformationPage(path []string) bool {
+	return len(path) == 1 && path[0] == c.terms.NavInformation
+}
+
+func pageKey(path []string) string {
+	return strings.Join(path, "\x00")
+}
+
+// fetchModulePages retrieves the pages other than the information page
+// required by the enabled modules. Each page is fetched at most once.
+func (c *collector) fetchModulePages(ctx context.Context, cl *luxwsclient.Client, nav *luxwsclient.NavRoot) map[string]fetchedPage {
+	result := map[string]fetchedPage{}
+	byID := map[string]fetchedPage{}
+
+	get := func(path []string) fetchedPage {
+		page, rest := nav.FindPath(path)
+		if page == nil || len(rest) > 0 {
+			return fetchedPage{err: fmt.Errorf("page %q: %w", path, luxwsclient.ErrNavItemNotFound)}
+		}
+
+		if p, ok := byID[page.ID]; ok {
+			return p
+		}
+
+		var p fetchedPage
+
+		if p.content, p.err = cl.Get(ctx, page.ID); p.err != nil {
+			p.err = fmt.Errorf("fetching ID %q failed: %w", page.ID, p.err)
+		}
+
+		byID[page.ID] = p
+
+		return p
+	}
+
+	for _, m := range c.enabledModules() {
+		for _, path := range m.Pages(c.terms) {
+			if c.isInformationPage(path) {
+				continue
+			}
+
+			if _, ok := result[pageKey(path)]; !ok {
+				result[pageKey(path)] = get(path)
+			}
+		}
+	}
+
+	return result
+}
+
+// modulePages returns the pages of a module in the order given by its Pages
+// method.
+func (c *collector) modulePages(m luxwscollect.Module, info *luxwsclient.ContentRoot, fetched map[string]fetchedPage) ([]*luxwsclient.ContentRoot, error) {
+	var result []*luxwsclient.ContentRoot
+
+	for _, path := range m.Pages(c.terms) {
+		if c.isInformationPage(path) {
+			result = append(result, info)
+			continue
+		}
+
+		p, ok := fetched[pageKey(path)]
+		if !ok {
+			return nil, fmt.Errorf("page %q not retrieved", path)
+		}
+
+		if p.err != nil {
+			return nil, p.err
+		}
+
+		result = append(result, p.content)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+var testModuleItemsDesc = prometheus.NewDesc("test_module_items", "Number of items", []string{"module", "page"}, nil)
+
+type testModule struct {
+	name  string
+	pages [][]string
+}
+
+func (m *testModule) Name() string {
+	return m.name
+}
+
+func (m *testModule) Pages(*luxwslang.Terminology) [][]string {
+	return m.pages
+}
+
+func (m *testModule) Describe(ch chan<- *prometheus.Desc) {
+	ch <- testModuleItemsDesc
+}
+
+func (m *testModule) Collect(env *luxwscollect.Env, ch chan<- prometheus.Metric, pages []*luxwsclient.ContentRoot) error {
+	if env.Quirks == nil || env.Terms == nil {
+		return errors.New("incomplete environment")
+	}
+
+	for idx, content := range pages {
+		page := m.pages[idx][len(m.pages[idx])-1]
+
+		ch <- prometheus.MustNewConstMetric(testModuleItemsDesc, prometheus.GaugeValue, float64(len(content.Items)), m.name, page)
+	}
+
+	return nil
+}
+
+func TestCheckModules(t *testing.T) {
+	if err := checkModules([]luxwscollect.Module{&testModule{name: "pool"}}); err != nil {
+		t.Errorf("checkModules() failed: %v", err)
+	}
+
+	if err := checkModules([]luxwscollect.Module{&testModule{name: "temperatures"}}); err == nil {
+		t.Errorf("checkModules() succeeded for conflicting module")
+	}
+}
+
+func TestCollectModules(t *testing.T) {
+	address, _ := newFakeController(t,
+		`<Navigation id="0x1"><item id="0x2"><name>information</name></item>`+
+			`<item id="0x3"><name>Settings</name><item id="0x4"><name>Pool</name></item></item></Navigation>`,
+		map[string]string{
+			"0x2": `<Content><item id="0x10"><name>system status</name></item><item id="0x11"><name>Temperatures</name></item></Content>`,
+			"0x4": `<Content><item id="0x20"><name>Pool</name></item><item id="0x21"><name>Timer</name></item></Content>`,
+		})
+
+	disabled := map[string]bool{"disabled": true}
+
+	for _, b := range builtinModules {
+		disabled[b.name] = true
+	}
+
+	c := newCollector(collectorOpts{
+		address: address,
+		terms:   luxwslang.English,
+		loc:     time.UTC,
+		timeout: time.Minute,
+		log:     zap.NewNop(),
+		modules: []luxwscollect.Module{
+			&testModule{name: "pool", pages: [][]string{{"information"}, {"Settings", "Pool"}}},
+			&testModule{name: "solar", pages: [][]string{{"Settings", "Solar"}}},
+			&testModule{name: "disabled", pages: [][]string{{"Settings", "Pool"}}},
+		},
+		disabledCollectors: disabled,
+	})
+
+	var pages map[string]fetchedPage
+
+	_, info, err := c.fetchInformation(context.Background(), nil, nil, func(cl *luxwsclient.Client, nav *luxwsclient.NavRoot, _ *luxwsclient.ContentRoot) {
+		pages = c.fetchModulePages(context.Background(), cl, nav)
+	})
+	if err != nil {
+		t.Fatalf("fetchInformation() failed: %v", err)
+	}
+
+	if err := pages[pageKey([]string{"Settings", "Solar"})].err; !errors.Is(err, luxwsclient.ErrNavItemNotFound) {
+		t.Errorf("Fetching pages of solar module returned %v, want %v", err, luxwsclient.ErrNavItemNotFound)
+	}
+
+	if len(pages) != 2 {
+		t.Errorf("Fetched %d pages, want 2", len(pages))
+	}
+
+	a := adapter{
+		c:           c,
+		metricNames: []string{"test_module_items", "luxws_collector_success"},
+		collect: func(ch chan<- prometheus.Metric) error {
+			return c.collectAll(ch, info, pages, nil)
+		},
+	}
+	a.collectAndCompare(t, `
+# HELP luxws_collector_success Whether a collector succeeded
+# TYPE luxws_collector_success gauge
+luxws_collector_success{collector="info"} 1
+luxws_collector_success{collector="pool"} 1
+luxws_collector_success{collector="solar"} 0
+# HELP test_module_items Number of items
+# TYPE test_module_items gauge
+test_module_items{module="pool",page="information"} 2
+test_module_items{module="pool",page="Pool"} 2
+`, nil)
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// mqttMapping describes how values of a metric are published.
+type mqttMapping struct {
+	group string
+
+	// Fixed name for metrics without a "name" label.
+	name string
+
+	// Fixed unit for metrics without a "unit" label.
+	unit string
+}
+
+// Metrics published via MQTT. The operation mode is handled separately.
+var mqttMappings = map[string]mqttMapping{
+	"luxws_temperature":                {group: "temperature"},
+	"luxws_input":                      {group: "input"},
+	"luxws_output":                     {group: "output"},
+	"luxws_operating_duration_seconds": {group: "operating_duration", unit: "s"},
+	"luxws_supplied_heat_cntr":         {group: "supplied_heat"},
+	"luxws_energy_input":               {group: "energy_input"},
+	"luxws_ss_heat_capacity":           {group: "status", name: "heat capacity"},
+	"luxws_ss_energy_input":            {group: "status", name: "power consumption"},
+}
+
+var mqttSlugRe = regexp.MustCompile(`[^a-z0-9]+`)
+
+// mqttSlug converts a name into a topic level.
+func mqttSlug(name string) string {
+	name = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss", "ø", "avg").Replace(strings.ToLower(name))
+
+	return strings.Trim(mqttSlugRe.ReplaceAllString(name, "_"), "_")
+}
+
+// haDevice is the device information in Home Assistant discovery messages.
+type haDevice struct {
+	Identifiers  []string `json:"identifiers"`
+	Name         string   `json:"name"`
+	Manufacturer string   `json:"manufacturer"`
+	Model        string   `json:"model,omitempty"`
+	SWVersion    string   `json:"sw_version,omitempty"`
+}
+
+// haConfig is a Home Assistant MQTT discovery config message.
+type haConfig struct {
+	Name              string   `json:"name"`
+	UniqueID          string   `json:"unique_id"`
+	StateTopic        string   `json:"state_topic"`
+	AvailabilityTopic string   `json:"availability_topic"`
+	DeviceClass       string   `json:"device_class,omitempty"`
+	StateClass        string   `json:"state_class,omitempty"`
+	Unit              string   `json:"unit_of_measurement,omitempty"`
+	PayloadOn         string   `json:"payload_on,omitempty"`
+	PayloadOff        string   `json:"payload_off,omitempty"`
+	Device            haDevice `json:"device"`
+}
+
+// haUnit returns the Home Assistant device class and unit for a unit
+// reported by the controller.
+func haUnit(unit string) (string, string) {
+	switch unit {
+	case "degC":
+		return "temperature", "°C"
+	case "kWh":
+		return "energy", "kWh"
+	case "kW", "W":
+		return "power", unit
+	case "V":
+		return "voltage", "V"
+	case "bar":
+		return "pressure", "bar"
+	case "Hz":
+		return "frequency", "Hz"
+	case "s":
+		return "duration", "s"
+	case "l/h":
+		return "", "L/h"
+	}
+
+	return "", unit
+}
+
+// mqttValue is a single value to be published.
+type mqttValue struct {
+	group   string
+	name    string
+	unit    string
+	counter bool
+	payload string
+}
+
+func (v mqttValue) component() string {
+	if v.unit == "bool" {
+		return "binary_sensor"
+	}
+
+	return "sensor"
+}
+
+// mqttValues extracts the values to publish from gathered metrics together
+// with the device information.
+func mqttValues(families []*dto.MetricFamily) ([]mqttValue, haDevice) {
+	var result []mqttValue
+	var device haDevice
+
+	for _, mf := range families {
+		switch mf.GetName() {
+		case "luxws_info":
+			for _, m := range mf.GetMetric() {
+				device.Model = familyLabel(m, "hptype")
+				device.SWVersion = familyLabel(m, "swversion")
+			}
+
+			continue
+
+		case "luxws_operational_mode":
+			for _, m := range mf.GetMetric() {
+				result = append(result, mqttValue{
+					group:   "status",
+					name:    "operation mode",
+					payload: familyLabel(m, "mode"),
+				})
+			}
+
+			continue
+		}
+
+		mapping, ok := mqttMappings[mf.GetName()]
+		if !ok {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			value, ok := familyValue(m)
+			if !ok {
+				continue
+			}
+
+			v := mqttValue{
+				group:   mapping.group,
+				name:    familyLabel(m, "name"),
+				unit:    familyLabel(m, "unit"),
+				counter: mf.GetType() == dto.MetricType_COUNTER,
+				payload: strconv.FormatFloat(value, 'f', -1, 64),
+			}
+
+			if v.name == "" {
+				v.name = mapping.name
+			}
+
+			if v.unit == "" {
+				v.unit = mapping.unit
+			}
+
+			if v.name == "" {
+				continue
+			}
+
+			result = append(result, v)
+		}
+	}
+
+	return result, device
+}
+
+type mqttOpts struct {
+	log      *zap.Logger
+	broker   string
+	clientID string
+	username string
+	password string
+
+	// Prefix for all state topics.
+	topicPrefix string
+
+	// Prefix for Home Assistant discovery messages. Discovery is disabled if
+	// empty.
+	discoveryPrefix string
+}
+
+// mqttSink publishes values to an MQTT broker.
+type mqttSink struct {
+	log             *zap.Logger
+	client          mqtt.Client
+	topicPrefix     string
+	discoveryPrefix string
+	nodeID          string
+
+	mu        sync.Mutex
+	announced map[string]string
+
+	// Most recently published availability.
+	availability string
+}
+
+func newMQTTSink(opts mqttOpts) (*mqttSink, error) {
+	s := &mqttSink{
+		log:             opts.log,
+		topicPrefix:     strings.TrimSuffix(opts.topicPrefix, "/"),
+		discoveryPrefix: strings.TrimSuffix(opts.discoveryPrefix, "/"),
+		nodeID:          mqttSlug(opts.topicPrefix),
+		announced:       map[string]string{},
+
+		// Values become available with the first successful poll
+		availability: "offline",
+	}
+
+	clientOpts := mqtt.NewClientOptions().
+		AddBroker(opts.broker).
+		SetClientID(opts.clientID).
+		SetUsername(opts.username).
+		SetPassword(opts.password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetWill(s.availabilityTopic(), "offline", 1, true).
+		SetOnConnectHandler(func(client mqtt.Client) {
+			// Retained messages may have been lost, e.g. after a broker
+			// restart.
+			s.mu.Lock()
+			s.announced = map[string]string{}
+			availability := s.availability
+			s.mu.Unlock()
+
+			client.Publish(s.availabilityTopic(), 1, true, availability)
+		})
+
+	s.client = mqtt.NewClient(clientOpts)
+
+	if token := s.client.Connect(); !token.WaitTimeout(time.Minute) {
+		// The client keeps trying in the background
+		s.log.Warn("Connection to MQTT broker not yet established", zap.String("broker", opts.broker))
+	} else if err := token.Error(); err != nil {
+		return nil, fmt.Errorf("connecting to MQTT broker %s: %w", opts.broker, err)
+	}
+
+	return s, nil
+}
+
+func (s *mqttSink) name() string {
+	return "mqtt"
+}
+
+func (s *mqttSink) availabilityTopic() string {
+	return s.topicPrefix + "/availability"
+}
+
+// mqttAvailability returns "offline" if the gathered metrics report a failed
+// scrape of the controller and "online" otherwise.
+func mqttAvailability(families []*dto.MetricFamily) string {
+	for _, mf := range families {
+		if mf.GetName() != "luxws_up" {
+			continue
+		}
+
+		for _, m := range mf.GetMetric() {
+			if value, ok := familyValue(m); ok && value == 0 {
+				return "offline"
+			}
+		}
+	}
+
+	return "online"
+}
+
+// publishAvailability publishes the availability if it changed.
+func (s *mqttSink) publishAvailability(ctx context.Context, availability string) error {
+	s.mu.Lock()
+	changed := s.availability != availability
+	s.mu.Unlock()
+
+	if !changed {
+		return nil
+	}
+
+	if err := s.publish(ctx, s.availabilityTopic(), true, availability); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.availability = availability
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *mqttSink) stateTopic(v mqttValue) string {
+	return strings.Join([]string{s.topicPrefix, v.group, mqttSlug(v.name)}, "/")
+}
+
+// discovery returns the topic and payload of the Home Assistant discovery
+// message for a value.
+func (s *mqttSink) discovery(v mqttValue, device haDevice) (string, []byte, error) {
+	objectID := v.group + "_" + mqttSlug(v.name)
+
+	cfg := haConfig{
+		Name:              v.name,
+		UniqueID:          s.nodeID + "_" + objectID,
+		StateTopic:        s.stateTopic(v),
+		AvailabilityTopic: s.availabilityTopic(),
+		Device:            device,
+	}
+
+	switch {
+	case v.unit == "bool":
+		cfg.PayloadOn = "1"
+		cfg.PayloadOff = "0"
+
+	case v.payload != "" && v.unit != "":
+		cfg.DeviceClass, cfg.Unit = haUnit(v.unit)
+
+		if v.counter {
+			cfg.StateClass = "total_increasing"
+		} else {
+			cfg.StateClass = "measurement"
+		}
+	}
+
+	payload, err := json.Marshal(cfg)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return strings.Join([]string{s.discoveryPrefix, v.component(), s.nodeID, objectID, "config"}, "/"), payload, nil
+}
+
+func (s *mqttSink) publish(ctx context.Context, topic string, retained bool, payload any) error {
+	token := s.client.Publish(topic, 1, retained, payload)
+
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *mqttSink) push(ctx context.Context, _ time.Time, families []*dto.MetricFamily) error {
+	var err error
+
+	availability := mqttAvailability(families)
+
+	if availability == "offline" {
+		// Retained values from the last successful poll remain, but are
+		// marked as unavailable.
+		return s.publishAvailability(ctx, availability)
+	}
+
+	values, device := mqttValues(families)
+
+	device.Identifiers = []string{s.nodeID}
+	device.Name = "Heat pump"
+	device.Manufacturer = "Alpha Innotec/Novelan"
+
+	for _, v := range values {
+		if s.discoveryPrefix != "" {
+			topic, payload, discoveryErr := s.discovery(v, device)
+			if discoveryErr != nil {
+				multierr.AppendInto(&err, discoveryErr)
+				continue
+			}
+
+			s.mu.Lock()
+			announced := s.announced[topic] == string(payload)
+			s.mu.Unlock()
+
+			if !announced {
+				if discoveryErr := s.publish(ctx, topic, true, payload); discoveryErr != nil {
+					multierr.AppendInto(&err, discoveryErr)
+					continue
+				}
+
+				s.mu.Lock()
+				s.announced[topic] = string(payload)
+				s.mu.Unlock()
+			}
+		}
+
+		multierr.AppendInto(&err, s.publish(ctx, s.stateTopic(v), true, v.payload))
+	}
+
+	// Values are published before becoming available
+	multierr.AppendInto(&err, s.publishAvailability(ctx, availability))
+
+	return err
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	mqtt "github.com/eclipse/paho.mqtt.golang"
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	mochi "github.com/mochi-mqtt/server/v2"
+	"github.com/mochi-mqtt/server/v2/hooks/auth"
+	"github.com/mochi-mqtt/server/v2/listeners"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+func startMQTTBroker(t *testing.T) string {
+	t.Helper()
+
+	// Reserve a free port
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := l.Addr().String()
+	l.Close()
+
+	server := mochi.New(&mochi.Options{
+		Logger: slog.New(slog.NewTextHandler(io.Discard, nil)),
+	})
+
+	if err := server.AddHook(new(auth.AllowHook), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.AddListener(listeners.NewTCP(listeners.Config{ID: "test", Address: address})); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := server.Serve(); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { server.Close() })
+
+	return "tcp://" + address
+}
+
+func TestMQTTSlug(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"flow", "flow"},
+		{"outdoor temp. ø", "outdoor_temp_avg"},
+		{"Rücklauf-Soll", "ruecklauf_soll"},
+		{"  VD1 ", "vd1"},
+	} {
+		if got := mqttSlug(tc.input); got != tc.want {
+			t.Errorf("mqttSlug(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestMQTTSinkPush(t *testing.T) {
+	broker := startMQTTBroker(t)
+
+	var mu sync.Mutex
+	received := map[string]string{}
+
+	sub := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID("test-subscriber"))
+
+	if token := sub.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	t.Cleanup(func() { sub.Disconnect(0) })
+
+	if token := sub.Subscribe("#", 1, func(_ mqtt.Client, msg mqtt.Message) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		received[msg.Topic()] = string(msg.Payload())
+	}); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	s, err := newMQTTSink(mqttOpts{
+		log:             zap.NewNop(),
+		broker:          broker,
+		clientID:        "test-publisher",
+		topicPrefix:     "luxws",
+		discoveryPrefix: "homeassistant",
+	})
+	if err != nil {
+		t.Fatalf("newMQTTSink() failed: %v", err)
+	}
+
+	t.Cleanup(func() { s.client.Disconnect(0) })
+
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+	})
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(&adapter{
+		c: c,
+		collect: func(ch chan<- prometheus.Metric) error {
+			ch <- prometheus.MustNewConstMetric(c.infoDesc, prometheus.GaugeValue, 1, "v3.89.0", "LP5")
+			ch <- prometheus.MustNewConstMetric(c.opModeDesc, prometheus.GaugeValue, 1, "heating")
+			ch <- prometheus.MustNewConstMetric(c.temperatureDesc, prometheus.GaugeValue, 3.1, "outdoor temp.", "degC")
+			ch <- prometheus.MustNewConstMetric(c.inputDesc, prometheus.GaugeValue, 1, "EVU", "bool")
+			ch <- prometheus.MustNewConstMetric(c.suppliedHeatCntrDesc, prometheus.CounterValue, 27232.1, "heating", "kWh")
+			return nil
+		},
+	})
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.push(context.Background(), time.Now(), families); err != nil {
+		t.Errorf("push() failed: %v", err)
+	}
+
+	want := map[string]string{
+		"luxws/availability":                                         "online",
+		"luxws/status/operation_mode":                                "heating",
+		"luxws/temperature/outdoor_temp":                             "3.1",
+		"luxws/input/evu":                                            "1",
+		"luxws/supplied_heat/heating":                                "27232.1",
+		"homeassistant/sensor/luxws/status_operation_mode/config":    "",
+		"homeassistant/sensor/luxws/temperature_outdoor_temp/config": "",
+		"homeassistant/binary_sensor/luxws/input_evu/config":         "",
+		"homeassistant/sensor/luxws/supplied_heat_heating/config":    "",
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+
+	for {
+		mu.Lock()
+		n := len(received)
+		available := received["luxws/availability"] == "online"
+		mu.Unlock()
+
+		// Availability is published last
+		if (n >= len(want) && available) || time.Now().After(deadline) {
+			break
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	got := map[string]string{}
+
+	for topic, payload := range received {
+		if _, ok := want[topic]; ok && want[topic] == "" {
+			// Discovery messages are checked below
+			payload = ""
+		}
+
+		got[topic] = payload
+	}
+
+	if diff := cmp.Diff(want, got); diff != "" {
+		t.Errorf("Published messages diff (-want +got):\n%s", diff)
+	}
+
+	var cfg map[string]any
+
+	if err := json.Unmarshal([]byte(received["homeassistant/sensor/luxws/supplied_heat_heating/config"]), &cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if diff := cmp.Diff(map[string]any{
+		"name":                "heating",
+		"unique_id":           "luxws_supplied_heat_heating",
+		"state_topic":         "luxws/supplied_heat/heating",
+		"availability_topic":  "luxws/availability",
+		"device_class":        "energy",
+		"state_class":         "total_increasing",
+		"unit_of_measurement": "kWh",
+		"device": map[string]any{
+			"identifiers":  []any{"luxws"},
+			"name":         "Heat pump",
+			"manufacturer": "Alpha Innotec/Novelan",
+			"model":        "LP5",
+			"sw_version":   "v3.89.0",
+		},
+	}, cfg); diff != "" {
+		t.Errorf("Discovery config diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestMQTTSinkAvailability(t *testing.T) {
+	broker := startMQTTBroker(t)
+
+	availability := make(chan string, 10)
+
+	sub := mqtt.NewClient(mqtt.NewClientOptions().AddBroker(broker).SetClientID("test-subscriber"))
+
+	if token := sub.Connect(); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	t.Cleanup(func() { sub.Disconnect(0) })
+
+	if token := sub.Subscribe("luxws/availability", 1, func(_ mqtt.Client, msg mqtt.Message) {
+		availability <- string(msg.Payload())
+	}); token.Wait() && token.Error() != nil {
+		t.Fatal(token.Error())
+	}
+
+	s, err := newMQTTSink(mqttOpts{
+		log:         zap.NewNop(),
+		broker:      broker,
+		clientID:    "test-publisher",
+		topicPrefix: "luxws",
+	})
+	if err != nil {
+		t.Fatalf("newMQTTSink() failed: %v", err)
+	}
+
+	t.Cleanup(func() { s.client.Disconnect(0) })
+
+	c := newCollector(collectorOpts{
+		terms: luxwslang.English,
+		loc:   time.UTC,
+	})
+
+	expect := func(want string) {
+		t.Helper()
+
+		select {
+		case got := <-availability:
+			if got != want {
+				t.Errorf("Availability %q, want %q", got, want)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("Availability %q not received", want)
+		}
+	}
+
+	// Not available until the first successful poll
+	expect("offline")
+
+	for _, tc := range []struct {
+		up   float64
+		want string
+	}{
+		{up: 1, want: "online"},
+		{up: 0, want: "offline"},
+		{up: 1, want: "online"},
+	} {
+		reg := prometheus.NewPedanticRegistry()
+		reg.MustRegister(&adapter{
+			c: c,
+			collect: func(ch chan<- prometheus.Metric) error {
+				ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, tc.up, "")
+				return nil
+			},
+		})
+
+		families, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := s.push(context.Background(), time.Now(), families); err != nil {
+			t.Errorf("push() failed: %v", err)
+		}
+
+		expect(tc.want)
+	}
+}
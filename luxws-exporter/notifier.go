@@ -0,0 +1,356 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+const (
+	notifyFormatWebhook = "webhook"
+	notifyFormatNtfy    = "ntfy"
+	notifyFormatGotify  = "gotify"
+)
+
+const notificationKindOpMode = "opmode"
+
+// Notifications are remembered for this duration to suppress duplicates,
+// e.g. from concurrent scrapes.
+const notifyDedupWindow = 24 * time.Hour
+
+// notification describes an event reported to the configured targets.
+type notification struct {
+	Kind     string    `json:"kind"`
+	Time     time.Time `json:"time"`
+	Title    string    `json:"title"`
+	Message  string    `json:"message"`
+	Reason   string    `json:"reason,omitempty"`
+	Code     string    `json:"code,omitempty"`
+	Previous string    `json:"previous,omitempty"`
+}
+
+func (n notification) key() string {
+	return strings.Join([]string{n.Kind, n.Time.UTC().Format(time.RFC3339), n.Reason, n.Code, n.Previous}, "\x00")
+}
+
+// priority returns a value between 1 (lowest) and 5 (highest).
+func (n notification) priority() int {
+	switch n.Kind {
+	case journalKindError:
+		return 5
+	case journalKindSwitchOff:
+		return 3
+	}
+
+	return 2
+}
+
+func journalNotification(e journalEntry) notification {
+	n := notification{
+		Kind:    e.Kind,
+		Time:    e.Time,
+		Reason:  e.Reason,
+		Code:    e.Code,
+		Message: e.Reason,
+	}
+
+	if e.Code != "" {
+		n.Message = fmt.Sprintf("%s (%s)", e.Reason, e.Code)
+	}
+
+	switch e.Kind {
+	case journalKindError:
+		n.Title = "Heat pump error"
+	default:
+		n.Title = "Heat pump switch-off"
+	}
+
+	return n
+}
+
+// notifyTarget is a URL receiving notifications in a specific format.
+type notifyTarget struct {
+	format string
+	url    string
+}
+
+// parseNotifyTarget parses a target in the form "[format+]url". The format
+// defaults to a generic webhook.
+func parseNotifyTarget(value string) (notifyTarget, error) {
+	t := notifyTarget{format: notifyFormatWebhook, url: value}
+
+	if prefix, rest, ok := strings.Cut(value, "+"); ok {
+		switch prefix {
+		case notifyFormatWebhook, notifyFormatNtfy, notifyFormatGotify:
+			t.format = prefix
+			t.url = rest
+		}
+	}
+
+	if u, err := url.Parse(t.url); err != nil {
+		return t, err
+	} else if !(u.Scheme == "http" || u.Scheme == "https") || u.Host == "" {
+		return t, fmt.Errorf("notification target %q: URL must use HTTP(S)", value)
+	}
+
+	return t, nil
+}
+
+// request builds the HTTP request for delivering a notification.
+func (t notifyTarget) request(ctx context.Context, n notification) (*http.Request, error) {
+	var payload any
+
+	target := t.url
+
+	switch t.format {
+	case notifyFormatNtfy:
+		// JSON messages are published to the server root with the topic in
+		// the body.
+		u, err := url.Parse(t.url)
+		if err != nil {
+			return nil, err
+		}
+
+		topic := path.Base(u.Path)
+		u.Path = path.Dir(u.Path)
+
+		target = u.String()
+		payload = map[string]any{
+			"topic":    topic,
+			"title":    n.Title,
+			"message":  n.Message,
+			"priority": n.priority(),
+			"tags":     []string{n.Kind},
+		}
+
+	case notifyFormatGotify:
+		payload = map[string]any{
+			"title":    n.Title,
+			"message":  n.Message,
+			"priority": 2 * n.priority(),
+		}
+
+	default:
+		payload = n
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	return req, nil
+}
+
+type notifierOpts struct {
+	log     *zap.Logger
+	targets []notifyTarget
+
+	// Number of retries after a failed delivery.
+	retries int
+
+	// Delay before the first retry. Doubled for every further retry.
+	backoff time.Duration
+}
+
+// notifier delivers notifications asynchronously to a set of targets. A nil
+// notifier discards all notifications.
+type notifier struct {
+	log     *zap.Logger
+	httpDo  func(req *http.Request) (*http.Response, error)
+	targets []notifyTarget
+	retries int
+	backoff time.Duration
+	queue   chan notification
+
+	mu   sync.Mutex
+	sent map[string]time.Time
+}
+
+func newNotifier(opts notifierOpts) *notifier {
+	if len(opts.targets) == 0 {
+		return nil
+	}
+
+	return &notifier{
+		log:     opts.log,
+		httpDo:  cleanhttp.DefaultClient().Do,
+		targets: opts.targets,
+		retries: opts.retries,
+		backoff: opts.backoff,
+		queue:   make(chan notification, 100),
+		sent:    map[string]time.Time{},
+	}
+}
+
+// notify queues a notification for delivery unless it was already sent.
+func (n *notifier) notify(msg notification) {
+	if n == nil {
+		return
+	}
+
+	now := time.Now()
+	key := msg.key()
+
+	n.mu.Lock()
+	for k, ts := range n.sent {
+		if now.Sub(ts) > notifyDedupWindow {
+			delete(n.sent, k)
+		}
+	}
+
+	_, seen := n.sent[key]
+	if !seen {
+		n.sent[key] = now
+	}
+	n.mu.Unlock()
+
+	if seen {
+		return
+	}
+
+	select {
+	case n.queue <- msg:
+	default:
+		if n.log != nil {
+			n.log.Error("Notification queue full, dropping notification", zap.String("title", msg.Title))
+		}
+	}
+}
+
+// run delivers queued notifications until the context is cancelled.
+func (n *notifier) run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case msg := <-n.queue:
+			for _, t := range n.targets {
+				if err := n.deliver(ctx, t, msg); err != nil && n.log != nil {
+					n.log.Error("Sending notification failed", zap.Error(err), zap.String("format", t.format))
+				}
+			}
+		}
+	}
+}
+
+// deliver sends a notification to a single target, retrying failed attempts.
+func (n *notifier) deliver(ctx context.Context, t notifyTarget, msg notification) error {
+	delay := n.backoff
+
+	for attempt := 0; ; attempt++ {
+		retryable, err := n.send(ctx, t, msg)
+		if err == nil || !retryable || attempt >= n.retries {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+}
+
+func (n *notifier) send(ctx context.Context, t notifyTarget, msg notification) (bool, error) {
+	req, err := t.request(ctx, msg)
+	if err != nil {
+		return false, err
+	}
+
+	resp, err := n.httpDo(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer resp.Body.Close()
+
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("%s %s: HTTP status %s", req.Method, req.URL.Redacted(), resp.Status)
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// swapOperationMode stores the current operation mode and returns the
+// previous one. The previous mode is empty if it's unknown.
+func (s *stateStore) swapOperationMode(mode string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.data.OperationMode
+
+	if prev != mode {
+		s.data.OperationMode = mode
+		s.dirty = true
+	}
+
+	return prev
+}
+
+// collectOpModeChange sends a notification when the operation mode changes.
+// No metrics are reported.
+func (c *collector) collectOpModeChange(_ *luxwscollect.Env, _ chan<- prometheus.Metric, content *luxwsclient.ContentRoot) error {
+	if c.notifier == nil {
+		return nil
+	}
+
+	// Missing groups are reported by the info collector.
+	group, err := content.FindByName(luxwsclient.CmpName(c.terms.NavSystemStatus))
+	if err != nil {
+		return nil
+	}
+
+	var opMode string
+
+	group.EachNonNil(func(item *luxwsclient.ContentItem) {
+		if item.Name == c.terms.StatusOperationMode {
+			opMode = normalizeSpace(*item.Value)
+		}
+	})
+
+	if opMode == "" {
+		opMode = "off"
+	}
+
+	if prev := c.state.swapOperationMode(opMode); prev != "" && prev != opMode {
+		c.notifier.notify(notification{
+			Kind:     notificationKindOpMode,
+			Time:     c.now(),
+			Title:    "Heat pump operation mode changed",
+			Message:  fmt.Sprintf("%s → %s", prev, opMode),
+			Reason:   opMode,
+			Previous: prev,
+		})
+	}
+
+	return nil
+}
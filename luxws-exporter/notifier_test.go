@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type notifyReceiver struct {
+	mu       sync.Mutex
+	failures int
+	paths    []string
+	bodies   []map[string]any
+	received chan struct{}
+}
+
+func newNotifyReceiver(t *testing.T, failures int) (*notifyReceiver, *httptest.Server) {
+	r := &notifyReceiver{
+		failures: failures,
+		received: make(chan struct{}, 100),
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		if r.failures > 0 {
+			r.failures--
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+
+		var body map[string]any
+
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil {
+			t.Errorf("Decoding notification failed: %v", err)
+		}
+
+		r.paths = append(r.paths, req.URL.Path)
+		r.bodies = append(r.bodies, body)
+		r.received <- struct{}{}
+	}))
+	t.Cleanup(srv.Close)
+
+	return r, srv
+}
+
+func TestParseNotifyTarget(t *testing.T) {
+	for _, tc := range []struct {
+		value   string
+		want    notifyTarget
+		wantErr bool
+	}{
+		{value: "http://localhost/hook", want: notifyTarget{format: notifyFormatWebhook, url: "http://localhost/hook"}},
+		{value: "ntfy+https://ntfy.sh/heatpump", want: notifyTarget{format: notifyFormatNtfy, url: "https://ntfy.sh/heatpump"}},
+		{value: "gotify+https://gotify.example/message?token=x", want: notifyTarget{format: notifyFormatGotify, url: "https://gotify.example/message?token=x"}},
+		{value: "other+https://example.com", wantErr: true},
+		{value: "/relative", wantErr: true},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			got, err := parseNotifyTarget(tc.value)
+
+			if (err != nil) != tc.wantErr {
+				t.Errorf("parseNotifyTarget() error = %v, wantErr %v", err, tc.wantErr)
+			}
+
+			if err == nil {
+				if diff := cmp.Diff(tc.want, got, cmp.AllowUnexported(notifyTarget{})); diff != "" {
+					t.Errorf("parseNotifyTarget() diff (-want +got):\n%s", diff)
+				}
+			}
+		})
+	}
+}
+
+func TestNotifierDeliver(t *testing.T) {
+	msg := journalNotification(journalEntry{
+		Kind:   journalKindError,
+		Time:   time.Date(2024, time.September, 1, 15, 12, 47, 0, time.UTC),
+		Reason: "max. outdoor temp.",
+		Code:   "718",
+	})
+
+	for _, tc := range []struct {
+		name     string
+		format   string
+		path     string
+		failures int
+		retries  int
+		wantPath string
+		want     map[string]any
+		wantErr  bool
+	}{
+		{
+			name:     "webhook",
+			format:   notifyFormatWebhook,
+			path:     "/hook",
+			wantPath: "/hook",
+			want: map[string]any{
+				"kind":    "error",
+				"time":    "2024-09-01T15:12:47Z",
+				"title":   "Heat pump error",
+				"message": "max. outdoor temp. (718)",
+				"reason":  "max. outdoor temp.",
+				"code":    "718",
+			},
+		},
+		{
+			name:     "ntfy with retry",
+			format:   notifyFormatNtfy,
+			path:     "/heatpump",
+			failures: 2,
+			retries:  2,
+			wantPath: "/",
+			want: map[string]any{
+				"topic":    "heatpump",
+				"title":    "Heat pump error",
+				"message":  "max. outdoor temp. (718)",
+				"priority": 5.0,
+				"tags":     []any{"error"},
+			},
+		},
+		{
+			name:     "gotify",
+			format:   notifyFormatGotify,
+			path:     "/message",
+			wantPath: "/message",
+			want: map[string]any{
+				"title":    "Heat pump error",
+				"message":  "max. outdoor temp. (718)",
+				"priority": 10.0,
+			},
+		},
+		{
+			name:     "retries exhausted",
+			format:   notifyFormatWebhook,
+			failures: 2,
+			retries:  1,
+			wantErr:  true,
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			r, srv := newNotifyReceiver(t, tc.failures)
+
+			target := notifyTarget{format: tc.format, url: srv.URL + tc.path}
+			n := newNotifier(notifierOpts{
+				targets: []notifyTarget{target},
+				retries: tc.retries,
+				backoff: time.Millisecond,
+			})
+
+			err := n.deliver(context.Background(), target, msg)
+
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("deliver() error = %v, wantErr %v", err, tc.wantErr)
+			}
+
+			if tc.wantErr {
+				return
+			}
+
+			if diff := cmp.Diff([]string{tc.wantPath}, r.paths); diff != "" {
+				t.Errorf("Path diff (-want +got):\n%s", diff)
+			}
+
+			if diff := cmp.Diff([]map[string]any{tc.want}, r.bodies); diff != "" {
+				t.Errorf("Body diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestCollectNotifications(t *testing.T) {
+	r, srv := newNotifyReceiver(t, 0)
+
+	n := newNotifier(notifierOpts{
+		targets: []notifyTarget{{format: notifyFormatWebhook, url: srv.URL}},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	go n.run(ctx)
+
+	c := newCollector(collectorOpts{
+		terms:    luxwslang.English,
+		loc:      time.UTC,
+		notifier: n,
+	})
+
+	content := func(opMode string, errors ...*luxwsclient.ContentItem) *luxwsclient.ContentRoot {
+		return &luxwsclient.ContentRoot{
+			Items: luxwsclient.ContentItems{
+				{
+					Name: "system status",
+					Items: luxwsclient.ContentItems{
+						{Name: "operation mode", Value: luxwsclient.String(opMode)},
+					},
+				},
+				{
+					Name:  "error memory",
+					Items: errors,
+				},
+			},
+		}
+	}
+
+	oldError := &luxwsclient.ContentItem{Name: "01.09.24 15:12:47", Value: luxwsclient.String("max. outdoor temp. (718)")}
+	newError := &luxwsclient.ContentItem{Name: "02.09.24 08:00:00", Value: luxwsclient.String("low pressure (705)")}
+
+	for _, i := range []*luxwsclient.ContentRoot{
+		// Baseline
+		content("heating", oldError),
+		content("heating", oldError),
+		content("DHW", oldError, newError),
+		content("DHW", oldError, newError),
+	} {
+		for _, fn := range []contentCollectFunc{c.collectJournal, c.collectOpModeChange} {
+			if err := fn(testEnv(quirks{}), make(chan prometheus.Metric, 16), i); err != nil {
+				t.Errorf("Collection failed: %v", err)
+			}
+		}
+	}
+
+	for range 2 {
+		select {
+		case <-r.received:
+		case <-time.After(10 * time.Second):
+			t.Fatal("Timeout waiting for notifications")
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var got []string
+
+	for _, body := range r.bodies {
+		got = append(got, body["kind"].(string)+": "+body["message"].(string))
+	}
+
+	if diff := cmp.Diff([]string{
+		"error: low pressure (705)",
+		"opmode: heating → DHW",
+	}, got); diff != "" {
+		t.Errorf("Notifications diff (-want +got):\n%s", diff)
+	}
+}
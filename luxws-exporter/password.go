@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"strings"
+	"sync"
+)
+
+// passwordSource provides the controller password, either given directly or
+// read from a file. Passwords from files are re-read on reload.
+type passwordSource struct {
+	path string
+
+	mu    sync.Mutex
+	value string
+}
+
+func newPasswordSource(value, path string) (*passwordSource, error) {
+	s := &passwordSource{
+		path:  path,
+		value: value,
+	}
+
+	if path != "" {
+		if value != "" {
+			return nil, errors.New("password and password file are mutually exclusive")
+		}
+
+		if err := s.reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+// reload re-reads the password file, if any. The previous password is kept on
+// errors.
+func (s *passwordSource) reload() error {
+	if s.path == "" {
+		return nil
+	}
+
+	content, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Editors usually add a trailing newline
+	s.value = strings.TrimRight(string(content), "\r\n")
+
+	return nil
+}
+
+func (s *passwordSource) get() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.value
+}
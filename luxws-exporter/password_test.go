@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPasswordSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "password")
+
+	if err := os.WriteFile(path, []byte("first\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := newPasswordSource("", path)
+	if err != nil {
+		t.Fatalf("newPasswordSource() failed: %v", err)
+	}
+
+	if got := s.get(); got != "first" {
+		t.Errorf("get() returned %q, want %q", got, "first")
+	}
+
+	if err := os.WriteFile(path, []byte("second\r\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := s.get(); got != "first" {
+		t.Errorf("get() before reload returned %q, want %q", got, "first")
+	}
+
+	if err := s.reload(); err != nil {
+		t.Errorf("reload() failed: %v", err)
+	}
+
+	if got := s.get(); got != "second" {
+		t.Errorf("get() after reload returned %q, want %q", got, "second")
+	}
+
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.reload(); err == nil {
+		t.Errorf("reload() of missing file succeeded")
+	}
+
+	if got := s.get(); got != "second" {
+		t.Errorf("get() after failed reload returned %q, want %q", got, "second")
+	}
+}
+
+func TestPasswordSourceExclusive(t *testing.T) {
+	if _, err := newPasswordSource("secret", "/nonexistent"); err == nil {
+		t.Errorf("newPasswordSource() succeeded with password and file")
+	}
+
+	s, err := newPasswordSource("secret", "")
+	if err != nil {
+		t.Fatalf("newPasswordSource() failed: %v", err)
+	}
+
+	if err := s.reload(); err != nil {
+		t.Errorf("reload() failed: %v", err)
+	}
+
+	if got := s.get(); got != "secret" {
+		t.Errorf("get() returned %q, want %q", got, "secret")
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+// pushSink receives the metrics gathered by the poller.
+type pushSink interface {
+	// name identifies the sink in log messages.
+	name() string
+
+	push(ctx context.Context, ts time.Time, families []*dto.MetricFamily) error
+}
+
+// metricsCache collects metrics from a collector on request and serves them
+// until the next update. With it the controller is contacted once per poll,
+// regardless of how many registries gather the metrics.
+type metricsCache struct {
+	c     prometheus.Collector
+	ready chan struct{}
+	once  sync.Once
+
+	mu      sync.Mutex
+	metrics []prometheus.Metric
+}
+
+func newMetricsCache(c prometheus.Collector) *metricsCache {
+	return &metricsCache{
+		c:     c,
+		ready: make(chan struct{}),
+	}
+}
+
+// update collects all metrics and replaces the cached ones.
+func (mc *metricsCache) update() {
+	ch := make(chan prometheus.Metric)
+	done := make(chan struct{})
+
+	var metrics []prometheus.Metric
+
+	go func() {
+		defer close(done)
+
+		for m := range ch {
+			metrics = append(metrics, m)
+		}
+	}()
+
+	mc.c.Collect(ch)
+	close(ch)
+	<-done
+
+	mc.mu.Lock()
+	mc.metrics = metrics
+	mc.mu.Unlock()
+
+	mc.once.Do(func() { close(mc.ready) })
+}
+
+func (mc *metricsCache) Describe(ch chan<- *prometheus.Desc) {
+	mc.c.Describe(ch)
+}
+
+// Collect sends the cached metrics. It waits for the first update.
+func (mc *metricsCache) Collect(ch chan<- prometheus.Metric) {
+	<-mc.ready
+
+	mc.mu.Lock()
+	metrics := mc.metrics
+	mc.mu.Unlock()
+
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// poller periodically collects metrics from the controller and hands them to
+// a set of sinks. It's used for outputs other than Prometheus scrapes.
+type poller struct {
+	log   *zap.Logger
+	cache *metricsCache
+
+	// Gathers the cached metrics to be pushed.
+	gatherer prometheus.Gatherer
+
+	interval time.Duration
+	timeout  time.Duration
+	sinks    []pushSink
+}
+
+// poll collects metrics once and pushes them to all sinks.
+func (p *poller) poll(ctx context.Context) {
+	ts := time.Now()
+
+	p.cache.update()
+
+	families, err := p.gatherer.Gather()
+	if err != nil {
+		// Partial results are still useful.
+		p.log.Warn("Gathering metrics failed", zap.Error(err))
+	}
+
+	for _, s := range p.sinks {
+		pushCtx, cancel := context.WithTimeout(ctx, p.timeout)
+
+		if err := s.push(pushCtx, ts, families); err != nil {
+			p.log.Error("Pushing metrics failed", zap.Error(err), zap.String("sink", s.name()))
+		}
+
+		cancel()
+	}
+}
+
+// run polls immediately and then in regular intervals until the context is
+// cancelled.
+func (p *poller) run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.poll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// familyLabel returns the value of the named label or an empty string.
+func familyLabel(m *dto.Metric, name string) string {
+	for _, l := range m.GetLabel() {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+
+	return ""
+}
+
+// familyValue returns the value of a gauge, counter or untyped metric.
+func familyValue(m *dto.Metric) (float64, bool) {
+	switch {
+	case m.Gauge != nil:
+		return m.Gauge.GetValue(), true
+	case m.Counter != nil:
+		return m.Counter.GetValue(), true
+	case m.Untyped != nil:
+		return m.Untyped.GetValue(), true
+	}
+
+	return 0, false
+}
+
+// flatSample is a single value of a gathered metric.
+type flatSample struct {
+	name   string
+	labels map[string]string
+	value  float64
+}
+
+// flattenFamilies converts gathered metrics to individual samples. Histograms
+// are split into "_count", "_sum" and "_bucket" samples like in the
+// Prometheus text format.
+func flattenFamilies(families []*dto.MetricFamily) []flatSample {
+	var result []flatSample
+
+	for _, mf := range families {
+		name := mf.GetName()
+
+		for _, m := range mf.GetMetric() {
+			labels := func(extra ...string) map[string]string {
+				result := make(map[string]string, len(m.GetLabel())+len(extra)/2)
+
+				for _, l := range m.GetLabel() {
+					result[l.GetName()] = l.GetValue()
+				}
+
+				for i := 0; i+1 < len(extra); i += 2 {
+					result[extra[i]] = extra[i+1]
+				}
+
+				return result
+			}
+
+			if h := m.GetHistogram(); h != nil {
+				result = append(result,
+					flatSample{name + "_count", labels(), float64(h.GetSampleCount())},
+					flatSample{name + "_sum", labels(), h.GetSampleSum()},
+				)
+
+				for _, b := range h.GetBucket() {
+					if math.IsInf(b.GetUpperBound(), +1) {
+						continue
+					}
+
+					result = append(result, flatSample{
+						name + "_bucket",
+						labels("le", strconv.FormatFloat(b.GetUpperBound(), 'g', -1, 64)),
+						float64(b.GetCumulativeCount()),
+					})
+				}
+
+				result = append(result, flatSample{name + "_bucket", labels("le", "+Inf"), float64(h.GetSampleCount())})
+
+				continue
+			}
+
+			if value, ok := familyValue(m); ok {
+				result = append(result, flatSample{name, labels(), value})
+			}
+		}
+	}
+
+	return result
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+)
+
+var testCountDesc = prometheus.NewDesc("test_collections", "Number of collections", nil, nil)
+
+type countingCollector struct {
+	count atomic.Int64
+}
+
+func (c *countingCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- testCountDesc
+}
+
+func (c *countingCollector) Collect(ch chan<- prometheus.Metric) {
+	ch <- prometheus.MustNewConstMetric(testCountDesc, prometheus.GaugeValue, float64(c.count.Add(1)))
+}
+
+type recordingSink struct {
+	families [][]*dto.MetricFamily
+}
+
+func (s *recordingSink) name() string {
+	return "recording"
+}
+
+func (s *recordingSink) push(_ context.Context, _ time.Time, families []*dto.MetricFamily) error {
+	s.families = append(s.families, families)
+
+	return nil
+}
+
+func TestMetricsCache(t *testing.T) {
+	var cc countingCollector
+
+	cache := newMetricsCache(&cc)
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(cache)
+
+	pollReg := prometheus.NewRegistry()
+	pollReg.MustRegister(cache)
+
+	var sink recordingSink
+
+	p := &poller{
+		log:      zap.NewNop(),
+		cache:    cache,
+		gatherer: pollReg,
+		timeout:  time.Minute,
+		sinks:    []pushSink{&sink},
+	}
+
+	for range 2 {
+		p.poll(context.Background())
+	}
+
+	want := `
+# HELP test_collections Number of collections
+# TYPE test_collections gauge
+test_collections 2
+`
+
+	// Scrapes don't collect again
+	for range 3 {
+		if err := testutil.GatherAndCompare(reg, strings.NewReader(want)); err != nil {
+			t.Error(err)
+		}
+	}
+
+	if got := cc.count.Load(); got != 2 {
+		t.Errorf("Collected %d times, want 2", got)
+	}
+
+	if len(sink.families) != 2 {
+		t.Fatalf("Pushed %d times, want 2", len(sink.families))
+	}
+
+	if got := sink.families[1][0].GetMetric()[0].GetGauge().GetValue(); got != 2 {
+		t.Errorf("Pushed value %g, want 2", got)
+	}
+}
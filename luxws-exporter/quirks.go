@@ -1,5 +1,375 @@
 package main
 
-type quirks struct {
-	missingSuppliedHeat bool
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+)
+
+type quirks = luxwscollect.Quirks
+
+//go:embed quirks.yaml
+var builtinQuirks []byte
+
+type quirkRename struct {
+	Group string `yaml:"group"`
+	From  string `yaml:"from"`
+	To    string `yaml:"to"`
+}
+
+type quirkUnit struct {
+	Group string `yaml:"group"`
+	Name  string `yaml:"name"`
+	From  string `yaml:"from"`
+	To    string `yaml:"to"`
+}
+
+type quirkScale struct {
+	Group  string  `yaml:"group"`
+	Name   string  `yaml:"name"`
+	Factor float64 `yaml:"factor"`
+}
+
+// quirkDef describes the peculiarities of particular controllers (see
+// quirks.yaml for the format).
+type quirkDef struct {
+	Name        string        `yaml:"name"`
+	Description string        `yaml:"description"`
+	Disabled    bool          `yaml:"disabled"`
+	Types       []string      `yaml:"types"`
+	Versions    []string      `yaml:"versions"`
+	Missing     []string      `yaml:"missing"`
+	Renames     []quirkRename `yaml:"renames"`
+	Units       []quirkUnit   `yaml:"units"`
+	Scales      []quirkScale  `yaml:"scales"`
+}
+
+func (d *quirkDef) validate() error {
+	if d.Name == "" {
+		return errors.New("name required")
+	}
+
+	for _, name := range d.Missing {
+		b := findBuiltinModule(name)
+
+		if b == nil {
+			return fmt.Errorf("%s: unknown collector %q", d.Name, name)
+		}
+
+		if b.required {
+			return fmt.Errorf("%s: collector %q can't be missing", d.Name, name)
+		}
+	}
+
+	for _, r := range d.Renames {
+		if r.From == "" || r.To == "" {
+			return fmt.Errorf("%s: renames require from and to", d.Name)
+		}
+	}
+
+	for _, u := range d.Units {
+		if u.Name == "" || u.From == "" {
+			return fmt.Errorf("%s: units require name and from", d.Name)
+		}
+	}
+
+	for _, s := range d.Scales {
+		if s.Name == "" || s.Factor == 0 {
+			return fmt.Errorf("%s: scales require name and a non-zero factor", d.Name)
+		}
+	}
+
+	return nil
+}
+
+// matches reports whether the quirk applies to a controller.
+func (d *quirkDef) matches(hpType []string, version string) bool {
+	if len(d.Types) > 0 && !slices.ContainsFunc(d.Types, func(t string) bool {
+		return slices.ContainsFunc(hpType, func(s string) bool {
+			return strings.EqualFold(s, t)
+		})
+	}) {
+		return false
+	}
+
+	if len(d.Versions) > 0 && !slices.ContainsFunc(d.Versions, func(prefix string) bool {
+		return strings.HasPrefix(strings.ToLower(version), strings.ToLower(prefix))
+	}) {
+		return false
+	}
+
+	return true
+}
+
+// transforms reports whether the quirk modifies content.
+func (d *quirkDef) transforms() bool {
+	return len(d.Renames) > 0 || len(d.Units) > 0 || len(d.Scales) > 0
+}
+
+func parseQuirks(r io.Reader) ([]quirkDef, error) {
+	var file struct {
+		Quirks []quirkDef `yaml:"quirks"`
+	}
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+
+	if err := dec.Decode(&file); err != nil && !errors.Is(err, io.EOF) {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+
+	for idx := range file.Quirks {
+		d := &file.Quirks[idx]
+
+		if err := d.validate(); err != nil {
+			return nil, fmt.Errorf("quirk %d: %w", idx+1, err)
+		}
+
+		if seen[d.Name] {
+			return nil, fmt.Errorf("duplicate quirk %q", d.Name)
+		}
+
+		seen[d.Name] = true
+	}
+
+	return file.Quirks, nil
+}
+
+// quirksDB holds the built-in quirks, optionally overridden from a file.
+type quirksDB struct {
+	defs []quirkDef
+}
+
+// loadQuirksDB returns the built-in quirks with the entries from the given
+// file, if any, merged in by name.
+func loadQuirksDB(path string) (*quirksDB, error) {
+	defs, err := parseQuirks(bytes.NewReader(builtinQuirks))
+	if err != nil {
+		return nil, fmt.Errorf("built-in quirks: %w", err)
+	}
+
+	if path != "" {
+		fh, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		defer fh.Close()
+
+		overrides, err := parseQuirks(fh)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		for _, o := range overrides {
+			if idx := slices.IndexFunc(defs, func(d quirkDef) bool { return d.Name == o.Name }); idx >= 0 {
+				defs[idx] = o
+			} else {
+				defs = append(defs, o)
+			}
+		}
+	}
+
+	defs = slices.DeleteFunc(defs, func(d quirkDef) bool { return d.Disabled })
+
+	return &quirksDB{defs: defs}, nil
+}
+
+// match returns the quirks applying to a controller.
+func (db *quirksDB) match(hpType []string, version string) []*quirkDef {
+	var result []*quirkDef
+
+	for idx := range db.defs {
+		if d := &db.defs[idx]; d.matches(hpType, version) {
+			result = append(result, d)
+		}
+	}
+
+	return result
+}
+
+var quirkNumberPattern = regexp.MustCompile(`^\s*-?[0-9]+(?:[.,][0-9]+)?`)
+
+// adjustItem applies the renames, unit replacements and scales of a quirk to
+// an item within the given group.
+func (d *quirkDef) adjustItem(groupName string, item *luxwsclient.ContentItem) {
+	for _, r := range d.Renames {
+		if (r.Group == "" || r.Group == groupName) && item.Name == r.From {
+			item.Name = r.To
+		}
+	}
+
+	if item.Value == nil {
+		return
+	}
+
+	value := strings.TrimSpace(*item.Value)
+
+	for _, u := range d.Units {
+		if (u.Group == "" || u.Group == groupName) && item.Name == u.Name {
+			if prefix, ok := strings.CutSuffix(value, u.From); ok {
+				value = prefix + u.To
+			}
+		}
+	}
+
+	for _, s := range d.Scales {
+		if (s.Group == "" || s.Group == groupName) && item.Name == s.Name {
+			if loc := quirkNumberPattern.FindStringIndex(value); loc != nil {
+				num, err := strconv.ParseFloat(strings.Replace(strings.TrimSpace(value[:loc[1]]), ",", ".", 1), 64)
+				if err == nil {
+					value = strconv.FormatFloat(num*s.Factor, 'f', -1, 64) + value[loc[1]:]
+				}
+			}
+		}
+	}
+
+	item.Value = &value
+}
+
+// applyQuirks returns a copy of the content with the item adjustments of the
+// given quirks applied. The content is returned as-is if no quirk modifies
+// content.
+func applyQuirks(content *luxwsclient.ContentRoot, active []*quirkDef) *luxwsclient.ContentRoot {
+	if !slices.ContainsFunc(active, (*quirkDef).transforms) {
+		return content
+	}
+
+	var clone func(groupName string, items luxwsclient.ContentItems) luxwsclient.ContentItems
+
+	clone = func(groupName string, items luxwsclient.ContentItems) luxwsclient.ContentItems {
+		var result luxwsclient.ContentItems
+
+		for _, item := range items {
+			copied := *item
+			copied.Items = clone(item.Name, item.Items)
+
+			for _, d := range active {
+				d.adjustItem(groupName, &copied)
+			}
+
+			result = append(result, &copied)
+		}
+
+		return result
+	}
+
+	return &luxwsclient.ContentRoot{
+		XMLName: content.XMLName,
+		Items:   clone("", content.Items),
+	}
+}
+
+// controllerModel returns the heat pump types and the software version from
+// the system status.
+func (c *collector) controllerModel(content *luxwsclient.ContentRoot) ([]string, string) {
+	var hpType []string
+	var version string
+
+	if group, err := content.FindByName(luxwsclient.CmpName(c.terms.NavSystemStatus)); err == nil {
+		group.EachNonNil(func(item *luxwsclient.ContentItem) {
+			switch item.Name {
+			case c.terms.StatusType:
+				hpType = append(hpType, normalizeSpace(*item.Value))
+			case c.terms.StatusSoftwareVersion:
+				version = normalizeSpace(*item.Value)
+			}
+		})
+	}
+
+	slices.Sort(hpType)
+
+	return hpType, version
+}
+
+// detectQuirks determines the quirks applying to the controller, reports them
+// as metrics and returns the adjusted content along with the quirks passed to
+// collectors. Collectors for missing groups are returned as well.
+func (c *collector) detectQuirks(ch chan<- prometheus.Metric, content *luxwsclient.ContentRoot) (*luxwsclient.ContentRoot, quirks, map[string]bool) {
+	var q quirks
+
+	missing := map[string]bool{}
+	active := c.quirksDB.match(c.controllerModel(content))
+
+	for _, d := range active {
+		q.Active = append(q.Active, d.Name)
+
+		for _, name := range d.Missing {
+			missing[name] = true
+		}
+	}
+
+	q.MissingSuppliedHeat = missing["supplied_heat"]
+
+	for _, d := range c.quirksDB.defs {
+		value := 0.0
+
+		if slices.Contains(q.Active, d.Name) {
+			value = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(c.quirkActiveDesc, prometheus.GaugeValue, value, d.Name)
+	}
+
+	return applyQuirks(content, active), q, missing
+}
+
+type outcomeName struct {
+	group string
+	item  string
+}
+
+// outcomeNames maps content items to the names under which collectors record
+// their outcome.
+type outcomeNames map[*luxwsclient.ContentItem]outcomeName
+
+// lookup returns the outcome recorded for an item of a group. Items without
+// a mapping are looked up by their own names.
+func (n outcomeNames) lookup(outcomes *luxwscollect.Outcomes, groupName string, item *luxwsclient.ContentItem) (luxwscollect.ItemOutcome, bool) {
+	if name, ok := n[item]; ok {
+		return outcomes.Lookup(name.group, name.item)
+	}
+
+	return outcomes.Lookup(groupName, item.Name)
+}
+
+// outcomeNames returns the names of the items of the information page as
+// seen by the collectors, i.e. with the quirks of the controller applied.
+func (c *collector) outcomeNames(content *luxwsclient.ContentRoot) outcomeNames {
+	result := outcomeNames{}
+
+	var walk func(groupName string, items, adjusted luxwsclient.ContentItems)
+
+	// Applying quirks retains the structure of the content
+	walk = func(groupName string, items, adjusted luxwsclient.ContentItems) {
+		for idx, item := range items {
+			result[item] = outcomeName{groupName, adjusted[idx].Name}
+
+			walk(adjusted[idx].Name, item.Items, adjusted[idx].Items)
+		}
+	}
+
+	walk("", content.Items, c.adjustForQuirks(content).Items)
+
+	return result
+}
+
+// adjustForQuirks returns content as seen by the collectors, i.e. with the
+// quirks of the controller applied. The structure of the content is retained.
+func (c *collector) adjustForQuirks(content *luxwsclient.ContentRoot) *luxwsclient.ContentRoot {
+	return applyQuirks(content, c.quirksDB.match(c.controllerModel(content)))
 }
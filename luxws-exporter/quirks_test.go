@@ -0,0 +1,209 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestParseQuirks(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "builtin", input: string(builtinQuirks)},
+		{name: "missing name", input: "quirks: [{types: [L2A]}]", wantErr: true},
+		{name: "unknown field", input: "quirks: [{name: a, typo: 1}]", wantErr: true},
+		{name: "duplicate", input: "quirks: [{name: a}, {name: a}]", wantErr: true},
+		{name: "unknown collector", input: "quirks: [{name: a, missing: [pool]}]", wantErr: true},
+		{name: "required collector", input: "quirks: [{name: a, missing: [info]}]", wantErr: true},
+		{name: "zero factor", input: "quirks: [{name: a, scales: [{name: x}]}]", wantErr: true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := parseQuirks(strings.NewReader(tc.input))
+
+			if (err != nil) != tc.wantErr {
+				t.Errorf("parseQuirks() error %v, want error %v", err, tc.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadQuirksDB(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "quirks.yaml")
+
+	if err := os.WriteFile(path, []byte(`
+quirks:
+  - name: l2a_missing_supplied_heat
+    disabled: true
+  - name: old_firmware
+    types: [LWD]
+    versions: [V2.]
+    missing: [energy_input]
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	db, err := loadQuirksDB(path)
+	if err != nil {
+		t.Fatalf("loadQuirksDB() failed: %v", err)
+	}
+
+	var names []string
+
+	for _, d := range db.defs {
+		names = append(names, d.Name)
+	}
+
+	if diff := cmp.Diff([]string{"old_firmware"}, names); diff != "" {
+		t.Errorf("Quirks diff (-want +got):\n%s", diff)
+	}
+
+	for _, tc := range []struct {
+		hpType  []string
+		version string
+		want    int
+	}{
+		{hpType: []string{"lwd"}, version: "V2.88.1", want: 1},
+		{hpType: []string{"HMD", "LWD"}, version: "v2.88.1", want: 1},
+		{hpType: []string{"LWD"}, version: "V3.90.1", want: 0},
+		{hpType: []string{"L2A"}, version: "V2.88.1", want: 0},
+	} {
+		if got := len(db.match(tc.hpType, tc.version)); got != tc.want {
+			t.Errorf("match(%q, %q) returned %d quirks, want %d", tc.hpType, tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestApplyQuirks(t *testing.T) {
+	input := &luxwsclient.ContentRoot{
+		Items: luxwsclient.ContentItems{
+			{
+				Name: "Wärmemenge",
+				Items: luxwsclient.ContentItems{
+					{Name: "Heizung", Value: luxwsclient.String("1234,5 kWh")},
+					{Name: "WW", Value: luxwsclient.String("500 Wh")},
+				},
+			},
+			{
+				Name: "Eingänge",
+				Items: luxwsclient.ContentItems{
+					{Name: "Durchfluss", Value: luxwsclient.String("72 l/h")},
+				},
+			},
+		},
+	}
+
+	got := applyQuirks(input, []*quirkDef{{
+		Name:    "test",
+		Renames: []quirkRename{{Group: "Wärmemenge", From: "WW", To: "Warmwasser"}},
+		Units:   []quirkUnit{{Group: "Wärmemenge", Name: "Warmwasser", From: "Wh", To: "kWh"}},
+		Scales: []quirkScale{
+			{Group: "Wärmemenge", Name: "Warmwasser", Factor: 0.001},
+			{Name: "Durchfluss", Factor: 10},
+		},
+	}})
+
+	if diff := cmp.Diff(&luxwsclient.ContentRoot{
+		Items: luxwsclient.ContentItems{
+			{
+				Name: "Wärmemenge",
+				Items: luxwsclient.ContentItems{
+					{Name: "Heizung", Value: luxwsclient.String("1234,5 kWh")},
+					{Name: "Warmwasser", Value: luxwsclient.String("0.5 kWh")},
+				},
+			},
+			{
+				Name: "Eingänge",
+				Items: luxwsclient.ContentItems{
+					{Name: "Durchfluss", Value: luxwsclient.String("720 l/h")},
+				},
+			},
+		},
+	}, got); diff != "" {
+		t.Errorf("applyQuirks() diff (-want +got):\n%s", diff)
+	}
+
+	if name := input.Items[0].Items[1].Name; name != "WW" {
+		t.Errorf("applyQuirks() modified input: %q", name)
+	}
+}
+
+func TestDetectQuirks(t *testing.T) {
+	c := newCollector(collectorOpts{
+		terms: luxwslang.German,
+		loc:   time.UTC,
+	})
+
+	input := &luxwsclient.ContentRoot{
+		Items: luxwsclient.ContentItems{
+			{
+				Name: "Anlagenstatus",
+				Items: luxwsclient.ContentItems{
+					{Name: "Wärmepumpen Typ", Value: luxwsclient.String("l2a")},
+					{Name: "Softwarestand", Value: luxwsclient.String("v1.86.2")},
+				},
+			},
+		},
+	}
+
+	a := &adapter{
+		c:           c,
+		metricNames: []string{"luxws_quirk_active"},
+		collect: func(ch chan<- prometheus.Metric) error {
+			_, q, missing := c.detectQuirks(ch, input)
+
+			if diff := cmp.Diff(quirks{
+				MissingSuppliedHeat: true,
+				Active:              []string{"l2a_missing_supplied_heat"},
+			}, q); diff != "" {
+				t.Errorf("Quirks diff (-want +got):\n%s", diff)
+			}
+
+			if !missing["supplied_heat"] {
+				t.Errorf("Collector supplied_heat not missing: %v", missing)
+			}
+
+			return nil
+		},
+	}
+	a.collectAndCompare(t, quirkActiveMetrics("l2a_missing_supplied_heat"), nil)
+}
+
+func TestOutcomeNames(t *testing.T) {
+	c := newCollector(collectorOpts{
+		terms: luxwslang.German,
+		loc:   time.UTC,
+		quirks: &quirksDB{defs: []quirkDef{{
+			Name:    "test",
+			Renames: []quirkRename{{Group: "Wärmemenge", From: "WW", To: "Warmwasser"}},
+		}}},
+	})
+
+	group := &luxwsclient.ContentItem{
+		Name: "Wärmemenge",
+		Items: luxwsclient.ContentItems{
+			{Name: "Heizung", Value: luxwsclient.String("1234,5 kWh")},
+			{Name: "WW", Value: luxwsclient.String("500 kWh")},
+		},
+	}
+
+	got := c.outcomeNames(&luxwsclient.ContentRoot{Items: luxwsclient.ContentItems{group}})
+
+	if diff := cmp.Diff(outcomeNames{
+		group:          {"", "Wärmemenge"},
+		group.Items[0]: {"Wärmemenge", "Heizung"},
+		group.Items[1]: {"Wärmemenge", "Warmwasser"},
+	}, got, cmp.AllowUnexported(outcomeName{})); diff != "" {
+		t.Errorf("outcomeNames() diff (-want +got):\n%s", diff)
+	}
+}
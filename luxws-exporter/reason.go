@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"github.com/hansmi/wp2reg-luxws/luxws"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+)
+
+var errHTTPCollection = errors.New("collection via HTTP protocol failed")
+
+// errorReason classifies a scrape error into one of a fixed set of values
+// suitable for a metric label.
+func errorReason(err error) string {
+	for _, i := range []struct {
+		target error
+		reason string
+	}{
+		{luxwsclient.ErrAuth, "auth"},
+		{luxwsclient.ErrUnexpectedRoot, "unexpected_root"},
+		{luxwsclient.ErrTerminologyMismatch, "terminology"},
+		{luxws.ErrDial, "dial"},
+		{luxws.ErrTimeout, "timeout"},
+		{context.DeadlineExceeded, "timeout"},
+		{luxws.ErrProtocol, "protocol"},
+		{errHTTPCollection, "http"},
+	} {
+		if errors.Is(err, i.target) {
+			return i.reason
+		}
+	}
+
+	return "other"
+}
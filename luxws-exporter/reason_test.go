@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/hansmi/wp2reg-luxws/luxws"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"go.uber.org/multierr"
+)
+
+func TestErrorReason(t *testing.T) {
+	for _, tc := range []struct {
+		err  error
+		want string
+	}{
+		{errors.New("test"), "other"},
+		{fmt.Errorf("%w: connection refused", luxws.ErrDial), "dial"},
+		{fmt.Errorf("%w: %w", luxws.ErrDial, fmt.Errorf("%w: %w", luxws.ErrTimeout, context.DeadlineExceeded)), "dial"},
+		{fmt.Errorf("%w: %w", luxws.ErrTimeout, context.DeadlineExceeded), "timeout"},
+		{context.DeadlineExceeded, "timeout"},
+		{fmt.Errorf("%w: unexpected EOF", luxws.ErrProtocol), "protocol"},
+		{fmt.Errorf("%w: %w", luxwsclient.ErrAuth, luxwsclient.ErrUnexpectedRoot), "auth"},
+		{fmt.Errorf("%w (after %w)", luxws.ErrTimeout, luxwsclient.ErrUnexpectedRoot), "unexpected_root"},
+		{multierr.Combine(luxwsclient.ErrContentItemNotFound, luxwsclient.ErrContentItemNotFound), "terminology"},
+		{fmt.Errorf("info: %w", luxwsclient.ErrNavItemNotFound), "terminology"},
+		{fmt.Errorf("%w: status 500", errHTTPCollection), "http"},
+	} {
+		if got := errorReason(tc.err); got != tc.want {
+			t.Errorf("errorReason(%q) = %q, want %q", tc.err, got, tc.want)
+		}
+	}
+}
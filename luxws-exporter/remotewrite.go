@@ -0,0 +1,339 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/go-cleanhttp"
+	"github.com/klauspost/compress/snappy"
+	dto "github.com/prometheus/client_model/go"
+	"go.uber.org/zap"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+const remoteWriteSegmentSuffix = ".snappy"
+
+// encodeWriteRequest encodes samples as a Prometheus remote-write
+// WriteRequest protobuf message (remote-write protocol 1.0).
+func encodeWriteRequest(ts time.Time, samples []flatSample) []byte {
+	var buf []byte
+
+	tsMs := ts.UnixMilli()
+
+	for _, s := range samples {
+		if math.IsNaN(s.value) {
+			continue
+		}
+
+		names := make([]string, 0, len(s.labels)+1)
+
+		for k, v := range s.labels {
+			// Empty labels are equivalent to absent labels
+			if v != "" {
+				names = append(names, k)
+			}
+		}
+
+		names = append(names, "__name__")
+
+		// Labels must be sorted by name
+		sort.Strings(names)
+
+		var series []byte
+
+		for _, name := range names {
+			value := s.labels[name]
+
+			if name == "__name__" {
+				value = s.name
+			}
+
+			var label []byte
+			label = protowire.AppendTag(label, 1, protowire.BytesType)
+			label = protowire.AppendString(label, name)
+			label = protowire.AppendTag(label, 2, protowire.BytesType)
+			label = protowire.AppendString(label, value)
+
+			series = protowire.AppendTag(series, 1, protowire.BytesType)
+			series = protowire.AppendBytes(series, label)
+		}
+
+		var sample []byte
+		sample = protowire.AppendTag(sample, 1, protowire.Fixed64Type)
+		sample = protowire.AppendFixed64(sample, math.Float64bits(s.value))
+		sample = protowire.AppendTag(sample, 2, protowire.VarintType)
+		sample = protowire.AppendVarint(sample, uint64(tsMs))
+
+		series = protowire.AppendTag(series, 2, protowire.BytesType)
+		series = protowire.AppendBytes(series, sample)
+
+		buf = protowire.AppendTag(buf, 1, protowire.BytesType)
+		buf = protowire.AppendBytes(buf, series)
+	}
+
+	return buf
+}
+
+// remoteWriteQueue holds compressed write requests which have not been sent
+// yet. With a directory the requests are stored as files and survive
+// restarts.
+type remoteWriteQueue struct {
+	dir     string
+	maxSize int64
+
+	// Requests kept in memory if no directory is configured.
+	segments [][]byte
+}
+
+// segmentNames returns the names of all stored segments, oldest first.
+func (q *remoteWriteQueue) segmentNames() ([]string, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var names []string
+
+	for _, e := range entries {
+		if e.Type().IsRegular() && strings.HasSuffix(e.Name(), remoteWriteSegmentSuffix) {
+			names = append(names, e.Name())
+		}
+	}
+
+	// Names are zero-padded timestamps
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func (q *remoteWriteQueue) append(ts time.Time, data []byte) error {
+	if q.dir == "" {
+		q.segments = append(q.segments, data)
+
+		var total int64
+
+		for i := len(q.segments) - 1; i >= 0; i-- {
+			total += int64(len(q.segments[i]))
+
+			if q.maxSize > 0 && total > q.maxSize {
+				q.segments = append([][]byte(nil), q.segments[i+1:]...)
+				break
+			}
+		}
+
+		return nil
+	}
+
+	if err := os.MkdirAll(q.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%020d%s", ts.UnixNano(), remoteWriteSegmentSuffix)
+
+	if err := writeFileAtomic(filepath.Join(q.dir, name), data, 0o600); err != nil {
+		return err
+	}
+
+	return q.truncate()
+}
+
+// truncate removes the oldest segments until the total size is within the
+// limit.
+func (q *remoteWriteQueue) truncate() error {
+	if q.maxSize <= 0 {
+		return nil
+	}
+
+	names, err := q.segmentNames()
+	if err != nil {
+		return err
+	}
+
+	var total int64
+
+	for i := len(names) - 1; i >= 0; i-- {
+		fi, err := os.Stat(filepath.Join(q.dir, names[i]))
+		if err != nil {
+			return err
+		}
+
+		total += fi.Size()
+
+		if total > q.maxSize {
+			if err := os.Remove(filepath.Join(q.dir, names[i])); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// each calls fn for all segments, oldest first. Segments are removed if fn
+// returns true. Iteration stops at the first retained segment or on error.
+func (q *remoteWriteQueue) each(fn func(data []byte) (bool, error)) error {
+	if q.dir == "" {
+		for len(q.segments) > 0 {
+			remove, err := fn(q.segments[0])
+			if !remove {
+				return err
+			}
+
+			q.segments = q.segments[1:]
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	names, err := q.segmentNames()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range names {
+		path := filepath.Join(q.dir, name)
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		remove, err := fn(data)
+		if !remove {
+			return err
+		}
+
+		if removeErr := os.Remove(path); removeErr != nil {
+			return removeErr
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type remoteWriteOpts struct {
+	log *zap.Logger
+	url string
+
+	// Bearer token sent in the "Authorization" header if not empty. Basic
+	// authentication can be configured via the URL.
+	bearerToken string
+
+	// Directory for buffering requests which could not be sent. Requests are
+	// only kept in memory if empty.
+	walDir string
+
+	// Maximum size of buffered requests in bytes.
+	walMaxSize int64
+}
+
+// remoteWriteSink pushes samples to a Prometheus remote-write endpoint.
+type remoteWriteSink struct {
+	log         *zap.Logger
+	httpDo      func(req *http.Request) (*http.Response, error)
+	url         string
+	bearerToken string
+
+	mu    sync.Mutex
+	queue remoteWriteQueue
+}
+
+func newRemoteWriteSink(opts remoteWriteOpts) *remoteWriteSink {
+	return &remoteWriteSink{
+		log:         opts.log,
+		httpDo:      cleanhttp.DefaultClient().Do,
+		url:         opts.url,
+		bearerToken: opts.bearerToken,
+		queue: remoteWriteQueue{
+			dir:     opts.walDir,
+			maxSize: opts.walMaxSize,
+		},
+	}
+}
+
+func (s *remoteWriteSink) name() string {
+	return "remote-write"
+}
+
+// push stores the samples in the queue and sends all queued requests in the
+// order they were created.
+func (s *remoteWriteSink) push(ctx context.Context, ts time.Time, families []*dto.MetricFamily) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if samples := flattenFamilies(families); len(samples) > 0 {
+		if err := s.queue.append(ts, snappy.Encode(nil, encodeWriteRequest(ts, samples))); err != nil {
+			return fmt.Errorf("buffering remote-write request: %w", err)
+		}
+	}
+
+	return s.queue.each(func(data []byte) (bool, error) {
+		retry, err := s.send(ctx, data)
+		if err != nil && !retry {
+			// Retrying won't help, e.g. for out-of-order samples
+			if s.log != nil {
+				s.log.Error("Remote-write request rejected, dropping samples", zap.Error(err))
+			}
+
+			return true, nil
+		}
+
+		return err == nil, err
+	})
+}
+
+func (s *remoteWriteSink) send(ctx context.Context, data []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+
+	req.Header.Set("Content-Type", "application/x-protobuf")
+	req.Header.Set("Content-Encoding", "snappy")
+	req.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
+
+	if s.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+s.bearerToken)
+	}
+
+	resp, err := s.httpDo(req)
+	if err != nil {
+		return true, err
+	}
+
+	defer resp.Body.Close()
+
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+
+	err = fmt.Errorf("%s %s: HTTP status %s: %s", req.Method, req.URL.Redacted(), resp.Status, bytes.TrimSpace(body))
+
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
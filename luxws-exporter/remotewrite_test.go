@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/klauspost/compress/snappy"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// decodeWriteRequest converts a WriteRequest message into one line per
+// series in the form `name{label="value",...} value timestamp`.
+func decodeWriteRequest(t *testing.T, data []byte) []string {
+	t.Helper()
+
+	fields := func(b []byte, fn func(num protowire.Number, typ protowire.Type, b []byte) int) {
+		for len(b) > 0 {
+			num, typ, n := protowire.ConsumeTag(b)
+			if n < 0 {
+				t.Fatalf("Invalid tag: %v", protowire.ParseError(n))
+			}
+
+			b = b[n:]
+
+			if n = fn(num, typ, b); n < 0 {
+				t.Fatalf("Invalid field %d: %v", num, protowire.ParseError(n))
+			}
+
+			b = b[n:]
+		}
+	}
+
+	var result []string
+
+	fields(data, func(_ protowire.Number, _ protowire.Type, b []byte) int {
+		series, n := protowire.ConsumeBytes(b)
+
+		var name string
+		var labels []string
+		var sample string
+
+		fields(series, func(num protowire.Number, _ protowire.Type, b []byte) int {
+			msg, n := protowire.ConsumeBytes(b)
+
+			switch num {
+			case 1:
+				var lname, lvalue string
+
+				fields(msg, func(num protowire.Number, _ protowire.Type, b []byte) int {
+					v, n := protowire.ConsumeString(b)
+					if num == 1 {
+						lname = v
+					} else {
+						lvalue = v
+					}
+					return n
+				})
+
+				if lname == "__name__" {
+					name = lvalue
+				} else {
+					labels = append(labels, fmt.Sprintf("%s=%q", lname, lvalue))
+				}
+
+			case 2:
+				var value float64
+				var ts int64
+
+				fields(msg, func(num protowire.Number, typ protowire.Type, b []byte) int {
+					if num == 1 {
+						v, n := protowire.ConsumeFixed64(b)
+						value = math.Float64frombits(v)
+						return n
+					}
+
+					v, n := protowire.ConsumeVarint(b)
+					ts = int64(v)
+					return n
+				})
+
+				sample = fmt.Sprintf("%g %d", value, ts)
+			}
+
+			return n
+		})
+
+		result = append(result, fmt.Sprintf("%s{%s} %s", name, strings.Join(labels, ","), sample))
+
+		return n
+	})
+
+	return result
+}
+
+func TestEncodeWriteRequest(t *testing.T) {
+	families := gatherTestFamilies(t, func(c *collector, ch chan<- prometheus.Metric) {
+		ch <- prometheus.MustNewConstMetric(c.temperatureDesc, prometheus.GaugeValue, 3.1, "outdoor temp.", "degC")
+		ch <- prometheus.MustNewConstMetric(c.latestErrorDesc, prometheus.GaugeValue, 0, "")
+		ch <- (&histogramState{Count: 1, Sum: 30, Counts: []uint64{1}}).metric(c.compressorRunDesc, []float64{60})
+	})
+
+	got := decodeWriteRequest(t, encodeWriteRequest(time.UnixMilli(1725203567123), flattenFamilies(families)))
+
+	if diff := cmp.Diff([]string{
+		`luxws_compressor_run_duration_seconds_count{} 1 1725203567123`,
+		`luxws_compressor_run_duration_seconds_sum{} 30 1725203567123`,
+		`luxws_compressor_run_duration_seconds_bucket{le="60"} 1 1725203567123`,
+		`luxws_compressor_run_duration_seconds_bucket{le="+Inf"} 1 1725203567123`,
+		`luxws_latest_error{} 0 1725203567123`,
+		`luxws_temperature{name="outdoor temp.",unit="degC"} 3.1 1725203567123`,
+	}, got); diff != "" {
+		t.Errorf("WriteRequest diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRemoteWriteSinkPush(t *testing.T) {
+	for _, walDir := range []string{"", "wal"} {
+		t.Run(fmt.Sprintf("walDir=%q", walDir), func(t *testing.T) {
+			var mu sync.Mutex
+			var received []string
+
+			available := false
+
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				mu.Lock()
+				defer mu.Unlock()
+
+				if !available {
+					http.Error(w, "unavailable", http.StatusServiceUnavailable)
+					return
+				}
+
+				if got := r.Header.Get("Content-Encoding"); got != "snappy" {
+					t.Errorf("Content-Encoding is %q, want snappy", got)
+				}
+
+				body, _ := io.ReadAll(r.Body)
+
+				data, err := snappy.Decode(nil, body)
+				if err != nil {
+					t.Errorf("Decoding request failed: %v", err)
+				}
+
+				received = append(received, decodeWriteRequest(t, data)...)
+			}))
+			t.Cleanup(srv.Close)
+
+			opts := remoteWriteOpts{
+				url: srv.URL,
+			}
+
+			if walDir != "" {
+				opts.walDir = filepath.Join(t.TempDir(), walDir)
+			}
+
+			push := func(s *remoteWriteSink, value float64, ts int64) error {
+				return s.push(context.Background(), time.UnixMilli(ts), gatherTestFamilies(t, func(c *collector, ch chan<- prometheus.Metric) {
+					ch <- prometheus.MustNewConstMetric(c.temperatureDesc, prometheus.GaugeValue, value, "flow", "degC")
+				}))
+			}
+
+			s := newRemoteWriteSink(opts)
+
+			for i, value := range []float64{30, 31} {
+				if err := push(s, value, int64(1000*(i+1))); err == nil {
+					t.Errorf("push() succeeded despite unavailable endpoint")
+				}
+			}
+
+			if walDir != "" {
+				entries, err := os.ReadDir(opts.walDir)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if len(entries) != 2 {
+					t.Errorf("WAL contains %d entries, want 2", len(entries))
+				}
+
+				// Buffered requests survive restarts
+				s = newRemoteWriteSink(opts)
+			}
+
+			mu.Lock()
+			available = true
+			mu.Unlock()
+
+			if err := push(s, 32, 3000); err != nil {
+				t.Errorf("push() failed: %v", err)
+			}
+
+			if diff := cmp.Diff([]string{
+				`luxws_temperature{name="flow",unit="degC"} 30 1000`,
+				`luxws_temperature{name="flow",unit="degC"} 31 2000`,
+				`luxws_temperature{name="flow",unit="degC"} 32 3000`,
+			}, received); diff != "" {
+				t.Errorf("Received samples diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+}
+
+func TestRemoteWriteQueueMaxSize(t *testing.T) {
+	for _, dir := range []string{"", t.TempDir()} {
+		q := remoteWriteQueue{dir: dir, maxSize: 10}
+
+		for i, data := range []string{"aaaa", "bbbb", "cccc"} {
+			if err := q.append(time.Unix(int64(i), 0), []byte(data)); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var got []string
+
+		if err := q.each(func(data []byte) (bool, error) {
+			got = append(got, string(data))
+			return true, nil
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		if diff := cmp.Diff([]string{"bbbb", "cccc"}, got); diff != "" {
+			t.Errorf("Queue (dir %q) diff (-want +got):\n%s", dir, diff)
+		}
+	}
+}
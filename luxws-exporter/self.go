@@ -0,0 +1,79 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwscollect"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+type scrapePhase struct {
+	name     string
+	duration time.Duration
+}
+
+// scrapePhases measures the duration of consecutive phases of a scrape. All
+// methods can be called on a nil value.
+type scrapePhases struct {
+	last   time.Time
+	phases []scrapePhase
+}
+
+// start begins the first phase.
+func (p *scrapePhases) start() {
+	if p != nil {
+		p.last = time.Now()
+	}
+}
+
+// done finishes the current phase and begins the next one.
+func (p *scrapePhases) done(name string) {
+	if p == nil {
+		return
+	}
+
+	now := time.Now()
+
+	p.phases = append(p.phases, scrapePhase{name, now.Sub(p.last)})
+	p.last = now
+}
+
+func (p *scrapePhases) collect(ch chan<- prometheus.Metric, desc *prometheus.Desc) {
+	if p == nil {
+		return
+	}
+
+	for _, i := range p.phases {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.GaugeValue, i.duration.Seconds(), i.name)
+	}
+}
+
+// observeRoundTrip records the latency of a LuxWS request by command, e.g.
+// "GET".
+func (c *collector) observeRoundTrip(cmd string, duration time.Duration, _ error) {
+	name, _, _ := strings.Cut(cmd, ";")
+
+	c.roundTripDuration.WithLabelValues(name).Observe(duration.Seconds())
+}
+
+// parseError logs, counts and records an item value which couldn't be parsed.
+func (c *collector) parseError(env *luxwscollect.Env, groupName string, item *luxwsclient.ContentItem, err error) {
+	c.parseErrors.WithLabelValues(groupName, normalizeSpace(item.Name)).Inc()
+
+	env.Outcomes.ParseError(groupName, item.Name, err)
+
+	if c.log != nil {
+		c.log.Error("parseValue failed", zap.Error(err), zap.String("group", groupName), zap.Stringp("value", item.Value))
+	}
+}
+
+// recordItem records that an item contributed to the metrics of the given
+// descriptors.
+func (c *collector) recordItem(env *luxwscollect.Env, groupName, itemName string, descs ...*prometheus.Desc) {
+	for _, desc := range descs {
+		env.Outcomes.Metric(groupName, itemName, c.metricNames[desc])
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"go.uber.org/zap"
+)
+
+func TestSelfMetrics(t *testing.T) {
+	address, _ := newFakeController(t,
+		`<Navigation id="0x1"><item id="0x2"><name>information</name></item></Navigation>`,
+		map[string]string{
+			"0x2": `<Content><item id="0x10"><name>temperatures</name>` +
+				`<item id="0x11"><name>flow</name><value>30.2°C</value></item>` +
+				`<item id="0x12"><name>return</name><value>---</value></item></item>` +
+				`<item id="0x20"><name>elapsed times</name>` +
+				`<item id="0x21"><name>HP since</name><value>soon</value></item></item></Content>`,
+		})
+
+	c := newCollector(collectorOpts{
+		address: address,
+		log:     zap.NewNop(),
+		terms:   luxwslang.English,
+		loc:     time.UTC,
+		timeout: time.Minute,
+	})
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(c)
+
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(`
+# HELP luxws_parse_errors_total Number of values which couldn't be parsed
+# TYPE luxws_parse_errors_total counter
+luxws_parse_errors_total{group="elapsed times",name="HP since"} 1
+luxws_parse_errors_total{group="temperatures",name="return"} 1
+`), "luxws_parse_errors_total"); err != nil {
+		t.Error(err)
+	}
+
+	families, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	got := map[string][]string{}
+
+	for _, mf := range families {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				switch mf.GetName() {
+				case "luxws_scrape_duration_seconds", "luxws_roundtrip_duration_seconds":
+					got[mf.GetName()] = append(got[mf.GetName()], l.GetValue())
+				}
+			}
+		}
+	}
+
+	if diff := cmp.Diff(map[string][]string{
+		"luxws_roundtrip_duration_seconds": {"GET", "LOGIN"},
+		"luxws_scrape_duration_seconds":    {"dial", "get", "login", "parse"},
+	}, got); diff != "" {
+		t.Errorf("Labels diff (-want +got):\n%s", diff)
+	}
+}
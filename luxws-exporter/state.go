@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// stateData is the serialized form of the exporter state. Fields must remain
+// backwards compatible as the file survives upgrades.
+type stateData struct {
+	Counters      map[string]float64        `json:"counters,omitempty"`
+	CounterResets map[string]*counterResets `json:"counter_resets,omitempty"`
+	COPSamples    map[string][]copSample    `json:"cop_samples,omitempty"`
+	EstimatedHeat *estimatedHeat            `json:"estimated_heat,omitempty"`
+	Compressor    *compressorState          `json:"compressor,omitempty"`
+	Defrost       *defrostState             `json:"defrost,omitempty"`
+	Journal       journalState              `json:"journal"`
+	OperationMode string                    `json:"operation_mode,omitempty"`
+}
+
+// counterResets records how often a counter was found to have been reset.
+type counterResets struct {
+	Group string  `json:"group"`
+	Name  string  `json:"name"`
+	Count float64 `json:"count"`
+}
+
+// counterUpdate describes how a new counter value was handled.
+type counterUpdate int
+
+const (
+	counterAccepted counterUpdate = iota
+
+	// The value decreased slightly and the previous value is retained.
+	counterHeld
+
+	// The value decreased so much that the counter was reset.
+	counterReset
+)
+
+// stateStore holds values which need to survive between scrapes, e.g. the
+// most recent value of counters which must never decrease. All methods are
+// safe for concurrent use. If a path is given the state is persisted to
+// a file and restored on startup.
+type stateStore struct {
+	mu    sync.Mutex
+	path  string
+	dirty bool
+	data  stateData
+}
+
+func newStateStore(path string) (*stateStore, error) {
+	s := &stateStore{
+		path: path,
+	}
+
+	if path == "" {
+		return s, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return s, nil
+		}
+
+		return nil, err
+	}
+
+	if err := json.Unmarshal(content, &s.data); err != nil {
+		return nil, fmt.Errorf("decoding state file %q failed: %w", path, err)
+	}
+
+	return s, nil
+}
+
+// updateCounter stores the value of a counter which should never decrease.
+// A decrease of less than resetRatio times the previous value is considered
+// a measurement artifact (e.g. during defrost) and the previous value is
+// retained. Larger decreases are treated as a reset of the counter, i.e. the
+// new value is accepted and the reset is recorded. The value to report is
+// returned.
+func (s *stateStore) updateCounter(key, group, name string, value, resetRatio float64) (float64, counterUpdate) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Counters == nil {
+		s.data.Counters = map[string]float64{}
+	}
+
+	if s.data.CounterResets == nil {
+		s.data.CounterResets = map[string]*counterResets{}
+	}
+
+	resets := s.data.CounterResets[key]
+	if resets == nil {
+		resets = &counterResets{Group: group, Name: name}
+		s.data.CounterResets[key] = resets
+		s.dirty = true
+	}
+
+	prev, ok := s.data.Counters[key]
+	result := counterAccepted
+
+	if ok && value < prev {
+		if prev-value <= prev*resetRatio {
+			return prev, counterHeld
+		}
+
+		resets.Count++
+		result = counterReset
+	}
+
+	if !ok || prev != value {
+		s.data.Counters[key] = value
+		s.dirty = true
+	}
+
+	return value, result
+}
+
+// eachCounterResets invokes fn for every counter known to the store. The
+// order is unspecified.
+func (s *stateStore) eachCounterResets(fn func(counterResets)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, r := range s.data.CounterResets {
+		fn(*r)
+	}
+}
+
+// save writes the state to its file if it was modified since the last call.
+// The file is replaced atomically.
+func (s *stateStore) save() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.path == "" || !s.dirty {
+		return nil
+	}
+
+	content, err := json.Marshal(s.data)
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(s.path, content, 0o600); err != nil {
+		return fmt.Errorf("writing state file failed: %w", err)
+	}
+
+	s.dirty = false
+
+	return nil
+}
+
+// writeFileAtomic writes content to a temporary file in the same directory as
+// path and renames it to the final name. Readers never see partial content.
+func writeFileAtomic(path string, content []byte, perm os.FileMode) (err error) {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	if _, err = tmp.Write(content); err != nil {
+		return err
+	}
+
+	if err = tmp.Sync(); err != nil {
+		return err
+	}
+
+	if err = tmp.Chmod(perm); err != nil {
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestStateStoreUpdateCounter(t *testing.T) {
+	s, err := newStateStore("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		value      float64
+		want       float64
+		wantUpdate counterUpdate
+		wantResets float64
+	}{
+		{value: 100, want: 100, wantUpdate: counterAccepted},
+		{value: 120, want: 120, wantUpdate: counterAccepted},
+		{value: 119.5, want: 120, wantUpdate: counterHeld},
+		{value: 120, want: 120, wantUpdate: counterAccepted},
+		{value: 3, want: 3, wantUpdate: counterReset, wantResets: 1},
+		{value: 2, want: 3, wantUpdate: counterHeld, wantResets: 1},
+		{value: 10, want: 10, wantUpdate: counterAccepted, wantResets: 1},
+		{value: 0, want: 0, wantUpdate: counterReset, wantResets: 2},
+	} {
+		got, update := s.updateCounter("key", "group", "name", tc.value, 0.5)
+
+		if got != tc.want || update != tc.wantUpdate {
+			t.Errorf("updateCounter(%v) = (%v, %v), want (%v, %v)", tc.value, got, update, tc.want, tc.wantUpdate)
+		}
+
+		if diff := cmp.Diff(&counterResets{Group: "group", Name: "name", Count: tc.wantResets}, s.data.CounterResets["key"]); diff != "" {
+			t.Errorf("Counter resets diff (-want +got):\n%s", diff)
+		}
+	}
+}
+
+func TestStateStoreConcurrent(t *testing.T) {
+	s, err := newStateStore(filepath.Join(t.TempDir(), "state.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+
+	for i := range 8 {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for j := range 100 {
+				s.updateCounter("key", "", "", float64(i*100+j), 1)
+
+				if err := s.save(); err != nil {
+					t.Errorf("save() failed: %v", err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if got, _ := s.updateCounter("key", "", "", 0, 1); got != 799 {
+		t.Errorf("Counter value is %v, want 799", got)
+	}
+}
+
+func TestStateStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	s, err := newStateStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s.updateCounter("a", "group", "a", 100, 0.5)
+	s.updateCounter("b", "group", "b", 2.5, 0.5)
+
+	if err := s.save(); err != nil {
+		t.Fatalf("save() failed: %v", err)
+	}
+
+	restored, err := newStateStore(path)
+	if err != nil {
+		t.Fatalf("newStateStore() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(s.data, restored.data); diff != "" {
+		t.Errorf("Restored state diff (-want +got):\n%s", diff)
+	}
+
+	if got, update := restored.updateCounter("a", "group", "a", 99, 0.5); got != 100 || update != counterHeld {
+		t.Errorf("Decreasing value not held after restore: (%v, %v)", got, update)
+	}
+}
+
+func TestStateStoreInvalidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.json")
+
+	if err := os.WriteFile(path, []byte("{"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := newStateStore(path); err == nil {
+		t.Errorf("newStateStore() succeeded with invalid file")
+	}
+}
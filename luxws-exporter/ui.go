@@ -0,0 +1,29 @@
+package main
+
+import (
+	_ "embed"
+	"html/template"
+	"net/http"
+)
+
+//go:embed ui/index.html
+var uiIndexHTML string
+
+var uiIndexTemplate = template.Must(template.New("index").Parse(uiIndexHTML))
+
+// newUIHandler serves the web UI for browsing the controller. All data is
+// loaded from the JSON API.
+func newUIHandler(metricsPath string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+		uiIndexTemplate.Execute(w, struct {
+			MetricsPath string
+		}{metricsPath})
+	})
+}
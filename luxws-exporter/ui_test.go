@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestUIHandler(t *testing.T) {
+	h := newUIHandler("/custom-metrics")
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+
+	if rec.Code != http.StatusOK {
+		t.Errorf("Status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	if body := rec.Body.String(); !strings.Contains(body, `href="/custom-metrics"`) {
+		t.Errorf("Page does not link to metrics path:\n%s", body)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/missing", nil))
+
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Status %d, want %d", rec.Code, http.StatusNotFound)
+	}
+}
@@ -3,8 +3,11 @@ package luxws
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"net/url"
+	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -20,6 +23,26 @@ var ErrNotRunning = errors.New("receiver not running")
 // are made.
 var ErrBusy = errors.New("connection is busy")
 
+// ErrDial is wrapped by errors establishing a connection.
+var ErrDial = errors.New("dial failed")
+
+// ErrTimeout is wrapped by errors caused by a deadline being exceeded.
+var ErrTimeout = errors.New("timeout")
+
+// ErrProtocol is wrapped by errors caused by the connection failing or by
+// malformed messages.
+var ErrProtocol = errors.New("protocol error")
+
+// wrapTimeout wraps errors caused by an exceeded deadline in ErrTimeout.
+func wrapTimeout(err error) error {
+	if err != nil && !errors.Is(err, ErrTimeout) &&
+		(errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded)) {
+		return fmt.Errorf("%w: %w", ErrTimeout, err)
+	}
+
+	return err
+}
+
 // Option is the type of options for transports.
 type Option func(*transport)
 
@@ -31,6 +54,40 @@ func WithLogFunc(log *zap.Logger) Option {
 	}
 }
 
+// MessageFunc is the prototype for functions receiving a copy of all messages.
+// Sent is true for outgoing messages.
+type MessageFunc func(sent bool, payload []byte)
+
+// WithMessageFunc supplies a function called for every sent and received
+// message. Outgoing commands are passed unmodified, i.e. including passwords
+// (see RedactCommand).
+func WithMessageFunc(fn MessageFunc) Option {
+	return func(t *transport) {
+		t.messageFn = fn
+	}
+}
+
+// RedactCommand replaces the password in a "LOGIN" command. Other commands are
+// returned unmodified.
+func RedactCommand(cmd string) string {
+	if rest, ok := strings.CutPrefix(cmd, "LOGIN;"); ok && rest != "" {
+		return "LOGIN;<redacted>"
+	}
+
+	return cmd
+}
+
+// RoundTripFunc is the prototype for functions observing round trips. The
+// command is redacted (see RedactCommand).
+type RoundTripFunc func(cmd string, duration time.Duration, err error)
+
+// WithRoundTripFunc supplies a function called after every round trip.
+func WithRoundTripFunc(fn RoundTripFunc) Option {
+	return func(t *transport) {
+		t.roundTripFn = fn
+	}
+}
+
 type websocketConn interface {
 	LocalAddr() net.Addr
 	RemoteAddr() net.Addr
@@ -50,7 +107,9 @@ type Transport struct {
 }
 
 type transport struct {
-	log *zap.Logger
+	log         *zap.Logger
+	messageFn   MessageFunc
+	roundTripFn RoundTripFunc
 
 	mu       sync.Mutex
 	ws       websocketConn
@@ -96,7 +155,7 @@ func Dial(ctx context.Context, address string, opts ...Option) (*Transport, erro
 
 	ws, _, err := dialer.DialContext(ctx, url.String(), nil)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("%w: %w", ErrDial, wrapTimeout(err))
 	}
 
 	return newTransport(ws, opts), nil
@@ -140,6 +199,8 @@ func (t *transport) receiver() {
 
 	if err == nil {
 		err = ErrNotRunning
+	} else {
+		err = fmt.Errorf("%w: %w", ErrProtocol, err)
 	}
 
 	t.mu.Lock()
@@ -165,7 +226,12 @@ func (t *transport) receiverLoop() error {
 				zap.ByteString("payload", payload),
 			)
 		}
+
 		if messageType == websocket.TextMessage && len(payload) > 0 {
+			if t.messageFn != nil {
+				t.messageFn(false, payload)
+			}
+
 			t.mu.Lock()
 			handler := t.handler
 			t.mu.Unlock()
@@ -192,10 +258,14 @@ func (t *transport) writeMessage(ctx context.Context, cmd string) error {
 		t.log.Debug(
 			"Sending message",
 			zap.Int("type", messageType),
-			zap.String("command", cmd),
+			zap.String("command", RedactCommand(cmd)),
 		)
 	}
 
+	if t.messageFn != nil {
+		t.messageFn(true, []byte(cmd))
+	}
+
 	if err := t.ws.WriteMessage(messageType, []byte(cmd)); err != nil {
 		return err
 	}
@@ -252,6 +322,39 @@ func (t *transport) roundTrip(ctx context.Context, req string, handler *response
 // acceptable response the handler must return nil. If the message is not
 // acceptable, but not an error, ErrIgnore can be returned by the handler. In
 // all other cases an error must be returned.
+//
+// Errors caused by an exceeded deadline wrap ErrTimeout.
 func (t *transport) RoundTrip(ctx context.Context, req string, fn ResponseHandlerFunc) error {
-	return t.roundTrip(ctx, req, newResponseHandler(fn))
+	start := time.Now()
+
+	err := wrapTimeout(t.roundTrip(ctx, req, newResponseHandler(fn)))
+
+	if t.roundTripFn != nil {
+		t.roundTripFn(RedactCommand(req), time.Since(start), err)
+	}
+
+	return err
+}
+
+// Send sends a request as a single message without waiting for a response.
+// It's meant for commands to which the server doesn't respond, e.g. "SET".
+func (t *transport) Send(ctx context.Context, req string) error {
+	var err error
+
+	t.mu.Lock()
+	select {
+	case <-t.recvDone:
+		err = t.recvErr
+	default:
+		if t.handler != nil {
+			err = ErrBusy
+		}
+	}
+
+	if err == nil {
+		err = t.writeMessage(ctx, req)
+	}
+	t.mu.Unlock()
+
+	return wrapTimeout(err)
 }
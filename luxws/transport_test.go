@@ -3,6 +3,7 @@ package luxws
 import (
 	"context"
 	"errors"
+	"fmt"
 	"net"
 	"runtime"
 	"strings"
@@ -10,8 +11,10 @@ import (
 	"testing"
 	"time"
 
+	"github.com/google/go-cmp/cmp"
 	"github.com/gorilla/websocket"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 type cannedMessage struct {
@@ -189,7 +192,7 @@ func TestRoundTripAfterFailedRead(t *testing.T) {
 		return nil
 	}
 
-	if err := tr.RoundTrip(ctx, "first", nil); !errors.Is(err, errTest) {
+	if err := tr.RoundTrip(ctx, "first", nil); !(errors.Is(err, errTest) && errors.Is(err, ErrProtocol)) {
 		t.Errorf("RoundTrip() failed: %v", err)
 	}
 
@@ -219,6 +222,22 @@ func TestRoundTripAfterContextCancel(t *testing.T) {
 	}
 }
 
+func TestRoundTripTimeout(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	t.Cleanup(cancel)
+
+	fc, tr := newFakeTransport(t)
+
+	fc.handleWrite = func([]byte, chan<- cannedMessage) error {
+		// No response
+		return nil
+	}
+
+	if err := tr.RoundTrip(ctx, "req", nil); !(errors.Is(err, ErrTimeout) && errors.Is(err, context.DeadlineExceeded)) {
+		t.Errorf("RoundTrip() didn't time out: %v", err)
+	}
+}
+
 func TestCancelDuringWrite(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	t.Cleanup(cancel)
@@ -316,3 +335,150 @@ func TestRoundTrip(t *testing.T) {
 		t.Errorf("RoundTrip() failed: %v", err)
 	}
 }
+
+func TestMessageFunc(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	var mu sync.Mutex
+	var got []string
+
+	fc := newFakeConn(t)
+	tr := newTransport(fc, []Option{
+		WithMessageFunc(func(sent bool, payload []byte) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			got = append(got, fmt.Sprintf("%t %s", sent, payload))
+		}),
+	})
+	t.Cleanup(func() {
+		tr.Close()
+	})
+
+	fc.handleWrite = func(payload []byte, out chan<- cannedMessage) error {
+		out <- cannedMessage{
+			messageType: websocket.TextMessage,
+			payload:     []byte("response"),
+		}
+
+		return nil
+	}
+
+	if err := tr.RoundTrip(ctx, "LOGIN;1234", func([]byte) error { return nil }); err != nil {
+		t.Errorf("RoundTrip() failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if diff := cmp.Diff([]string{"true LOGIN;1234", "false response"}, got); diff != "" {
+		t.Errorf("Messages diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestRedactCommand(t *testing.T) {
+	for _, tc := range []struct {
+		cmd  string
+		want string
+	}{
+		{cmd: "LOGIN;999999", want: "LOGIN;<redacted>"},
+		{cmd: "LOGIN;", want: "LOGIN;"},
+		{cmd: "GET;0x1234", want: "GET;0x1234"},
+		{cmd: "REFRESH", want: "REFRESH"},
+	} {
+		if got := RedactCommand(tc.cmd); got != tc.want {
+			t.Errorf("RedactCommand(%q) = %q, want %q", tc.cmd, got, tc.want)
+		}
+	}
+}
+
+func TestRoundTripFunc(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	errTest := errors.New("test")
+
+	var got []string
+
+	fc := newFakeConn(t)
+	tr := newTransport(fc, []Option{
+		WithRoundTripFunc(func(cmd string, d time.Duration, err error) {
+			if d < 0 {
+				t.Errorf("Negative duration %v", d)
+			}
+
+			got = append(got, fmt.Sprintf("%s %v", cmd, err))
+		}),
+	})
+	t.Cleanup(func() {
+		tr.Close()
+	})
+
+	fc.handleWrite = func(payload []byte, out chan<- cannedMessage) error {
+		out <- cannedMessage{
+			messageType: websocket.TextMessage,
+			payload:     []byte("response"),
+		}
+
+		return nil
+	}
+
+	if err := tr.RoundTrip(ctx, "LOGIN;1234", func([]byte) error { return nil }); err != nil {
+		t.Errorf("RoundTrip() failed: %v", err)
+	}
+
+	if err := tr.RoundTrip(ctx, "GET;0x1", func([]byte) error { return errTest }); !errors.Is(err, errTest) {
+		t.Errorf("RoundTrip() returned %v, want %v", err, errTest)
+	}
+
+	if diff := cmp.Diff([]string{"LOGIN;<redacted> <nil>", "GET;0x1 test"}, got); diff != "" {
+		t.Errorf("Round trips diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestLogRedactsPassword(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	core, logs := observer.New(zap.DebugLevel)
+
+	fc := newFakeConn(t)
+	tr := newTransport(fc, []Option{
+		WithLogFunc(zap.New(core)),
+	})
+	t.Cleanup(func() {
+		tr.Close()
+	})
+
+	fc.handleWrite = func(payload []byte, out chan<- cannedMessage) error {
+		out <- cannedMessage{
+			messageType: websocket.TextMessage,
+			payload:     []byte("<Navigation/>"),
+		}
+
+		return nil
+	}
+
+	if err := tr.RoundTrip(ctx, "LOGIN;topsecret", func([]byte) error { return nil }); err != nil {
+		t.Errorf("RoundTrip() failed: %v", err)
+	}
+
+	var found bool
+
+	for _, entry := range logs.All() {
+		for key, value := range entry.ContextMap() {
+			if strings.Contains(fmt.Sprint(value), "topsecret") {
+				t.Errorf("Log message %q contains password in field %q", entry.Message, key)
+			}
+
+			if value == "LOGIN;<redacted>" {
+				found = true
+			}
+		}
+	}
+
+	if !found {
+		t.Errorf("Redacted login command not logged: %v", logs.All())
+	}
+}
@@ -3,6 +3,9 @@ package luxwsclient
 import (
 	"context"
 	"encoding/xml"
+	"errors"
+	"fmt"
+	"sync"
 
 	"go.uber.org/zap"
 
@@ -23,6 +26,7 @@ func String(s string) *string {
 
 type transport interface {
 	RoundTrip(context.Context, string, luxws.ResponseHandlerFunc) error
+	Send(context.Context, string) error
 	Close() error
 }
 
@@ -36,10 +40,28 @@ func WithLogFunc(log *zap.Logger) Option {
 	}
 }
 
+// WithMessageFunc supplies a function receiving all sent and received
+// messages (see luxws.WithMessageFunc).
+func WithMessageFunc(fn luxws.MessageFunc) Option {
+	return func(c *Client) {
+		c.messageFn = fn
+	}
+}
+
+// WithRoundTripFunc supplies a function observing all round trips (see
+// luxws.WithRoundTripFunc).
+func WithRoundTripFunc(fn luxws.RoundTripFunc) Option {
+	return func(c *Client) {
+		c.roundTripFn = fn
+	}
+}
+
 // Client is a wrapper around an underlying LuxWS connection.
 type Client struct {
-	log *zap.Logger
-	t   transport
+	log         *zap.Logger
+	messageFn   luxws.MessageFunc
+	roundTripFn luxws.RoundTripFunc
+	t           transport
 }
 
 // Dial connects to a LuxWS server. The address must have the format
@@ -56,7 +78,8 @@ func Dial(ctx context.Context, address string, opts ...Option) (*Client, error)
 		opt(c)
 	}
 
-	if c.t, err = luxws.Dial(ctx, address, luxws.WithLogFunc(c.log)); err != nil {
+	if c.t, err = luxws.Dial(ctx, address, luxws.WithLogFunc(c.log),
+		luxws.WithMessageFunc(c.messageFn), luxws.WithRoundTripFunc(c.roundTripFn)); err != nil {
 		return nil, err
 	}
 
@@ -68,17 +91,69 @@ func (c *Client) Close() error {
 	return c.t.Close()
 }
 
+// roundTrip sends a request and passes responses to fn. If the request fails
+// after responses with an unexpected root element were ignored, the last of
+// them is included in the returned error.
+func (c *Client) roundTrip(ctx context.Context, req string, fn luxws.ResponseHandlerFunc) error {
+	var mu sync.Mutex
+	var unexpected error
+
+	err := c.t.RoundTrip(ctx, req, func(payload []byte) error {
+		err := fn(payload)
+
+		if errors.Is(err, ErrUnexpectedRoot) {
+			mu.Lock()
+			unexpected = err
+			mu.Unlock()
+		}
+
+		return err
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err != nil && unexpected != nil {
+		err = fmt.Errorf("%w (after %w)", err, unexpected)
+	}
+
+	return err
+}
+
 // Login sends a "LOGIN" command. The navigation structure is returned.
 func (c *Client) Login(ctx context.Context, password string) (result *NavRoot, err error) {
-	return result, c.t.RoundTrip(ctx, "LOGIN;"+password, func(payload []byte) error {
+	err = c.roundTrip(ctx, "LOGIN;"+password, func(payload []byte) error {
+		var err error
 		result, err = NewNavRoot(payload, "navigation")
 		return err
 	})
+
+	if errors.Is(err, ErrUnexpectedRoot) {
+		err = fmt.Errorf("%w: %w", ErrAuth, err)
+	}
+
+	return result, err
 }
 
 // Get sends a "GET" command. The page content is returned.
 func (c *Client) Get(ctx context.Context, id string) (result *ContentRoot, err error) {
-	return result, c.t.RoundTrip(ctx, "GET;"+id, func(payload []byte) error {
+	return result, c.roundTrip(ctx, "GET;"+id, func(payload []byte) error {
+		result, err = NewContentRoot(payload, "content")
+		return err
+	})
+}
+
+// Set sends a "SET" command changing the value of a parameter on the most
+// recently retrieved page. The server doesn't respond to the command. Changes
+// are only applied after a call to Save.
+func (c *Client) Set(ctx context.Context, id, value string) error {
+	return c.t.Send(ctx, "SET;set_"+id+";"+value)
+}
+
+// Save sends a "SAVE" command to apply changes made using Set. The updated
+// page content is returned.
+func (c *Client) Save(ctx context.Context) (result *ContentRoot, err error) {
+	return result, c.roundTrip(ctx, "SAVE;1", func(payload []byte) error {
 		result, err = NewContentRoot(payload, "content")
 		return err
 	})
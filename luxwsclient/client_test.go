@@ -14,6 +14,7 @@ import (
 
 	"github.com/google/go-cmp/cmp"
 	"github.com/gorilla/websocket"
+	"github.com/hansmi/wp2reg-luxws/luxws"
 )
 
 func newTestClient(t *testing.T, handleRoundTrip func(string) (string, error)) *Client {
@@ -280,3 +281,81 @@ func TestGet(t *testing.T) {
 		})
 	}
 }
+
+func TestSetAndSave(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	var requests []string
+
+	c := newTestClient(t, func(req string) (string, error) {
+		requests = append(requests, req)
+
+		if req == "SAVE;1" {
+			return `<Content><item id="0x10"><name>Warmwasser-Soll</name><raw>485</raw><value>48.5°C</value></item></Content>`, nil
+		}
+
+		// No response to SET
+		return "", nil
+	})
+
+	if err := c.Set(ctx, "0x10", "485"); err != nil {
+		t.Errorf("Set() failed: %v", err)
+	}
+
+	got, err := c.Save(ctx)
+	if err != nil {
+		t.Fatalf("Save() failed: %v", err)
+	}
+
+	if diff := cmp.Diff(&ContentRoot{
+		XMLName: xml.Name{Local: "Content"},
+		Items: []*ContentItem{
+			{ID: "0x10", Name: "Warmwasser-Soll", Raw: String("485"), Value: String("48.5°C")},
+		},
+	}, got); diff != "" {
+		t.Errorf("Content difference (-want +got):\n%s", diff)
+	}
+
+	if diff := cmp.Diff([]string{"SET;set_0x10;485", "SAVE;1"}, requests); diff != "" {
+		t.Errorf("Requests difference (-want +got):\n%s", diff)
+	}
+}
+
+func TestLoginUnexpectedRoot(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	t.Cleanup(cancel)
+
+	c := newTestClient(t, func(string) (string, error) {
+		return "<Content></Content>", nil
+	})
+
+	_, err := c.Login(ctx, "1234")
+
+	for _, want := range []error{ErrAuth, ErrUnexpectedRoot, luxws.ErrTimeout, context.DeadlineExceeded} {
+		if !errors.Is(err, want) {
+			t.Errorf("Login() error %q doesn't wrap %q", err, want)
+		}
+	}
+}
+
+func TestGetWrongFormatIsProtocolError(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	c := newTestClient(t, func(string) (string, error) {
+		return "<definitely<not<xml", nil
+	})
+
+	if _, err := c.Get(ctx, "0x1"); !errors.Is(err, luxws.ErrProtocol) {
+		t.Errorf("Get() error %q doesn't wrap %q", err, luxws.ErrProtocol)
+	}
+}
+
+func TestNotFoundErrors(t *testing.T) {
+	for _, err := range []error{ErrContentItemNotFound, ErrNavItemNotFound} {
+		if !errors.Is(err, ErrTerminologyMismatch) {
+			t.Errorf("%q doesn't wrap %q", err, ErrTerminologyMismatch)
+		}
+	}
+}
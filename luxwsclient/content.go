@@ -4,6 +4,8 @@ import (
 	"encoding/xml"
 	"errors"
 	"fmt"
+	"math"
+	"strconv"
 	"strings"
 
 	"github.com/hansmi/wp2reg-luxws/luxws"
@@ -12,12 +14,12 @@ import (
 func NewContentRoot(rawXML []byte, wantLocalName string) (*ContentRoot, error) {
 	var cr ContentRoot
 	if err := xmlUnmarshal(rawXML, &cr); err != nil {
-		return nil, fmt.Errorf("failed to decode ContentRoot: %w", err)
+		return nil, fmt.Errorf("%w: failed to decode ContentRoot: %w", luxws.ErrProtocol, err)
 	}
 	if strings.ToLower(cr.XMLName.Local) == wantLocalName {
 		return &cr, nil
 	}
-	return nil, luxws.ErrIgnore
+	return nil, unexpectedRoot(cr.XMLName, wantLocalName)
 }
 
 // ContentRoot contains all items returned by a GET request to a LuxWS server.
@@ -26,7 +28,9 @@ type ContentRoot struct {
 	Items   ContentItems `xml:"item"`
 }
 
-var ErrContentItemNotFound = errors.New("content item not found")
+// ErrContentItemNotFound is returned when a content item isn't found by name.
+// It wraps ErrTerminologyMismatch.
+var ErrContentItemNotFound error = notFoundError("content item not found")
 
 // FindByName iterates through all items and finds the first with a given name.
 // Returns nil if none is found.
@@ -82,6 +86,32 @@ func CmpNameAndItems(name string) CompareFn {
 	}
 }
 
+// FindPath resolves a path of names within content items. The children of
+// the innermost item are returned along with its name.
+func (items ContentItems) FindPath(path []string) (ContentItems, string, bool) {
+	var groupName string
+
+	for _, name := range path {
+		var next *ContentItem
+
+		for _, item := range items {
+			if item.Name == name {
+				next = item
+				break
+			}
+		}
+
+		if next == nil {
+			return nil, "", false
+		}
+
+		items = next.Items
+		groupName = next.Name
+	}
+
+	return items, groupName, true
+}
+
 func (items ContentItems) findContentItemByName(cmpFn CompareFn) *ContentItem {
 	for _, i := range items {
 		if cmpFn(i) {
@@ -94,6 +124,93 @@ func (items ContentItems) findContentItemByName(cmpFn CompareFn) *ContentItem {
 	return nil
 }
 
+// SplitPath splits a path of slash-separated names as used with
+// NavRoot.FindPath and ContentItems.FindPath, e.g.
+// "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll". Surrounding
+// whitespace and empty names are removed.
+func SplitPath(path string) []string {
+	var result []string
+
+	for _, name := range strings.Split(path, "/") {
+		if name = strings.TrimSpace(name); name != "" {
+			result = append(result, name)
+		}
+	}
+
+	return result
+}
+
+// ErrInvalidValue is returned for values not accepted by a parameter.
+var ErrInvalidValue = errors.New("invalid value")
+
+// RawValue validates a value for a parameter and returns the raw value to
+// send to the controller (see Client.Set). Numeric values are given in the
+// displayed unit and must be within the bounds of the parameter. For
+// parameters with options either the option name or its value is accepted.
+func (ci *ContentItem) RawValue(value string) (string, error) {
+	value = strings.TrimSpace(value)
+
+	if len(ci.Options) > 0 {
+		for _, opt := range ci.Options {
+			if value == opt.Value || value == strings.TrimSpace(opt.Name) {
+				return opt.Value, nil
+			}
+		}
+
+		return "", fmt.Errorf("%w: %q is not an option of %q", ErrInvalidValue, value, ci.Name)
+	}
+
+	if ci.Min == nil || ci.Max == nil {
+		return "", fmt.Errorf("%w: %q is not a writable parameter", ErrInvalidValue, ci.Name)
+	}
+
+	parse := func(s *string, def float64) (float64, error) {
+		if s == nil {
+			return def, nil
+		}
+
+		return strconv.ParseFloat(strings.TrimSpace(*s), 64)
+	}
+
+	v, err := strconv.ParseFloat(strings.Replace(value, ",", ".", 1), 64)
+	if err != nil || math.IsNaN(v) || math.IsInf(v, 0) {
+		return "", fmt.Errorf("%w: %q is not a number", ErrInvalidValue, value)
+	}
+
+	var min, max, step, div float64
+
+	for _, i := range []struct {
+		dest *float64
+		s    *string
+		def  float64
+	}{
+		{&min, ci.Min, 0},
+		{&max, ci.Max, 0},
+		{&step, ci.Step, 0},
+		{&div, ci.Div, 1},
+	} {
+		if *i.dest, err = parse(i.s, i.def); err != nil {
+			return "", fmt.Errorf("parsing bounds of %q: %w", ci.Name, err)
+		}
+	}
+
+	if div <= 0 {
+		div = 1
+	}
+
+	raw := math.Round(v * div)
+
+	if raw < min || raw > max {
+		return "", fmt.Errorf("%w: %s is outside of range [%g, %g]", ErrInvalidValue, value, min/div, max/div)
+	}
+
+	if step > 0 && math.Mod(raw-min, step) != 0 {
+		return "", fmt.Errorf("%w: %s is not a multiple of %g starting at %g", ErrInvalidValue, value, step/div, min/div)
+	}
+
+	return strconv.FormatFloat(raw, 'f', -1, 64), nil
+}
+
 // ContentItemOption represents one option among others of a content item.
 type ContentItemOption struct {
 	Value string `xml:"value,attr"`
@@ -0,0 +1,92 @@
+package luxwsclient
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestSplitPath(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"/", nil},
+		{"Informationen", []string{"Informationen"}},
+		{" Einstellungen / Warmwasser//Temperaturen/ ", []string{"Einstellungen", "Warmwasser", "Temperaturen"}},
+	} {
+		if diff := cmp.Diff(tc.want, SplitPath(tc.input)); diff != "" {
+			t.Errorf("SplitPath(%q) diff (-want +got):\n%s", tc.input, diff)
+		}
+	}
+}
+
+func TestContentItemRawValue(t *testing.T) {
+	temperature := &ContentItem{
+		Name:  "Warmwasser-Soll",
+		Min:   String("300"),
+		Max:   String("650"),
+		Step:  String("5"),
+		Div:   String("10.00"),
+		Value: String("48.0°C"),
+	}
+
+	mode := &ContentItem{
+		Name: "Regelung MK1",
+		Options: []*ContentItemOption{
+			{Value: "0", Name: "schnell"},
+			{Value: "1", Name: "mittel"},
+		},
+		Value: String("schnell"),
+	}
+
+	for _, tc := range []struct {
+		item    *ContentItem
+		value   string
+		want    string
+		wantErr error
+	}{
+		{item: temperature, value: "48.5", want: "485"},
+		{item: temperature, value: "50,0", want: "500"},
+		{item: temperature, value: "30", want: "300"},
+		{item: temperature, value: "65", want: "650"},
+		{item: temperature, value: "29.5", wantErr: ErrInvalidValue},
+		{item: temperature, value: "65.5", wantErr: ErrInvalidValue},
+		{item: temperature, value: "48.2", wantErr: ErrInvalidValue},
+		{item: temperature, value: "warm", wantErr: ErrInvalidValue},
+		{item: mode, value: "mittel", want: "1"},
+		{item: mode, value: "0", want: "0"},
+		{item: mode, value: "langsam", wantErr: ErrInvalidValue},
+		{item: &ContentItem{Name: "Smart Grid", Value: String("Nein")}, value: "Ja", wantErr: ErrInvalidValue},
+	} {
+		got, err := tc.item.RawValue(tc.value)
+
+		if !errors.Is(err, tc.wantErr) {
+			t.Errorf("RawValue(%q) of %q returned error %v, want %v", tc.value, tc.item.Name, err, tc.wantErr)
+		} else if got != tc.want {
+			t.Errorf("RawValue(%q) of %q = %q, want %q", tc.value, tc.item.Name, got, tc.want)
+		}
+	}
+}
+
+func TestContentItemsFindPath(t *testing.T) {
+	items := ContentItems{
+		{Name: "Temperaturen", Items: ContentItems{
+			{Name: "Vorlauf", Value: String("30.2°C")},
+		}},
+	}
+
+	if got, groupName, ok := items.FindPath([]string{"Temperaturen"}); !ok || groupName != "Temperaturen" || len(got) != 1 {
+		t.Errorf("FindPath() = (%v, %q, %v)", got, groupName, ok)
+	}
+
+	if got, _, ok := items.FindPath(nil); !ok || len(got) != 1 {
+		t.Errorf("FindPath(nil) = (%v, %v)", got, ok)
+	}
+
+	if _, _, ok := items.FindPath([]string{"Eingänge"}); ok {
+		t.Errorf("FindPath() found missing item")
+	}
+}
@@ -0,0 +1,36 @@
+package luxwsclient
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+
+	"github.com/hansmi/wp2reg-luxws/luxws"
+)
+
+// ErrAuth is returned when the server doesn't answer a "LOGIN" command with
+// the navigation structure.
+var ErrAuth = errors.New("login failed")
+
+// ErrUnexpectedRoot is wrapped by errors about responses with an unexpected
+// root element. Such responses are ignored (see luxws.ErrIgnore) and only
+// reported if no expected response arrives.
+var ErrUnexpectedRoot = errors.New("unexpected root element")
+
+// ErrTerminologyMismatch is wrapped by errors about items not found by name,
+// usually because the names don't match the language of the controller.
+var ErrTerminologyMismatch = errors.New("terminology mismatch")
+
+type notFoundError string
+
+func (e notFoundError) Error() string {
+	return string(e)
+}
+
+func (notFoundError) Is(target error) bool {
+	return target == ErrTerminologyMismatch
+}
+
+func unexpectedRoot(got xml.Name, want string) error {
+	return fmt.Errorf("%w: %w %q, want %q", luxws.ErrIgnore, ErrUnexpectedRoot, got.Local, want)
+}
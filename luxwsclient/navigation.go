@@ -25,14 +25,18 @@ func findNavItemByName(name string, items []NavItem) *NavItem {
 func NewNavRoot(rawXML []byte, wantLocalName string) (*NavRoot, error) {
 	var cr NavRoot
 	if err := xmlUnmarshal(rawXML, &cr); err != nil {
-		return nil, fmt.Errorf("failed to decode ContentRoot: %w", err)
+		return nil, fmt.Errorf("%w: failed to decode NavRoot: %w", luxws.ErrProtocol, err)
 	}
 	if strings.ToLower(cr.XMLName.Local) == wantLocalName {
 		return &cr, nil
 	}
-	return nil, luxws.ErrIgnore
+	return nil, unexpectedRoot(cr.XMLName, wantLocalName)
 }
 
+// ErrNavItemNotFound is returned when a navigation item isn't found by name.
+// It wraps ErrTerminologyMismatch.
+var ErrNavItemNotFound error = notFoundError("navigation item not found")
+
 // NavRoot represents the navigation structure of a LuxWS server.
 type NavRoot struct {
 	XMLName xml.Name
@@ -46,6 +50,36 @@ func (r *NavRoot) FindByName(name string) *NavItem {
 	return findNavItemByName(name, r.Items)
 }
 
+// FindPath resolves a path of names in the navigation structure. The deepest
+// item found is returned along with the remaining path elements not found in
+// the navigation. The item is nil if not even the first name is found.
+func (r *NavRoot) FindPath(path []string) (*NavItem, []string) {
+	var found *NavItem
+
+	items := r.Items
+
+	for len(path) > 0 {
+		var next *NavItem
+
+		for idx := range items {
+			if items[idx].Name == path[0] {
+				next = &items[idx]
+				break
+			}
+		}
+
+		if next == nil {
+			break
+		}
+
+		found = next
+		items = next.Items
+		path = path[1:]
+	}
+
+	return found, path
+}
+
 // NavItem is an individual entry in the navigation structure.
 type NavItem struct {
 	ID    string    `xml:"id,attr"`
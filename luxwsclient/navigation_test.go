@@ -0,0 +1,47 @@
+package luxwsclient
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestNavRootFindPath(t *testing.T) {
+	nav := &NavRoot{
+		Items: []NavItem{
+			{ID: "0x1", Name: "Informationen"},
+			{ID: "0x2", Name: "Einstellungen", Items: []NavItem{
+				{ID: "0x3", Name: "Warmwasser"},
+			}},
+		},
+	}
+
+	for _, tc := range []struct {
+		path     []string
+		wantID   string
+		wantRest []string
+	}{
+		{path: nil},
+		{path: []string{"Unbekannt"}, wantRest: []string{"Unbekannt"}},
+		{path: []string{"Informationen"}, wantID: "0x1"},
+		{path: []string{"Einstellungen", "Warmwasser"}, wantID: "0x3"},
+		{path: []string{"Einstellungen", "Warmwasser", "Temperaturen"}, wantID: "0x3", wantRest: []string{"Temperaturen"}},
+	} {
+		item, rest := nav.FindPath(tc.path)
+
+		var gotID string
+
+		if item != nil {
+			gotID = item.ID
+		}
+
+		if gotID != tc.wantID {
+			t.Errorf("FindPath(%q) returned ID %q, want %q", tc.path, gotID, tc.wantID)
+		}
+
+		if diff := cmp.Diff(tc.wantRest, rest, cmpopts.EquateEmpty()); diff != "" {
+			t.Errorf("FindPath(%q) remaining path diff (-want +got):\n%s", tc.path, diff)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+// Package luxwscollect defines the interface for modules collecting
+// Prometheus metrics from LuxWS pages and a registry for such modules.
+//
+// Modules are registered from the init function of their package. Programs
+// enable them by importing the package:
+//
+//	import _ "example.com/site/luxwspool"
+package luxwscollect
+
+import (
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+)
+
+// Quirks are peculiarities of a controller detected while collecting.
+type Quirks struct {
+	// The controller doesn't report the amount of supplied heat, e.g. on
+	// L2A heat pumps.
+	MissingSuppliedHeat bool
+
+	// Names of the entries in the quirks database matching the controller.
+	Active []string
+}
+
+// Env describes the environment of a collection.
+type Env struct {
+	// Terminology for the language of the controller.
+	Terms *luxwslang.Terminology
+
+	// Timezone of the controller.
+	Location *time.Location
+
+	// Quirks of the controller detected from the information page. The
+	// content of the information page has already been adjusted for them.
+	Quirks *Quirks
+
+	// Logger; may be nil.
+	Log *zap.Logger
+
+	// Records how content items were used. Modules should record the
+	// metrics to which items contribute and values which couldn't be parsed
+	// for debugging. May be nil.
+	Outcomes *Outcomes
+}
+
+// Module collects metrics from one or more controller pages.
+type Module interface {
+	// Name returns a unique name made of lowercase letters, digits and
+	// underscores, e.g. "pool_heating".
+	Name() string
+
+	// Pages returns the pages from which metrics are collected. Each page is
+	// identified by the path of names in the navigation structure, e.g.
+	// []string{"Informationen"} or []string{"Einstellungen", "Schwimmbad"}.
+	Pages(terms *luxwslang.Terminology) [][]string
+
+	// Describe sends the descriptors of all metrics collected by the module
+	// (see prometheus.Collector).
+	Describe(ch chan<- *prometheus.Desc)
+
+	// Collect sends metrics to ch. The content of the pages is given in the
+	// same order as returned by Pages.
+	Collect(env *Env, ch chan<- prometheus.Metric, pages []*luxwsclient.ContentRoot) error
+}
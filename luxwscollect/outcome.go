@@ -0,0 +1,95 @@
+package luxwscollect
+
+import (
+	"slices"
+	"sync"
+)
+
+// ItemOutcome describes how a content item was used during a collection.
+type ItemOutcome struct {
+	// Names of the metrics to which the item contributed, directly or
+	// derived, in the order in which they were recorded.
+	Metrics []string
+
+	// Error from parsing the item value, if any.
+	Err error
+}
+
+type outcomeKey struct {
+	group string
+	item  string
+}
+
+// Outcomes records how content items were used during a collection. Items
+// are identified by their name and the name of the group containing them.
+// Items without an outcome were ignored. Outcomes is safe for concurrent use
+// and its methods do nothing on a nil pointer.
+type Outcomes struct {
+	mu    sync.Mutex
+	items map[outcomeKey]*ItemOutcome
+}
+
+// NewOutcomes returns an empty set of outcomes.
+func NewOutcomes() *Outcomes {
+	return &Outcomes{
+		items: map[outcomeKey]*ItemOutcome{},
+	}
+}
+
+func (o *Outcomes) get(group, item string) *ItemOutcome {
+	key := outcomeKey{group, item}
+
+	result, ok := o.items[key]
+	if !ok {
+		result = &ItemOutcome{}
+		o.items[key] = result
+	}
+
+	return result
+}
+
+// Metric records that an item contributed to a metric.
+func (o *Outcomes) Metric(group, item, metric string) {
+	if o == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if outcome := o.get(group, item); !slices.Contains(outcome.Metrics, metric) {
+		outcome.Metrics = append(outcome.Metrics, metric)
+	}
+}
+
+// ParseError records that the value of an item couldn't be parsed.
+func (o *Outcomes) ParseError(group, item string, err error) {
+	if o == nil {
+		return
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.get(group, item).Err = err
+}
+
+// Lookup returns the outcome recorded for an item.
+func (o *Outcomes) Lookup(group, item string) (ItemOutcome, bool) {
+	if o == nil {
+		return ItemOutcome{}, false
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	outcome, ok := o.items[outcomeKey{group, item}]
+	if !ok {
+		return ItemOutcome{}, false
+	}
+
+	return ItemOutcome{
+		Metrics: slices.Clone(outcome.Metrics),
+		Err:     outcome.Err,
+	}, true
+}
@@ -0,0 +1,62 @@
+package luxwscollect
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/google/go-cmp/cmp/cmpopts"
+)
+
+func TestOutcomes(t *testing.T) {
+	o := NewOutcomes()
+
+	errTest := errors.New("test")
+
+	o.Metric("Temperatures", "Flow", "luxws_temperature")
+	o.Metric("Temperatures", "Flow", "luxws_estimated_heat_power")
+	o.Metric("Temperatures", "Flow", "luxws_temperature")
+	o.ParseError("Inputs", "Flow rate", errTest)
+
+	for _, tc := range []struct {
+		group, item string
+		want        ItemOutcome
+		wantOk      bool
+	}{
+		{
+			group:  "Temperatures",
+			item:   "Flow",
+			want:   ItemOutcome{Metrics: []string{"luxws_temperature", "luxws_estimated_heat_power"}},
+			wantOk: true,
+		},
+		{
+			group:  "Inputs",
+			item:   "Flow rate",
+			want:   ItemOutcome{Err: errTest},
+			wantOk: true,
+		},
+		{group: "Inputs", item: "Flow"},
+		{group: "Outputs", item: "Flow rate"},
+	} {
+		got, ok := o.Lookup(tc.group, tc.item)
+
+		if ok != tc.wantOk {
+			t.Errorf("Lookup(%q, %q) returned %t, want %t", tc.group, tc.item, ok, tc.wantOk)
+		}
+
+		if diff := cmp.Diff(tc.want, got, cmpopts.EquateErrors()); diff != "" {
+			t.Errorf("Lookup(%q, %q) diff (-want +got):\n%s", tc.group, tc.item, diff)
+		}
+	}
+}
+
+func TestOutcomesNil(t *testing.T) {
+	var o *Outcomes
+
+	o.Metric("group", "item", "metric")
+	o.ParseError("group", "item", errors.New("test"))
+
+	if _, ok := o.Lookup("group", "item"); ok {
+		t.Errorf("Lookup() on nil outcomes succeeded")
+	}
+}
@@ -0,0 +1,76 @@
+package luxwscollect
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]*$`)
+
+// Registry keeps modules in the order of their registration.
+type Registry struct {
+	mu      sync.Mutex
+	modules []Module
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{}
+}
+
+// Register adds a module to the registry. Names must be unique and valid (see
+// Module.Name).
+func (r *Registry) Register(m Module) error {
+	name := m.Name()
+
+	if !namePattern.MatchString(name) {
+		return fmt.Errorf("invalid module name %q", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, existing := range r.modules {
+		if existing.Name() == name {
+			return fmt.Errorf("module %q already registered", name)
+		}
+	}
+
+	r.modules = append(r.modules, m)
+
+	return nil
+}
+
+// MustRegister adds a module to the registry and panics on errors.
+func (r *Registry) MustRegister(m Module) {
+	if err := r.Register(m); err != nil {
+		panic(err)
+	}
+}
+
+// Modules returns all registered modules.
+func (r *Registry) Modules() []Module {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Module(nil), r.modules...)
+}
+
+// DefaultRegistry is used by the package-level functions.
+var DefaultRegistry = NewRegistry()
+
+// Register adds a module to the default registry.
+func Register(m Module) error {
+	return DefaultRegistry.Register(m)
+}
+
+// MustRegister adds a module to the default registry and panics on errors.
+func MustRegister(m Module) {
+	DefaultRegistry.MustRegister(m)
+}
+
+// Modules returns all modules in the default registry.
+func Modules() []Module {
+	return DefaultRegistry.Modules()
+}
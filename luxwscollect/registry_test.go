@@ -0,0 +1,64 @@
+package luxwscollect
+
+import (
+	"testing"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type fakeModule string
+
+func (m fakeModule) Name() string {
+	return string(m)
+}
+
+func (fakeModule) Pages(*luxwslang.Terminology) [][]string {
+	return nil
+}
+
+func (fakeModule) Describe(chan<- *prometheus.Desc) {}
+
+func (fakeModule) Collect(*Env, chan<- prometheus.Metric, []*luxwsclient.ContentRoot) error {
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+
+	for _, name := range []string{"pool", "solar_2"} {
+		if err := r.Register(fakeModule(name)); err != nil {
+			t.Errorf("Register(%q) failed: %v", name, err)
+		}
+	}
+
+	for _, name := range []string{"pool", "", "Pool", "2pool", "pool-heating"} {
+		if err := r.Register(fakeModule(name)); err == nil {
+			t.Errorf("Register(%q) succeeded", name)
+		}
+	}
+
+	var got []string
+
+	for _, m := range r.Modules() {
+		got = append(got, m.Name())
+	}
+
+	if len(got) != 2 || got[0] != "pool" || got[1] != "solar_2" {
+		t.Errorf("Modules() returned %q", got)
+	}
+}
+
+func TestMustRegisterPanics(t *testing.T) {
+	r := NewRegistry()
+	r.MustRegister(fakeModule("pool"))
+
+	defer func() {
+		if recover() == nil {
+			t.Errorf("MustRegister() didn't panic for duplicate module")
+		}
+	}()
+
+	r.MustRegister(fakeModule("pool"))
+}
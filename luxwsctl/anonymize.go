@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Format used by all supported languages for timestamps in the error memory,
+// switch-offs and similar lists (see luxwslang.Terminology).
+const anonDateFormat = "02.01.06"
+
+var (
+	anonIDRe        = regexp.MustCompile(`\bid=(['"])(0x[0-9a-fA-F]+)(['"])`)
+	anonSerialRe    = regexp.MustCompile(`(<name>)([^<]*)(</name>\s*<value>)([^<]*)(</value>)`)
+	anonSerialName  = regexp.MustCompile(`(?i)serial|serien|sériov|seriov|sarjanum`)
+	anonTimestampRe = regexp.MustCompile(`\b(\d\d\.\d\d\.\d\d)( \d\d:\d\d(?::\d\d)?)\b`)
+	anonMACRe       = regexp.MustCompile(`\b[0-9A-Fa-f]{2}(?:[:-][0-9A-Fa-f]{2}){5}\b`)
+	anonIPv4Re      = regexp.MustCompile(`\b\d{1,3}(?:\.\d{1,3}){3}\b`)
+)
+
+// The most recent timestamp is moved into the week ending on anonReference.
+var anonReference = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// anonymizer replaces identifying values in raw documents received from
+// a controller. The documents are modified as text to retain their exact
+// formatting. Replacements are consistent across all documents:
+//
+//   - Per-connection IDs are numbered in order of appearance.
+//   - Digits and letters of serial numbers are masked.
+//   - Timestamps are moved by whole weeks, retaining their order, weekday
+//     and time of day.
+//   - IPv4 addresses other than netmasks are replaced with addresses from
+//     192.0.2.0/24 (RFC 5737), MAC addresses with locally administered ones.
+type anonymizer struct {
+	ids   map[string]string
+	addrs map[string]string
+	macs  map[string]string
+	shift int
+}
+
+func parseAnonDate(value string) (time.Time, bool) {
+	ts, err := time.Parse(anonDateFormat, value)
+
+	return ts, err == nil
+}
+
+// newAnonymizer prepares the anonymization of a set of documents.
+func newAnonymizer(docs [][]byte) *anonymizer {
+	a := &anonymizer{
+		ids:   map[string]string{},
+		addrs: map[string]string{},
+		macs:  map[string]string{},
+	}
+
+	var latest time.Time
+
+	for _, doc := range docs {
+		for _, m := range anonTimestampRe.FindAllSubmatch(doc, -1) {
+			if ts, ok := parseAnonDate(string(m[1])); ok && ts.After(latest) {
+				latest = ts
+			}
+		}
+	}
+
+	if !latest.IsZero() {
+		days := int(anonReference.Sub(latest).Hours() / 24)
+		a.shift = days - ((days%7)+7)%7
+	}
+
+	return a
+}
+
+func (a *anonymizer) replaceID(m []string) string {
+	id, ok := a.ids[m[2]]
+	if !ok {
+		id = fmt.Sprintf("0x%x", 0x100000+4*len(a.ids))
+		a.ids[m[2]] = id
+	}
+
+	return "id=" + m[1] + id + m[3]
+}
+
+func maskSerial(value string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case unicode.IsDigit(r):
+			return '0'
+		case unicode.IsLetter(r):
+			return 'X'
+		}
+
+		return r
+	}, value)
+}
+
+func (a *anonymizer) replaceTimestamp(m []string) string {
+	ts, ok := parseAnonDate(m[1])
+	if !ok {
+		return m[0]
+	}
+
+	return ts.AddDate(0, 0, a.shift).Format(anonDateFormat) + m[2]
+}
+
+func (a *anonymizer) replaceMAC(value string) string {
+	mac, ok := a.macs[strings.ToLower(value)]
+	if !ok {
+		mac = fmt.Sprintf("02:00:00:00:00:%02x", (len(a.macs)+1)%256)
+		a.macs[strings.ToLower(value)] = mac
+	}
+
+	return mac
+}
+
+func (a *anonymizer) replaceIPv4(value string) string {
+	ip := net.ParseIP(value).To4()
+	if ip == nil {
+		return value
+	}
+
+	if _, bits := net.IPMask(ip).Size(); bits != 0 {
+		// Netmasks don't identify a network
+		return value
+	}
+
+	addr, ok := a.addrs[ip.String()]
+	if !ok {
+		addr = fmt.Sprintf("192.0.2.%d", (len(a.addrs)+1)%256)
+		a.addrs[ip.String()] = addr
+	}
+
+	return addr
+}
+
+// replaceSubmatch calls fn for every match of re in s.
+func replaceSubmatch(re *regexp.Regexp, s string, fn func([]string) string) string {
+	return re.ReplaceAllStringFunc(s, func(match string) string {
+		return fn(re.FindStringSubmatch(match))
+	})
+}
+
+// anonymize returns an anonymized copy of a document.
+func (a *anonymizer) anonymize(doc []byte) []byte {
+	s := string(doc)
+
+	s = replaceSubmatch(anonIDRe, s, a.replaceID)
+	s = replaceSubmatch(anonSerialRe, s, func(m []string) string {
+		if anonSerialName.MatchString(m[2]) {
+			m[4] = maskSerial(m[4])
+		}
+
+		return strings.Join(m[1:], "")
+	})
+	s = replaceSubmatch(anonTimestampRe, s, a.replaceTimestamp)
+	s = anonMACRe.ReplaceAllStringFunc(s, a.replaceMAC)
+	s = anonIPv4Re.ReplaceAllStringFunc(s, a.replaceIPv4)
+
+	return []byte(s)
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestAnonymize(t *testing.T) {
+	nav := `<Navigation id='0xf3a868'><item id='0xedf358'><name>Informationen</name></item></Navigation>`
+	content := `<Content>
+    <item id='0xedf358'>
+        <name>Fehlerspeicher</name>
+        <item id='0xf4507c'>
+            <name>01.09.24 15:12:47</name>
+            <value>max. outdoor temp. (718)</value>
+        </item>
+        <item id='0xf4510c'>
+            <name>30.08.24 15:02</name>
+            <value>no requ.</value>
+        </item>
+    </item>
+    <item id='0xf45000'>
+        <name>Anlagenstatus</name>
+        <item id='0xf45004'>
+            <name>Seriennummer</name>
+            <value>2214/0815-Ab</value>
+        </item>
+        <item id='0xf45008'>
+            <name>Softwarestand</name>
+            <value>V3.89.4</value>
+        </item>
+        <item id='0xf4500c'>
+            <name>IP-Adresse</name>
+            <value>10.1.2.3</value>
+        </item>
+        <item id='0xf45010'>
+            <name>Subnetzmaske</name>
+            <value>255.255.255.0</value>
+        </item>
+        <item id='0xf45014'>
+            <name>Gateway</name>
+            <value>10.1.2.1</value>
+        </item>
+        <item id='0xf45018'>
+            <name>MAC</name>
+            <value>00:1A:2b:3C:4d:5E</value>
+        </item>
+        <item id='0xf4501c'>
+            <name>Server</name>
+            <value>10.1.2.3</value>
+        </item>
+    </item>
+</Content>
+`
+
+	a := newAnonymizer([][]byte{[]byte(nav), []byte(content)})
+
+	if diff := cmp.Diff(`<Navigation id='0x100000'><item id='0x100004'><name>Informationen</name></item></Navigation>`,
+		string(a.anonymize([]byte(nav)))); diff != "" {
+		t.Errorf("Navigation diff (-want +got):\n%s", diff)
+	}
+
+	want := `<Content>
+    <item id='0x100004'>
+        <name>Fehlerspeicher</name>
+        <item id='0x100008'>
+            <name>31.12.23 15:12:47</name>
+            <value>max. outdoor temp. (718)</value>
+        </item>
+        <item id='0x10000c'>
+            <name>29.12.23 15:02</name>
+            <value>no requ.</value>
+        </item>
+    </item>
+    <item id='0x100010'>
+        <name>Anlagenstatus</name>
+        <item id='0x100014'>
+            <name>Seriennummer</name>
+            <value>0000/0000-XX</value>
+        </item>
+        <item id='0x100018'>
+            <name>Softwarestand</name>
+            <value>V3.89.4</value>
+        </item>
+        <item id='0x10001c'>
+            <name>IP-Adresse</name>
+            <value>192.0.2.1</value>
+        </item>
+        <item id='0x100020'>
+            <name>Subnetzmaske</name>
+            <value>255.255.255.0</value>
+        </item>
+        <item id='0x100024'>
+            <name>Gateway</name>
+            <value>192.0.2.2</value>
+        </item>
+        <item id='0x100028'>
+            <name>MAC</name>
+            <value>02:00:00:00:00:01</value>
+        </item>
+        <item id='0x10002c'>
+            <name>Server</name>
+            <value>192.0.2.1</value>
+        </item>
+    </item>
+</Content>
+`
+
+	if diff := cmp.Diff(want, string(a.anonymize([]byte(content)))); diff != "" {
+		t.Errorf("Content diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestAnonymizeFixture(t *testing.T) {
+	for _, name := range []string{"content_de.xml", "content_en.xml"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile("../luxwsclient/testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			files, err := anonymizeCapture([]captureFile{{name: name, root: "content", content: data}})
+			if err != nil {
+				t.Fatalf("anonymizeCapture() failed: %v", err)
+			}
+
+			got := string(files[0].content)
+
+			if strings.Contains(got, "0xf4") {
+				t.Errorf("Original IDs remain in output")
+			}
+
+			if strings.Count(got, "<item ") != strings.Count(string(data), "<item ") {
+				t.Errorf("Number of items changed")
+			}
+		})
+	}
+}
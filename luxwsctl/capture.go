@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+)
+
+// captureRecorder keeps the first received message with an expected root
+// element, i.e. the raw response to a command.
+type captureRecorder struct {
+	mu      sync.Mutex
+	root    string
+	payload []byte
+}
+
+func rootElement(payload []byte) string {
+	dec := xml.NewDecoder(bytes.NewReader(payload))
+
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			return ""
+		}
+
+		if start, ok := tok.(xml.StartElement); ok {
+			return start.Name.Local
+		}
+	}
+}
+
+// expect discards the previous message and waits for a message with the given
+// root element.
+func (r *captureRecorder) expect(root string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.root = root
+	r.payload = nil
+}
+
+func (r *captureRecorder) record(sent bool, payload []byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !sent && r.payload == nil && strings.EqualFold(rootElement(payload), r.root) {
+		r.payload = append([]byte(nil), payload...)
+	}
+}
+
+func (r *captureRecorder) take() []byte {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.payload
+}
+
+type captureFile struct {
+	name    string
+	root    string
+	content []byte
+}
+
+var captureSlugInvalid = regexp.MustCompile(`[^a-z0-9]+`)
+
+var captureSlugReplacer = strings.NewReplacer("ä", "ae", "ö", "oe", "ü", "ue", "ß", "ss")
+
+// captureTerms returns the terminology whose name for the information page
+// is used at the top level of the navigation.
+func captureTerms(nav *luxwsclient.NavRoot) (*luxwslang.Terminology, error) {
+	for _, terms := range luxwslang.All() {
+		if _, rest := nav.FindPath([]string{terms.NavInformation}); len(rest) == 0 {
+			return terms, nil
+		}
+	}
+
+	return nil, errors.New("language not detected from navigation, use --language")
+}
+
+// captureFileName returns a file name for a page following the naming of
+// fixtures in testdata directories, e.g. "content_en.xml" for the information
+// page and "content_en_energy_monitor.xml" for other pages.
+func captureFileName(terms *luxwslang.Terminology, path []string, seen map[string]bool) string {
+	name := "content_" + terms.ID
+
+	if !(len(path) == 1 && path[0] == terms.NavInformation) {
+		slug := captureSlugReplacer.Replace(strings.ToLower(strings.Join(path, "_")))
+		name += "_" + strings.Trim(captureSlugInvalid.ReplaceAllString(slug, "_"), "_")
+	}
+
+	base := name
+
+	for i := 2; seen[name]; i++ {
+		name = fmt.Sprintf("%s_%d", base, i)
+	}
+
+	seen[name] = true
+
+	return name + ".xml"
+}
+
+// capture retrieves the raw content of all navigation items. Items which
+// can't be retrieved are reported on warn and skipped. The navigation must
+// have been recorded during login. File names contain the language ID of the
+// terminology.
+func (s *session) capture(ctx context.Context, rec *captureRecorder, nav []byte, terms *luxwslang.Terminology, warn io.Writer) ([]captureFile, error) {
+	if nav == nil {
+		return nil, errors.New("navigation wasn't recorded")
+	}
+
+	files := []captureFile{{name: "nav_" + terms.ID + ".xml", root: "navigation", content: nav}}
+	seen := map[string]bool{}
+
+	var walk func(items []luxwsclient.NavItem, path []string) error
+
+	walk = func(items []luxwsclient.NavItem, path []string) error {
+		for _, item := range items {
+			itemPath := append(path[:len(path):len(path)], item.Name)
+
+			rec.expect("content")
+
+			if _, err := s.get(ctx, item.ID); err != nil {
+				if ctx.Err() != nil {
+					return errors.Join(ctx.Err(), err)
+				}
+
+				fmt.Fprintf(warn, "Skipping %q: %v\n", strings.Join(itemPath, "/"), err)
+			} else if content := rec.take(); content != nil {
+				files = append(files, captureFile{
+					name:    captureFileName(terms, itemPath, seen),
+					root:    "content",
+					content: content,
+				})
+			}
+
+			if err := walk(item.Items, itemPath); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}
+
+	if err := walk(s.nav.Items, nil); err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// anonymizeCapture anonymizes captured files and verifies that the results
+// can still be parsed.
+func anonymizeCapture(files []captureFile) ([]captureFile, error) {
+	var docs [][]byte
+
+	for _, f := range files {
+		docs = append(docs, f.content)
+	}
+
+	a := newAnonymizer(docs)
+
+	result := make([]captureFile, 0, len(files))
+
+	for _, f := range files {
+		f.content = a.anonymize(f.content)
+
+		var err error
+
+		if f.root == "navigation" {
+			_, err = luxwsclient.NewNavRoot(f.content, f.root)
+		} else {
+			_, err = luxwsclient.NewContentRoot(f.content, f.root)
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("anonymized %s: %w", f.name, err)
+		}
+
+		result = append(result, f)
+	}
+
+	return result, nil
+}
+
+// writeCapture writes files to a directory and prints their paths.
+func writeCapture(w io.Writer, dir string, files []captureFile) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		path := filepath.Join(dir, f.name)
+
+		if err := os.WriteFile(path, f.content, 0o644); err != nil {
+			return err
+		}
+
+		fmt.Fprintln(w, path)
+	}
+
+	return nil
+}
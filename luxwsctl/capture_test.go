@@ -0,0 +1,75 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+)
+
+func TestCaptureFileName(t *testing.T) {
+	seen := map[string]bool{}
+
+	for _, tc := range []struct {
+		terms *luxwslang.Terminology
+		path  []string
+		want  string
+	}{
+		{luxwslang.German, []string{"Informationen"}, "content_de.xml"},
+		{luxwslang.German, []string{"Informationen", "Wärmemenge"}, "content_de_informationen_waermemenge.xml"},
+		{luxwslang.English, []string{"information"}, "content_en.xml"},
+		{luxwslang.English, []string{"information", "energy monitor", "Heat Quantity"}, "content_en_information_energy_monitor_heat_quantity.xml"},
+		{luxwslang.German, []string{"Informationen", "Wärmemenge "}, "content_de_informationen_waermemenge_2.xml"},
+		{luxwslang.German, []string{"Einstellungen", "Informationen"}, "content_de_einstellungen_informationen.xml"},
+	} {
+		if got := captureFileName(tc.terms, tc.path, seen); got != tc.want {
+			t.Errorf("captureFileName(%q) = %q, want %q", tc.path, got, tc.want)
+		}
+	}
+}
+
+func TestRootElement(t *testing.T) {
+	for _, tc := range []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"<?xml version='1.0'?>\n<Content></Content>", "Content"},
+		{"<Navigation id='0x1'/>", "Navigation"},
+		{"garbage", ""},
+	} {
+		if got := rootElement([]byte(tc.input)); got != tc.want {
+			t.Errorf("rootElement(%q) = %q, want %q", tc.input, got, tc.want)
+		}
+	}
+}
+
+func TestCaptureTerms(t *testing.T) {
+	for _, name := range []string{"nav_de.xml", "nav_en.xml"} {
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile("../luxwsclient/testdata/" + name)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			nav, err := luxwsclient.NewNavRoot(data, "navigation")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			terms, err := captureTerms(nav)
+			if err != nil {
+				t.Fatalf("captureTerms() failed: %v", err)
+			}
+
+			if want := "nav_" + terms.ID + ".xml"; want != name {
+				t.Errorf("captureTerms() returned %q", terms.ID)
+			}
+		})
+	}
+
+	if _, err := captureTerms(&luxwsclient.NavRoot{}); err == nil {
+		t.Error("captureTerms() succeeded for empty navigation")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+)
+
+const indent = "  "
+
+// writeNav prints navigation items as a tree.
+func writeNav(w io.Writer, items []luxwsclient.NavItem, depth int) {
+	for _, item := range items {
+		fmt.Fprintf(w, "%s%s [%s]\n", strings.Repeat(indent, depth), item.Name, item.ID)
+
+		writeNav(w, item.Items, depth+1)
+	}
+}
+
+// writeItems prints content items as a tree. Groups are printed by name,
+// values as "<name>: <value>". Bounds of parameters are appended.
+func writeItems(w io.Writer, items luxwsclient.ContentItems, depth int) {
+	prefix := strings.Repeat(indent, depth)
+
+	for _, item := range items {
+		if item.Value == nil {
+			fmt.Fprintf(w, "%s%s\n", prefix, item.Name)
+		} else {
+			fmt.Fprintf(w, "%s%s: %s", prefix, item.Name, strings.TrimSpace(*item.Value))
+
+			if len(item.Options) > 0 {
+				var names []string
+
+				for _, opt := range item.Options {
+					names = append(names, strings.TrimSpace(opt.Name))
+				}
+
+				fmt.Fprintf(w, " (options: %s)", strings.Join(names, ", "))
+			} else if item.Min != nil && item.Max != nil {
+				fmt.Fprintf(w, " (raw %s, range %s to %s", deref(item.Raw), *item.Min, *item.Max)
+
+				if item.Div != nil {
+					fmt.Fprintf(w, ", divisor %s", *item.Div)
+				}
+
+				fmt.Fprintf(w, ")")
+			}
+
+			fmt.Fprintln(w)
+		}
+
+		writeItems(w, item.Items, depth+1)
+	}
+}
+
+func deref(s *string) string {
+	if s == nil {
+		return ""
+	}
+
+	return *s
+}
+
+type jsonNavItem struct {
+	ID    string        `json:"id"`
+	Name  string        `json:"name"`
+	Items []jsonNavItem `json:"items,omitempty"`
+}
+
+func newJSONNavItems(items []luxwsclient.NavItem) []jsonNavItem {
+	var result []jsonNavItem
+
+	for _, item := range items {
+		result = append(result, jsonNavItem{
+			ID:    item.ID,
+			Name:  item.Name,
+			Items: newJSONNavItems(item.Items),
+		})
+	}
+
+	return result
+}
+
+type jsonOption struct {
+	Value string `json:"value"`
+	Name  string `json:"name"`
+}
+
+type jsonItem struct {
+	ID      string       `json:"id"`
+	Name    string       `json:"name"`
+	Value   *string      `json:"value,omitempty"`
+	Raw     *string      `json:"raw,omitempty"`
+	Min     *string      `json:"min,omitempty"`
+	Max     *string      `json:"max,omitempty"`
+	Step    *string      `json:"step,omitempty"`
+	Div     *string      `json:"div,omitempty"`
+	Options []jsonOption `json:"options,omitempty"`
+	Items   []jsonItem   `json:"items,omitempty"`
+}
+
+func newJSONItems(items luxwsclient.ContentItems) []jsonItem {
+	var result []jsonItem
+
+	for _, item := range items {
+		i := jsonItem{
+			ID:    item.ID,
+			Name:  item.Name,
+			Value: item.Value,
+			Raw:   item.Raw,
+			Min:   item.Min,
+			Max:   item.Max,
+			Step:  item.Step,
+			Div:   item.Div,
+			Items: newJSONItems(item.Items),
+		}
+
+		for _, opt := range item.Options {
+			i.Options = append(i.Options, jsonOption{opt.Value, strings.TrimSpace(opt.Name)})
+		}
+
+		result = append(result, i)
+	}
+
+	return result
+}
+
+func writeJSON(w io.Writer, v any) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(v)
+}
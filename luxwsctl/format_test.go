@@ -0,0 +1,95 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+)
+
+func TestWriteNav(t *testing.T) {
+	var buf strings.Builder
+
+	writeNav(&buf, []luxwsclient.NavItem{
+		{ID: "0x1", Name: "Informationen"},
+		{ID: "0x2", Name: "Einstellungen", Items: []luxwsclient.NavItem{
+			{ID: "0x3", Name: "Warmwasser"},
+		}},
+	}, 0)
+
+	if diff := cmp.Diff("Informationen [0x1]\nEinstellungen [0x2]\n  Warmwasser [0x3]\n", buf.String()); diff != "" {
+		t.Errorf("Output diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteItems(t *testing.T) {
+	var buf strings.Builder
+
+	writeItems(&buf, luxwsclient.ContentItems{
+		{Name: "Temperaturen", Items: luxwsclient.ContentItems{
+			{Name: "Vorlauf", Value: luxwsclient.String("30.2°C")},
+			{
+				Name:  "Warmwasser-Soll",
+				Value: luxwsclient.String("48.0°C"),
+				Raw:   luxwsclient.String("480"),
+				Min:   luxwsclient.String("300"),
+				Max:   luxwsclient.String("650"),
+				Div:   luxwsclient.String("10.00"),
+			},
+			{
+				Name:  "Regelung MK1",
+				Value: luxwsclient.String("schnell"),
+				Options: []*luxwsclient.ContentItemOption{
+					{Value: "0", Name: "schnell"},
+					{Value: "1", Name: "mittel"},
+				},
+			},
+		}},
+	}, 0)
+
+	want := `Temperaturen
+  Vorlauf: 30.2°C
+  Warmwasser-Soll: 48.0°C (raw 480, range 300 to 650, divisor 10.00)
+  Regelung MK1: schnell (options: schnell, mittel)
+`
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Output diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestWriteChanges(t *testing.T) {
+	ts := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+
+	content := func(flow string, extra ...*luxwsclient.ContentItem) luxwsclient.ContentItems {
+		return luxwsclient.ContentItems{
+			{Name: "Temperaturen", Items: append(luxwsclient.ContentItems{
+				{Name: "Vorlauf", Value: luxwsclient.String(flow)},
+				{Name: "Rücklauf", Value: luxwsclient.String("25.0°C")},
+			}, extra...)},
+		}
+	}
+
+	var buf strings.Builder
+
+	prev := writeChanges(&buf, ts, nil, flattenValues(content("30.2°C"), nil))
+	prev = writeChanges(&buf, ts.Add(time.Second), prev, flattenValues(content("30.2°C"), nil))
+	prev = writeChanges(&buf, ts.Add(2*time.Second), prev, flattenValues(content("30.5°C",
+		&luxwsclient.ContentItem{Name: "Heißgas", Value: luxwsclient.String("60.0°C")}), nil))
+
+	want := `12:00:00 Temperaturen / Vorlauf: 30.2°C
+12:00:00 Temperaturen / Rücklauf: 25.0°C
+12:00:02 Temperaturen / Vorlauf: 30.2°C -> 30.5°C
+12:00:02 Temperaturen / Heißgas: (new) 60.0°C
+`
+
+	if diff := cmp.Diff(want, buf.String()); diff != "" {
+		t.Errorf("Output diff (-want +got):\n%s", diff)
+	}
+
+	if len(prev) != 3 {
+		t.Errorf("Previous values %v, want 3 entries", prev)
+	}
+}
@@ -0,0 +1,239 @@
+// Command luxwsctl inspects and changes heat pump controllers via the LuxWS
+// protocol.
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/alecthomas/kingpin/v2"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+	"go.uber.org/zap"
+)
+
+var (
+	address = kingpin.Flag("address",
+		`host:port for controller Websocket service (e.g. "192.0.2.1:8214")`).Envar("LUXWSCTL_ADDRESS").PlaceHolder("HOST:PORT").Required().String()
+	password = kingpin.Flag("password",
+		"Password for controller Websocket service").Envar("LUXWSCTL_PASSWORD").String()
+	passwordFile = kingpin.Flag("password-file",
+		"File containing the password for controller Websocket service").PlaceHolder("PATH").String()
+	timeout = kingpin.Flag("timeout", "Maximum duration of each request").Default("30s").Duration()
+	verbose = kingpin.Flag("verbose", "Log sent and received messages").Bool()
+)
+
+var (
+	navCmd = kingpin.Command("nav", "Print the navigation tree with IDs")
+
+	getCmd  = kingpin.Command("get", "Print a page")
+	getPath = getCmd.Arg("path", `Slash-separated names of a page, optionally followed by content groups (e.g. "Informationen/Temperaturen")`).Required().String()
+	getJSON = getCmd.Flag("json", "Print as JSON").Bool()
+
+	watchCmd      = kingpin.Command("watch", "Print changed values of a page until interrupted")
+	watchPath     = watchCmd.Arg("path", "Slash-separated names of a page, optionally followed by content groups").Required().String()
+	watchInterval = watchCmd.Flag("interval", "Time between retrievals").Default("5s").Duration()
+
+	setCmd    = kingpin.Command("set", "Change a parameter after validating the value against its bounds")
+	setPath   = setCmd.Arg("path", `Slash-separated names of a parameter (e.g. "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll")`).Required().String()
+	setValue  = setCmd.Arg("value", "Value in the displayed unit or name of an option").Required().String()
+	setYes    = setCmd.Flag("yes", "Don't ask for confirmation").Short('y').Bool()
+	setDryRun = setCmd.Flag("dry-run", "Validate the value without changing the parameter").Bool()
+
+	snapshotCmd = kingpin.Command("snapshot", "Print the navigation and all pages as JSON")
+
+	captureCmd      = kingpin.Command("capture", "Write anonymized navigation and pages as test fixtures")
+	captureDir      = captureCmd.Arg("directory", "Output directory").Required().String()
+	captureLanguage = captureCmd.Flag("language", "Controller interface language used in file names; detected from the navigation if not given").PlaceHolder("NAME").String()
+)
+
+// session is a connection to a controller after login.
+type session struct {
+	cl      *luxwsclient.Client
+	nav     *luxwsclient.NavRoot
+	timeout time.Duration
+}
+
+func connect(ctx context.Context, address, password string, timeout time.Duration, log *zap.Logger, opts ...luxwsclient.Option) (*session, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cl, err := luxwsclient.Dial(ctx, address, append([]luxwsclient.Option{luxwsclient.WithLogFunc(log)}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	nav, err := cl.Login(ctx, password)
+	if err != nil {
+		cl.Close()
+		return nil, err
+	}
+
+	return &session{cl: cl, nav: nav, timeout: timeout}, nil
+}
+
+func (s *session) Close() error {
+	return s.cl.Close()
+}
+
+// get retrieves a page by ID.
+func (s *session) get(ctx context.Context, id string) (*luxwsclient.ContentRoot, error) {
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	content, err := s.cl.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("fetching ID %q failed: %w", id, err)
+	}
+
+	return content, nil
+}
+
+// fetchPage retrieves the page identified by a path of names. The navigation
+// path can be followed by names of content groups whose items are returned.
+func (s *session) fetchPage(ctx context.Context, path []string) (luxwsclient.ContentItems, error) {
+	page, rest := s.nav.FindPath(path)
+	if page == nil {
+		return nil, fmt.Errorf("page %q: %w", strings.Join(path, "/"), luxwsclient.ErrNavItemNotFound)
+	}
+
+	content, err := s.get(ctx, page.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	items, _, ok := content.Items.FindPath(rest)
+	if !ok {
+		return nil, fmt.Errorf("group %q: %w", strings.Join(rest, "/"), luxwsclient.ErrContentItemNotFound)
+	}
+
+	return items, nil
+}
+
+func readPassword() (string, error) {
+	if *passwordFile == "" {
+		return *password, nil
+	}
+
+	if *password != "" {
+		return "", errors.New("--password and --password-file are mutually exclusive")
+	}
+
+	content, err := os.ReadFile(*passwordFile)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(content), "\r\n"), nil
+}
+
+func run(ctx context.Context, cmd string, log *zap.Logger) error {
+	pw, err := readPassword()
+	if err != nil {
+		return err
+	}
+
+	var opts []luxwsclient.Option
+
+	rec := &captureRecorder{}
+
+	if cmd == captureCmd.FullCommand() {
+		rec.expect("navigation")
+		opts = append(opts, luxwsclient.WithMessageFunc(rec.record))
+	}
+
+	s, err := connect(ctx, *address, pw, *timeout, log, opts...)
+	if err != nil {
+		return err
+	}
+
+	defer s.Close()
+
+	switch cmd {
+	case navCmd.FullCommand():
+		writeNav(os.Stdout, s.nav.Items, 0)
+
+	case getCmd.FullCommand():
+		items, err := s.fetchPage(ctx, luxwsclient.SplitPath(*getPath))
+		if err != nil {
+			return err
+		}
+
+		if *getJSON {
+			return writeJSON(os.Stdout, newJSONItems(items))
+		}
+
+		writeItems(os.Stdout, items, 0)
+
+	case watchCmd.FullCommand():
+		return s.watch(ctx, os.Stdout, luxwsclient.SplitPath(*watchPath), *watchInterval)
+
+	case setCmd.FullCommand():
+		return s.set(ctx, os.Stdin, os.Stdout, setRequest{
+			path:   luxwsclient.SplitPath(*setPath),
+			value:  *setValue,
+			yes:    *setYes,
+			dryRun: *setDryRun,
+		})
+
+	case snapshotCmd.FullCommand():
+		result, err := s.snapshot(ctx, time.Now())
+		if err != nil {
+			return err
+		}
+
+		return writeJSON(os.Stdout, result)
+
+	case captureCmd.FullCommand():
+		var terms *luxwslang.Terminology
+
+		if *captureLanguage == "" {
+			terms, err = captureTerms(s.nav)
+		} else {
+			terms, err = luxwslang.LookupByID(*captureLanguage)
+		}
+
+		if err != nil {
+			return err
+		}
+
+		files, err := s.capture(ctx, rec, rec.take(), terms, os.Stderr)
+		if err != nil {
+			return err
+		}
+
+		if files, err = anonymizeCapture(files); err != nil {
+			return err
+		}
+
+		return writeCapture(os.Stdout, *captureDir, files)
+	}
+
+	return nil
+}
+
+func main() {
+	cmd := kingpin.Parse()
+
+	var log *zap.Logger
+
+	if *verbose {
+		var err error
+
+		if log, err = zap.NewDevelopment(); err != nil {
+			kingpin.Fatalf("%v", err)
+		}
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	if err := run(ctx, cmd, log); err != nil && !errors.Is(err, context.Canceled) {
+		kingpin.Fatalf("%v", err)
+	}
+}
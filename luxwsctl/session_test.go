@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+	"github.com/gorilla/websocket"
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+	"github.com/hansmi/wp2reg-luxws/luxwslang"
+)
+
+// newFakeSession connects to a LuxWS server with a single settings page whose
+// parameter can be changed.
+func newFakeSession(t *testing.T, opts ...luxwsclient.Option) (*session, func() []string) {
+	t.Helper()
+
+	var mu sync.Mutex
+	var changes []string
+
+	target := "480"
+
+	page := func() string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return `<Content><item id="0x10"><name>Temperaturen</name>` +
+			`<item id="0x11"><name>Warmwasser-Soll</name><min>300</min><max>650</max><step>5</step>` +
+			`<div>10.00</div><raw>` + target + `</raw><value>` + target[:2] + `.` + target[2:] + `°C</value></item></item></Content>`
+	}
+
+	var upgrader websocket.Upgrader
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		defer conn.Close()
+
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			response := "<unknown></unknown>"
+
+			switch cmd := string(msg); {
+			case strings.HasPrefix(cmd, "LOGIN;"):
+				response = `<Navigation id="0x1"><item id="0x2"><name>Einstellungen</name>` +
+					`<item id="0x3"><name>Warmwasser</name></item><item id="0x4"><name>Defekt</name></item></item></Navigation>`
+			case cmd == "GET;0x3":
+				response = page()
+			case strings.HasPrefix(cmd, "SET;set_0x11;"):
+				mu.Lock()
+				changes = append(changes, cmd)
+				target = strings.TrimPrefix(cmd, "SET;set_0x11;")
+				mu.Unlock()
+				continue
+			case cmd == "SAVE;1":
+				response = `<Content></Content>`
+			}
+
+			if err := conn.WriteMessage(websocket.TextMessage, []byte(response)); err != nil {
+				return
+			}
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	serverURL, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := connect(context.Background(), serverURL.Host, "", time.Second, nil, opts...)
+	if err != nil {
+		t.Fatalf("connect() failed: %v", err)
+	}
+
+	t.Cleanup(func() { s.Close() })
+
+	return s, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+
+		return append([]string(nil), changes...)
+	}
+}
+
+func TestSet(t *testing.T) {
+	s, changes := newFakeSession(t)
+
+	path := luxwsclient.SplitPath("Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll")
+
+	for _, tc := range []struct {
+		name    string
+		req     setRequest
+		input   string
+		want    string
+		wantErr error
+	}{
+		{
+			name:    "out of range",
+			req:     setRequest{path: path, value: "70", yes: true},
+			wantErr: luxwsclient.ErrInvalidValue,
+		},
+		{
+			name:    "unknown parameter",
+			req:     setRequest{path: luxwsclient.SplitPath("Einstellungen/Warmwasser/Temperaturen/Hysterese"), value: "2", yes: true},
+			wantErr: luxwsclient.ErrContentItemNotFound,
+		},
+		{
+			name: "dry run",
+			req:  setRequest{path: path, value: "50", dryRun: true},
+			want: "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll [0x11]: 48.0°C -> 50 (raw 500)\n",
+		},
+		{
+			name:    "declined",
+			req:     setRequest{path: path, value: "50"},
+			input:   "n\n",
+			want:    "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll [0x11]: 48.0°C -> 50 (raw 500)\nApply change? [y/N] ",
+			wantErr: errNotConfirmed,
+		},
+		{
+			name:  "confirmed",
+			req:   setRequest{path: path, value: "50"},
+			input: "y\n",
+			want:  "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll [0x11]: 48.0°C -> 50 (raw 500)\nApply change? [y/N] New value: 50.0°C\n",
+		},
+		{
+			name: "yes",
+			req:  setRequest{path: path, value: "52.5", yes: true},
+			want: "Einstellungen/Warmwasser/Temperaturen/Warmwasser-Soll [0x11]: 50.0°C -> 52.5 (raw 525)\nNew value: 52.5°C\n",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var out strings.Builder
+
+			err := s.set(context.Background(), strings.NewReader(tc.input), &out, tc.req)
+
+			if !errors.Is(err, tc.wantErr) {
+				t.Errorf("set() returned %v, want %v", err, tc.wantErr)
+			}
+
+			if diff := cmp.Diff(tc.want, out.String()); diff != "" {
+				t.Errorf("Output diff (-want +got):\n%s", diff)
+			}
+		})
+	}
+
+	if diff := cmp.Diff([]string{"SET;set_0x11;500", "SET;set_0x11;525"}, changes()); diff != "" {
+		t.Errorf("Changes diff (-want +got):\n%s", diff)
+	}
+}
+
+func TestSnapshot(t *testing.T) {
+	s, _ := newFakeSession(t)
+
+	now := time.Date(2024, time.September, 1, 12, 0, 0, 0, time.UTC)
+
+	got, err := s.snapshot(context.Background(), now)
+	if err != nil {
+		t.Fatalf("snapshot() failed: %v", err)
+	}
+
+	if len(got.Pages) != 2 {
+		t.Fatalf("snapshot() returned %d pages, want 2", len(got.Pages))
+	}
+
+	if diff := cmp.Diff([]string{"Einstellungen", "Warmwasser"}, got.Pages[0].Path); diff != "" {
+		t.Errorf("Path diff (-want +got):\n%s", diff)
+	}
+
+	if p := got.Pages[0]; p.Error != "" || len(p.Items) != 1 || p.Items[0].Items[0].ID != "0x11" {
+		t.Errorf("Unexpected first page: %+v", p)
+	}
+
+	if p := got.Pages[1]; p.ID != "0x4" || p.Error == "" {
+		t.Errorf("Unexpected second page: %+v", p)
+	}
+}
+
+func TestCapture(t *testing.T) {
+	rec := &captureRecorder{}
+	rec.expect("navigation")
+
+	s, _ := newFakeSession(t, luxwsclient.WithMessageFunc(rec.record))
+
+	var warn strings.Builder
+
+	files, err := s.capture(context.Background(), rec, rec.take(), luxwslang.German, &warn)
+	if err != nil {
+		t.Fatalf("capture() failed: %v", err)
+	}
+
+	if files, err = anonymizeCapture(files); err != nil {
+		t.Fatalf("anonymizeCapture() failed: %v", err)
+	}
+
+	var names []string
+
+	for _, f := range files {
+		names = append(names, f.name)
+	}
+
+	if diff := cmp.Diff([]string{"nav_de.xml", "content_de_einstellungen_warmwasser.xml"}, names); diff != "" {
+		t.Errorf("Names diff (-want +got):\n%s", diff)
+	}
+
+	if got := warn.String(); strings.Count(got, "Skipping") != 2 {
+		t.Errorf("Expected two skipped pages, got %q", got)
+	}
+
+	wantNav := `<Navigation id="0x100000"><item id="0x100004"><name>Einstellungen</name>` +
+		`<item id="0x100008"><name>Warmwasser</name></item><item id="0x10000c"><name>Defekt</name></item></item></Navigation>`
+
+	if diff := cmp.Diff(wantNav, string(files[0].content)); diff != "" {
+		t.Errorf("Navigation diff (-want +got):\n%s", diff)
+	}
+
+	if got := string(files[1].content); !strings.Contains(got, `<item id="0x100010"><name>Temperaturen</name>`) {
+		t.Errorf("Content not anonymized: %s", got)
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+)
+
+var errNotConfirmed = errors.New("change not confirmed")
+
+type setRequest struct {
+	path   []string
+	value  string
+	yes    bool
+	dryRun bool
+}
+
+// findParameter retrieves the page containing a parameter and returns the
+// parameter. The page remains the current page of the connection as required
+// by the "SET" command.
+func (s *session) findParameter(ctx context.Context, path []string) (*luxwsclient.ContentItem, error) {
+	if len(path) < 2 {
+		return nil, fmt.Errorf("path %q doesn't name a parameter on a page", strings.Join(path, "/"))
+	}
+
+	items, err := s.fetchPage(ctx, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+
+	name := path[len(path)-1]
+
+	for _, item := range items {
+		if item.Name == name && item.Value != nil {
+			return item, nil
+		}
+	}
+
+	return nil, fmt.Errorf("parameter %q: %w", name, luxwsclient.ErrContentItemNotFound)
+}
+
+// confirm asks for confirmation on interactive terminals.
+func confirm(in io.Reader, out io.Writer) error {
+	if f, ok := in.(*os.File); ok {
+		if fi, err := f.Stat(); err != nil || fi.Mode()&os.ModeCharDevice == 0 {
+			return fmt.Errorf("%w: use --yes when not running interactively", errNotConfirmed)
+		}
+	}
+
+	fmt.Fprint(out, "Apply change? [y/N] ")
+
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return nil
+	}
+
+	return errNotConfirmed
+}
+
+// set validates a new value for a parameter and, after confirmation, applies
+// it. The value read back from the controller is printed.
+func (s *session) set(ctx context.Context, in io.Reader, out io.Writer, req setRequest) error {
+	item, err := s.findParameter(ctx, req.path)
+	if err != nil {
+		return err
+	}
+
+	raw, err := item.RawValue(req.value)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s [%s]: %s -> %s (raw %s)\n", strings.Join(req.path, "/"), item.ID,
+		strings.TrimSpace(*item.Value), strings.TrimSpace(req.value), raw)
+
+	if req.dryRun {
+		return nil
+	}
+
+	if !req.yes {
+		if err := confirm(in, out); err != nil {
+			return err
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, s.timeout)
+	defer cancel()
+
+	if err := s.cl.Set(ctx, item.ID, raw); err != nil {
+		return fmt.Errorf("setting ID %q failed: %w", item.ID, err)
+	}
+
+	if _, err := s.cl.Save(ctx); err != nil {
+		return fmt.Errorf("saving failed: %w", err)
+	}
+
+	if item, err = s.findParameter(ctx, req.path); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "New value: %s\n", strings.TrimSpace(*item.Value))
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+)
+
+type snapshotPage struct {
+	Path  []string   `json:"path"`
+	ID    string     `json:"id"`
+	Items []jsonItem `json:"items,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
+type snapshot struct {
+	Time       time.Time      `json:"time"`
+	Navigation []jsonNavItem  `json:"navigation"`
+	Pages      []snapshotPage `json:"pages"`
+}
+
+// snapshot retrieves all pages of the navigation, i.e. items without
+// children. Pages which can't be retrieved are recorded with the error.
+func (s *session) snapshot(ctx context.Context, now time.Time) (*snapshot, error) {
+	result := &snapshot{
+		Time:       now,
+		Navigation: newJSONNavItems(s.nav.Items),
+		Pages:      []snapshotPage{},
+	}
+
+	var walk func(items []luxwsclient.NavItem, path []string) error
+
+	walk = func(items []luxwsclient.NavItem, path []string) error {
+		for _, item := range items {
+			itemPath := append(path[:len(path):len(path)], item.Name)
+
+			if len(item.Items) > 0 {
+				if err := walk(item.Items, itemPath); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			page := snapshotPage{
+				Path: itemPath,
+				ID:   item.ID,
+			}
+
+			if content, err := s.get(ctx, item.ID); err != nil {
+				if ctx.Err() != nil {
+					return errors.Join(ctx.Err(), err)
+				}
+
+				page.Error = err.Error()
+			} else {
+				page.Items = newJSONItems(content.Items)
+			}
+
+			result.Pages = append(result.Pages, page)
+		}
+
+		return nil
+	}
+
+	if err := walk(s.nav.Items, nil); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/hansmi/wp2reg-luxws/luxwsclient"
+)
+
+type watchValue struct {
+	path  string
+	value string
+}
+
+// flattenValues returns the values of all items with their path of names in
+// document order.
+func flattenValues(items luxwsclient.ContentItems, path []string) []watchValue {
+	var result []watchValue
+
+	for _, item := range items {
+		itemPath := append(path[:len(path):len(path)], item.Name)
+
+		if item.Value != nil {
+			result = append(result, watchValue{
+				path:  strings.Join(itemPath, " / "),
+				value: strings.TrimSpace(*item.Value),
+			})
+		}
+
+		result = append(result, flattenValues(item.Items, itemPath)...)
+	}
+
+	return result
+}
+
+// writeChanges prints the values differing from the previous retrieval and
+// returns the values for the next comparison. All values are printed if prev
+// is nil.
+func writeChanges(w io.Writer, ts time.Time, prev map[string]string, values []watchValue) map[string]string {
+	next := make(map[string]string, len(values))
+
+	for _, v := range values {
+		next[v.path] = v.value
+
+		old, ok := prev[v.path]
+
+		switch {
+		case prev == nil:
+			fmt.Fprintf(w, "%s %s: %s\n", ts.Format(time.TimeOnly), v.path, v.value)
+		case !ok:
+			fmt.Fprintf(w, "%s %s: (new) %s\n", ts.Format(time.TimeOnly), v.path, v.value)
+		case old != v.value:
+			fmt.Fprintf(w, "%s %s: %s -> %s\n", ts.Format(time.TimeOnly), v.path, old, v.value)
+		}
+	}
+
+	return next
+}
+
+// watch retrieves a page repeatedly and prints changed values until the
+// context is cancelled.
+func (s *session) watch(ctx context.Context, w io.Writer, path []string, interval time.Duration) error {
+	var prev map[string]string
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		items, err := s.fetchPage(ctx, path)
+		if err != nil {
+			return err
+		}
+
+		prev = writeChanges(w, time.Now(), prev, flattenValues(items, nil))
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -22,6 +22,15 @@ var Czech = &Terminology{
 	NavErrorMemory:  "Chybová paměť",
 	NavSwitchOffs:   "Odepnutí",
 
+	TemperatureFlow:    "flow",          // TODO correct translation
+	TemperatureReturn:  "return",        // TODO correct translation
+	TemperatureOutdoor: "outdoor temp.", // TODO correct translation
+	InputFlowRate:      "flow rate",     // TODO correct translation
+
+	OutputCompressor:     "VD1",         // TODO correct translation
+	ImpulsesCompressor:   "impulse VD1", // TODO correct translation
+	ElapsedHeatPumpSince: "HP since",    // TODO correct translation
+
 	NavOpHours: "Provozní hodiny",
 
 	HoursImpulsesFn: func(s string) bool {
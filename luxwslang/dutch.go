@@ -22,6 +22,15 @@ var Dutch = &Terminology{
 	NavErrorMemory:  "Storingsbuffer",
 	NavSwitchOffs:   "Afschakelingen",
 
+	TemperatureFlow:    "flow",          // TODO correct translation
+	TemperatureReturn:  "return",        // TODO correct translation
+	TemperatureOutdoor: "outdoor temp.", // TODO correct translation
+	InputFlowRate:      "flow rate",     // TODO correct translation
+
+	OutputCompressor:     "VD1",         // TODO correct translation
+	ImpulsesCompressor:   "impulse VD1", // TODO correct translation
+	ElapsedHeatPumpSince: "HP since",    // TODO correct translation
+
 	NavOpHours: "Bedrijfsuren",
 	HoursImpulsesFn: func(s string) bool {
 		return strings.HasPrefix(s, "impulse") || strings.HasPrefix(s, "Impulse")
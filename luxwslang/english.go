@@ -20,6 +20,15 @@ var English = &Terminology{
 	NavErrorMemory:  "error memory",
 	NavSwitchOffs:   "switch offs",
 
+	TemperatureFlow:    "flow",
+	TemperatureReturn:  "return",
+	TemperatureOutdoor: "outdoor temp.",
+	InputFlowRate:      "flow rate",
+
+	OutputCompressor:     "VD1",
+	ImpulsesCompressor:   "impulse VD1",
+	ElapsedHeatPumpSince: "HP since",
+
 	NavOpHours: "operating hours",
 	HoursImpulsesFn: func(s string) bool {
 		return strings.HasPrefix(s, "impulse") || strings.HasPrefix(s, "Impulse")
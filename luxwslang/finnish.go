@@ -22,6 +22,15 @@ var Finnish = &Terminology{
 	NavErrorMemory:  "Häiriöloki",
 	NavSwitchOffs:   "Pysähtymistieto",
 
+	TemperatureFlow:    "flow",          // TODO use finnish names
+	TemperatureReturn:  "return",        // TODO use finnish names
+	TemperatureOutdoor: "outdoor temp.", // TODO use finnish names
+	InputFlowRate:      "flow rate",     // TODO use finnish names
+
+	OutputCompressor:     "VD1",         // TODO use finnish names
+	ImpulsesCompressor:   "impulse VD1", // TODO use finnish names
+	ElapsedHeatPumpSince: "HP since",    // TODO use finnish names
+
 	NavOpHours: "Käyttötunnit",
 	HoursImpulsesFn: func(s string) bool {
 		return strings.HasPrefix(s, "impulse") || strings.HasPrefix(s, "Impulse")
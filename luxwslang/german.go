@@ -20,6 +20,15 @@ var German = &Terminology{
 	NavErrorMemory:  "Fehlerspeicher",
 	NavSwitchOffs:   "Abschaltungen",
 
+	TemperatureFlow:    "Vorlauf",
+	TemperatureReturn:  "Rücklauf",
+	TemperatureOutdoor: "Außentemperatur",
+	InputFlowRate:      "Durchfluss",
+
+	OutputCompressor:     "Verdichter 1",
+	ImpulsesCompressor:   "Impulse Verdichter 1",
+	ElapsedHeatPumpSince: "WP Seit",
+
 	NavOpHours: "Betriebsstunden",
 	HoursImpulsesFn: func(s string) bool {
 		return strings.HasPrefix(s, "impulse") || strings.HasPrefix(s, "Impulse")
@@ -42,6 +42,15 @@ type Terminology struct {
 	NavErrorMemory  string
 	NavSwitchOffs   string
 
+	TemperatureFlow    string
+	TemperatureReturn  string
+	TemperatureOutdoor string
+	InputFlowRate      string
+
+	OutputCompressor     string
+	ImpulsesCompressor   string
+	ElapsedHeatPumpSince string
+
 	NavOpHours      string
 	HoursImpulsesFn func(string) bool
 